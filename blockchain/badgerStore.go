@@ -0,0 +1,136 @@
+package blockchain
+
+import (
+	"errors"
+
+	"github.com/dgraph-io/badger/v3"
+)
+
+// BadgerOptions configures a Badger chain store
+type BadgerOptions struct {
+	// Path is the directory of the database
+	Path string
+
+	// MustExist fails with ErrChainNotFound instead of creating a new database
+	MustExist bool
+}
+
+// BadgerStore is a ChainStore kept in a Badger database
+type BadgerStore struct {
+	DB *badger.DB
+}
+
+// OpenBadgerStore opens or creates the Badger database at opts.Path
+func OpenBadgerStore(opts BadgerOptions) (*BadgerStore, error) {
+	if opts.MustExist && !DBExists(opts.Path) {
+		return nil, ErrChainNotFound
+	}
+	if err := EnsureDir(opts.Path); err != nil {
+		return nil, err
+	}
+
+	db, err := badger.Open(badger.DefaultOptions(opts.Path))
+	if err != nil {
+		return nil, err
+	}
+
+	return &BadgerStore{DB: db}, nil
+}
+
+// GetBlock gets a block by its hash
+func (s *BadgerStore) GetBlock(hash []byte) (*Block, error) {
+	return getBlock(s.Get, hash)
+}
+
+// GetTip gets the hash of the last block
+func (s *BadgerStore) GetTip() ([]byte, error) {
+	return getTip(s.Get)
+}
+
+// Get gets the value of a key
+func (s *BadgerStore) Get(key []byte) ([]byte, error) {
+	var value []byte
+
+	err := s.DB.View(func(txn *badger.Txn) error {
+		var err error
+		value, err = badgerGet(txn, key)
+		return err
+	})
+
+	return value, err
+}
+
+// Iterate calls fn for every key starting with prefix
+func (s *BadgerStore) Iterate(prefix []byte, fn func(key, value []byte) error) error {
+	err := s.DB.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			item := it.Item()
+			value, err := item.ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			if err := fn(item.KeyCopy(nil), value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if errors.Is(err, ErrStopIteration) {
+		return nil
+	}
+
+	return err
+}
+
+// Update runs fn in a Badger read-write transaction
+func (s *BadgerStore) Update(fn func(batch Batch) error) error {
+	return s.DB.Update(func(txn *badger.Txn) error {
+		return fn(badgerBatch{txn})
+	})
+}
+
+// Close closes the database
+func (s *BadgerStore) Close() error {
+	return s.DB.Close()
+}
+
+// badgerBatch is a Batch backed by a Badger transaction
+type badgerBatch struct {
+	txn *badger.Txn
+}
+
+func (b badgerBatch) PutBlock(block *Block) error {
+	return b.txn.Set(block.Hash, block.Serialize())
+}
+
+func (b badgerBatch) SetTip(hash []byte) error {
+	return b.txn.Set(tipKey, hash)
+}
+
+func (b badgerBatch) Get(key []byte) ([]byte, error) {
+	return badgerGet(b.txn, key)
+}
+
+func (b badgerBatch) Set(key, value []byte) error {
+	return b.txn.Set(key, value)
+}
+
+func (b badgerBatch) Delete(key []byte) error {
+	return b.txn.Delete(key)
+}
+
+// badgerGet copies the value of a key out of the transaction
+func badgerGet(txn *badger.Txn, key []byte) ([]byte, error) {
+	item, err := txn.Get(key)
+	if err == badger.ErrKeyNotFound {
+		return nil, ErrKeyNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return item.ValueCopy(nil)
+}
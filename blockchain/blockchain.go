@@ -1,28 +1,28 @@
 package blockchain
 
 import (
-	"bytes"
-	"crypto/ecdsa"
+	"context"
 	"digitalWallet/transactions"
-	"digitalWallet/utils"
+	"digitalWallet/wallet"
 	"encoding/hex"
 	"errors"
 	"fmt"
-	"github.com/dgraph-io/badger/v3"
-	"os"
-	"runtime"
+	"time"
 )
 
 // BlockChain defines a blockchain
 type BlockChain struct {
 	LastHash []byte
-	Database *badger.DB
+	Store    ChainStore
+
+	// Miner configures proof of work for new blocks
+	Miner Miner
 }
 
 // Defines blockchain iterator
 type BlockChainIterator struct {
 	CurrentHash []byte
-	Database    *badger.DB
+	Store       ChainStore
 }
 
 // Defines constants
@@ -33,333 +33,280 @@ const (
 )
 
 // AddBlock adds a new block to the block chain
-func (c *BlockChain) AddBlock(transactions []*transactions.Transaction) {
-	var lastHash []byte
+func (c *BlockChain) AddBlock(transactions []*transactions.Transaction) error {
+	_, _, err := c.MineBlock(context.Background(), transactions)
+	return err
+}
 
-	// Views last hash in the blockchain
-	err := c.Database.View(func(txn *badger.Txn) error {
-		// Gets Item based on key
-		item, err := txn.Get([]byte("lh"))
-		utils.HandleError(err)
-		err = item.Value(func(val []byte) error {
-			lastHash = val
-			return nil
-		})
-		utils.HandleError(err)
-		return err
-	})
-	utils.HandleError(err)
+// MineBlock mines a block of transactions on top of the chain and adds it
+// The block starts with a coinbase paying the reward and the fees of the
+// transactions to the miner address. The returned update is how the main
+// chain changed, for the mempool to follow.
+// Nothing is written when ctx is cancelled before a nonce is found
+func (c *BlockChain) MineBlock(ctx context.Context, txs []*transactions.Transaction) (*Block, *ChainUpdate, error) {
+	if c.Miner.Address == "" {
+		return nil, nil, ErrNoMinerAddress
+	}
 
-	// Creates new block
-	newBlock := CreateBlock(transactions, lastHash)
+	// Coinbases are only created by the miner
+	for _, tx := range txs {
+		if tx.IsCoinbase() {
+			return nil, nil, fmt.Errorf("%w: %x", ErrBadCoinbase, tx.ID)
+		}
+	}
+
+	// Gets last hash in the blockchain
+	lastHash, err := c.Store.GetTip()
+	if err != nil {
+		return nil, nil, err
+	}
 
-	// Updates transaction
-	err = c.Database.Update(func(transaction *badger.Txn) error {
+	lastBlock, err := c.GetBlock(lastHash)
+	if err != nil {
+		return nil, nil, err
+	}
 
-		// Adds new hash to transaction
-		err := transaction.Set(newBlock.Hash, newBlock.Serialize())
-		utils.HandleError(err)
+	bits, err := c.NextBits(lastBlock)
+	if err != nil {
+		return nil, nil, err
+	}
 
-		// Adds last hash to transaction
-		err = transaction.Set([]byte("lh"), newBlock.Hash)
+	// Collects the fees, which also checks every input is unspent
+	fees, err := UTXOSet{c}.Fees(txs)
+	if err != nil {
+		return nil, nil, err
+	}
 
-		c.LastHash = newBlock.Hash
-		return err
-	})
-	utils.HandleError(err)
-}
+	height := lastBlock.Header.Height + 1
+	coinbase, err := transactions.CoinbaseTxn(c.Miner.Address,
+		fmt.Sprintf("Reward for block %d", height), Policy.Subsidy(height)+fees)
+	if err != nil {
+		return nil, nil, err
+	}
+	txs = append([]*transactions.Transaction{coinbase}, txs...)
 
-// InitBlockChain initializes initial block chain
-func InitBlockChain(address string) *BlockChain {
-	//var lastHash []byte
-
-	//if DBExists() {
-	//	fmt.Println("blockchain already exists")
-	//	runtime.Goexit()
-	//}
-	//
-	//
-	//// Updates transaction
-	//_ = GetDB().Update(func(txn *badger.Txn) error {
-	//
-	//	// Initializes initial transaction
-	//	cbtx := transactions.CoinbaseTxn(address, genesisData)
-	//	genesis := Genesis(cbtx)
-	//	fmt.Println("Genesis Created")
-	//
-	//	// Adds initial hash to transaction
-	//	err := txn.Set(genesis.Hash, genesis.Serialize())
-	//	utils.HandleError(err)
-	//
-	//	// Adds last hash to transaction
-	//	err = txn.Set([]byte("lh"), genesis.Hash)
-	//
-	//	lastHash = genesis.Hash
-	//
-	//	return err
-	//
-	//})
-	//
-	//blockchain := BlockChain{lastHash, GetDB()}
-	//return &blockchain
+	// Blocks mined within a second of each other must still move past the
+	// median time of the blocks before them
+	median, err := c.MedianTimePast(lastBlock)
+	if err != nil {
+		return nil, nil, err
+	}
+	timestamp := time.Now().Unix()
+	if timestamp <= median {
+		timestamp = median + 1
+	}
 
-	var lastHash []byte
+	// Mines new block at the retargeted difficulty
+	newBlock, err := newBlockAt(ctx, c.Miner, txs, lastHash, height, bits, timestamp)
+	if err != nil {
+		return nil, nil, err
+	}
 
-	if DBExists() {
-		fmt.Println("blockchain already exists")
-		runtime.Goexit()
+	// Stores the block, the UTXO set and the tip together
+	update, err := c.AcceptBlock(newBlock)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	opts := badger.DefaultOptions(os.Getenv("BADGE_DB"))
-	db, err := badger.Open(opts)
-	utils.HandleError(err)
+	return newBlock, update, nil
+}
 
-	err = db.Update(func(txn *badger.Txn) error {
+// InitBlockChain initializes initial block chain in the store
+func InitBlockChain(store ChainStore, address string) (*BlockChain, error) {
+	var lastHash []byte
+
+	if _, err := store.GetTip(); err == nil {
+		return nil, ErrChainExists
+	} else if !errors.Is(err, ErrChainNotFound) {
+		return nil, err
+	}
 
-		cbtx := transactions.CoinbaseTxn(address, genesisData)
-		genesis := Genesis(cbtx)
-		fmt.Println("Genesis Created")
-		err = txn.Set(genesis.Hash, genesis.Serialize())
-		utils.HandleError(err)
-		err = txn.Set([]byte("lh"), genesis.Hash)
+	cbtx, err := transactions.CoinbaseTxn(address, genesisData, Policy.Subsidy(0))
+	if err != nil {
+		return nil, err
+	}
+	genesis, err := Genesis(cbtx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = store.Update(func(batch Batch) error {
+		err = batch.PutBlock(genesis)
+		if err != nil {
+			return err
+		}
+		err = batch.SetTip(genesis.Hash)
+		if err != nil {
+			return err
+		}
 
 		lastHash = genesis.Hash
 
-		return err
+		if _, err := (UTXOSet{}).update(batch, genesis); err != nil {
+			return err
+		}
+		if err := indexBlock(batch, genesis); err != nil {
+			return err
+		}
+		if err := setSchemaVersion(batch, SchemaVersion); err != nil {
+			return err
+		}
+
+		return batch.Set(workKey(genesis.Hash), blockWork(genesis.Header.Bits).Bytes())
 
 	})
 
-	utils.HandleError(err)
+	if err != nil {
+		return nil, err
+	}
 
-	blockchain := BlockChain{lastHash, db}
-	return &blockchain
+	blockchain := BlockChain{LastHash: lastHash, Store: store, Miner: DefaultMiner()}
+	return &blockchain, nil
 }
 
-// Adds to an existing blockchain
-func ContinueBlockChain(address string) *BlockChain {
-	//if !DBExists() {
-	//	fmt.Println("No blockchain found, please create one first")
-	//	runtime.Goexit()
-	//}
-	//
-	//
-	//var lastHash []byte
-	//
-	//
-	//opts := badger.DefaultOptions(os.Getenv("BADGE_DB"))
-	//db, err := badger.Open(opts)
-	//utils.HandleError(err)
-	//
-	//// Updates transaction
-	//err = db.Update(func(txn *badger.Txn) error {
-	//
-	//	// Gets last hash from transaction
-	//	item, err := txn.Get([]byte("lh"))
-	//	fmt.Println("ALALALALALA")
-	//	utils.HandleError(err)
-	//	err = item.Value(func(val []byte) error {
-	//		lastHash = val
-	//		return nil
-	//	})
-	//	utils.HandleError(err)
-	//	return err
-	//})
-	//
-	//
-	//utils.HandleError(err)
-	//
-	//chain := BlockChain{lastHash, GetDB()}
-	//return &chain
-
-	if DBExists() == false {
-		fmt.Println("No existing blockchain found, create one!")
-		runtime.Goexit()
+// ContinueBlockChain loads the existing blockchain of the store
+func ContinueBlockChain(store ChainStore) (*BlockChain, error) {
+	// Stores written by older or newer binaries are not read
+	if err := checkSchemaVersion(store); err != nil {
+		return nil, err
 	}
 
-	var lastHash []byte
-
-	opts := badger.DefaultOptions(os.Getenv("BADGE_DB"))
-
-	db, err := badger.Open(opts)
-	utils.HandleError(err)
+	lastHash, err := store.GetTip()
+	if err != nil {
+		return nil, err
+	}
 
-	err = db.Update(func(txn *badger.Txn) error {
-		item, err := txn.Get([]byte("lh"))
-		utils.HandleError(err)
-		err = item.Value(func(val []byte) error {
-			lastHash = val
-			return nil
-		})
-		return err
-	})
-	utils.HandleError(err)
+	chain := BlockChain{LastHash: lastHash, Store: store, Miner: DefaultMiner()}
 
-	chain := BlockChain{lastHash, db}
+	return &chain, nil
+}
 
-	return &chain
+// GetBlock gets a block by its hash
+func (c *BlockChain) GetBlock(hash []byte) (*Block, error) {
+	return c.Store.GetBlock(hash)
 }
 
 // Initiates blockchain iterator
 func (c *BlockChain) Iterator() *BlockChainIterator {
-	iterator := BlockChainIterator{c.LastHash, c.Database}
+	iterator := BlockChainIterator{c.LastHash, c.Store}
 
 	return &iterator
 }
 
 // Next calls the next block in the chain
-func (iterator *BlockChainIterator) Next() *Block {
-	var block *Block
-
-	// Views current hash in the blockchain
-	err := iterator.Database.View(func(txn *badger.Txn) error {
-		item, err := txn.Get(iterator.CurrentHash)
-		utils.HandleError(err)
-
-		err = item.Value(func(val []byte) error {
-			block = Deserialize(val)
-			return nil
-		})
-		utils.HandleError(err)
-		return err
-	})
-	utils.HandleError(err)
+func (iterator *BlockChainIterator) Next() (*Block, error) {
+	// Gets current block in the blockchain
+	block, err := iterator.Store.GetBlock(iterator.CurrentHash)
+	if err != nil {
+		return nil, err
+	}
 
-	iterator.CurrentHash = block.PrevHash
+	iterator.CurrentHash = block.Header.PrevHash
 
-	return block
+	return block, nil
 }
 
-// Finds unspent all transactions
-func (c *BlockChain) FindUnspentTransactions(pubKeyHash []byte) []transactions.Transaction {
-	var unspentTxs []transactions.Transaction
-
-	spentTXNOs := make(map[string][]int)
+// FindAllUnspentOutputs walks the whole chain and collects every unspent output
+// keyed by transaction ID and output index
+// It is used to rebuild the UTXO set
+func (c *BlockChain) FindAllUnspentOutputs() (map[string]map[int]transactions.TxOutput, error) {
+	UTXO := make(map[string]map[int]transactions.TxOutput)
+	spentTXOs := make(map[string][]int)
 
 	// Initiates blockchain iterator
 	iter := c.Iterator()
 
 	for {
 		// calls the next block in the chain
-		block := iter.Next()
+		block, err := iter.Next()
+		if err != nil {
+			return nil, err
+		}
 
-		for _, tx := range block.Transactions {
+		// Walks the block backwards as well so that spends of outputs
+		// created in the same block are seen before the outputs
+		for i := len(block.Transactions) - 1; i >= 0; i-- {
+			tx := block.Transactions[i]
 			txID := hex.EncodeToString(tx.ID)
 
 		Outputs:
 			for outIdx, out := range tx.Outputs {
-				if spentTXNOs[txID] != nil {
-					for _, spentOut := range spentTXNOs[txID] {
-						if spentOut == outIdx {
-							continue Outputs
-						}
+				for _, spentOut := range spentTXOs[txID] {
+					if spentOut == outIdx {
+						continue Outputs
 					}
 				}
-				if out.IsLockedWithKey(pubKeyHash) {
-					unspentTxs = append(unspentTxs, *tx)
+				if UTXO[txID] == nil {
+					UTXO[txID] = make(map[int]transactions.TxOutput)
 				}
+				UTXO[txID][outIdx] = out
 			}
 			if !tx.IsCoinbase() {
 				for _, in := range tx.Inputs {
-					if in.UsesKey(pubKeyHash) {
-						inTxID := hex.EncodeToString(in.ID)
-						spentTXNOs[inTxID] = append(spentTXNOs[inTxID], in.Out)
-					}
+					inTxID := hex.EncodeToString(in.ID)
+					spentTXOs[inTxID] = append(spentTXOs[inTxID], in.Out)
 				}
 			}
 		}
 
-		if len(block.PrevHash) == 0 {
+		if block.IsGenesis() {
 			break
 		}
 	}
-	return unspentTxs
-}
-
-// Finds all transaction outputs
-func (c *BlockChain) FindUTXO(pubKeyHash []byte) []transactions.TxOutput {
-	var UTXOs []transactions.TxOutput
-
-	// Finds unspent all transactions
-	unspentTransactions := c.FindUnspentTransactions(pubKeyHash)
-	for _, tx := range unspentTransactions {
-		for _, out := range tx.Outputs {
-			if out.IsLockedWithKey(pubKeyHash) {
-				UTXOs = append(UTXOs, out)
-			}
-		}
-	}
-
-	return UTXOs
-}
-
-// FindSpendableOutputs finds all spendable outputs from transactions
-func (c *BlockChain) FindSpendableOutputs(pubKeyHash []byte, amount int) (int, map[string][]int) {
-	unspentOuts := make(map[string][]int)
-
-	// Finds unspent all transactions
-	unspentTxs := c.FindUnspentTransactions(pubKeyHash)
-	accumulated := 0
-
-Work:
-	for _, tx := range unspentTxs {
-		txID := hex.EncodeToString(tx.ID)
-		for outIdx, out := range tx.Outputs {
-			if out.IsLockedWithKey(pubKeyHash) && accumulated < amount {
-				accumulated += out.Value
-				unspentOuts[txID] = append(unspentOuts[txID], outIdx)
-
-				if accumulated >= amount {
-					break Work
-				}
-			}
-		}
-	}
-	return accumulated, unspentOuts
+	return UTXO, nil
 }
 
 // FindTransaction finds transaction based on ID
 func (c *BlockChain) FindTransaction(ID []byte) (transactions.Transaction, error) {
-	iter := c.Iterator()
+	location, err := c.FindTransactionLocation(ID)
+	if err != nil {
+		return transactions.Transaction{}, err
+	}
 
-	for {
-		block := iter.Next()
+	block, err := c.GetBlock(location.BlockHash)
+	if err != nil {
+		return transactions.Transaction{}, err
+	}
 
-		for _, tx := range block.Transactions {
-			if bytes.Compare(tx.ID, ID) == 0 {
-				return *tx, nil
-			}
-		}
+	return *block.Transactions[location.Position], nil
+}
 
-		if len(block.PrevHash) == 0 {
-			break
-		}
+// FindTransactionBlock finds the block that contains the transaction
+func (c *BlockChain) FindTransactionBlock(ID []byte) (*Block, error) {
+	location, err := c.FindTransactionLocation(ID)
+	if err != nil {
+		return nil, err
 	}
 
-	return transactions.Transaction{}, errors.New("Transaction does not exist")
+	return c.GetBlock(location.BlockHash)
 }
 
 // SignTransaction signs the transaction
-func (c *BlockChain) SignTransaction(tx *transactions.Transaction, privKey ecdsa.PrivateKey) {
+func (c *BlockChain) SignTransaction(tx *transactions.Transaction, signer wallet.Signer) error {
 	prevTXs := make(map[string]transactions.Transaction)
 
 	for _, in := range tx.Inputs {
 		prevTX, err := c.FindTransaction(in.ID)
-		utils.HandleError(err)
+		if err != nil {
+			return err
+		}
 		prevTXs[hex.EncodeToString(prevTX.ID)] = prevTX
 	}
 
-	tx.Sign(privKey, prevTXs)
+	return tx.Sign(signer, prevTXs)
 }
 
 // VerifyTransaction verifies transaction
-func (c *BlockChain) VerifyTransaction(tx *transactions.Transaction) bool {
+func (c *BlockChain) VerifyTransaction(tx *transactions.Transaction) (bool, error) {
 	prevTXs := make(map[string]transactions.Transaction)
 
 	for _, in := range tx.Inputs {
 		prevTX, err := c.FindTransaction(in.ID)
-		utils.HandleError(err)
+		if err != nil {
+			return false, err
+		}
 		prevTXs[hex.EncodeToString(prevTX.ID)] = prevTX
 	}
 
-	return tx.Verify(prevTXs)
+	return tx.Verify(prevTXs), nil
 }
@@ -0,0 +1,215 @@
+package blockchain
+
+import (
+	"context"
+	"digitalWallet/transactions"
+	"digitalWallet/wallet"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"testing"
+)
+
+// testChain is a chain in memory whose genesis pays a key of the test
+type testChain struct {
+	*BlockChain
+	t      *testing.T
+	wallet *wallet.Wallet
+}
+
+// newTestChain creates a chain in memory mined with one worker
+func newTestChain(t *testing.T) *testChain {
+	w, err := wallet.MakeWallet(wallet.DefaultKeyType)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	chain, err := InitBlockChain(NewMemoryStore(), string(w.Address()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain.Miner.Workers = 1
+	chain.Miner.Address = string(w.Address())
+
+	return &testChain{chain, t, w}
+}
+
+// address gets the address paid by the chain
+func (c *testChain) address() string {
+	return string(c.wallet.Address())
+}
+
+// block gets a block by hash
+func (c *testChain) block(hash []byte) *Block {
+	c.t.Helper()
+
+	block, err := c.GetBlock(hash)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+
+	return block
+}
+
+// tip gets the last block of the main chain
+func (c *testChain) tip() *Block {
+	c.t.Helper()
+
+	return c.block(c.LastHash)
+}
+
+// mine mines a block of txs on the tip of the main chain
+func (c *testChain) mine(txs ...*transactions.Transaction) *Block {
+	c.t.Helper()
+
+	block, _, err := c.MineBlock(context.Background(), txs)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+
+	return block
+}
+
+// mineOn mines a block of txs on top of parent without accepting it
+// The block is timestamped a second after its parent and its coinbase
+// claims the subsidy and fees, tag keeps coinbases of different branches
+// apart.
+func (c *testChain) mineOn(parent *Block, tag string, fees int, txs ...*transactions.Transaction) *Block {
+	c.t.Helper()
+
+	height := parent.Header.Height + 1
+	coinbase, err := transactions.CoinbaseTxn(c.address(), fmt.Sprintf("%s %d", tag, height), Policy.Subsidy(height)+fees)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	bits, err := c.NextBits(parent)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+
+	block, err := newBlockAt(context.Background(), c.Miner, append([]*transactions.Transaction{coinbase}, txs...),
+		parent.Hash, height, bits, parent.Header.Timestamp+1)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+
+	return block
+}
+
+// accept accepts a block and fails the test when it is refused
+func (c *testChain) accept(block *Block) *ChainUpdate {
+	c.t.Helper()
+
+	update, err := c.AcceptBlock(block)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+
+	return update
+}
+
+// spend creates a transaction signed by the key of the chain spending
+// output out of prev, paying value to address and leaving the rest as fee
+func (c *testChain) spend(prev *transactions.Transaction, out int, address string, value int) *transactions.Transaction {
+	c.t.Helper()
+
+	output, err := transactions.NewTXOutput(value, address)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+
+	tx := &transactions.Transaction{
+		Version: transactions.TxVersion,
+		Inputs:  []transactions.TxInput{{ID: prev.ID, Out: out, PubKey: c.wallet.PublicKey}},
+		Outputs: []transactions.TxOutput{*output},
+	}
+	prevTXs := map[string]transactions.Transaction{hex.EncodeToString(prev.ID): *prev}
+	if err := tx.Sign(c.wallet.Signer(), prevTXs); err != nil {
+		c.t.Fatal(err)
+	}
+	tx.SetID()
+
+	return tx
+}
+
+// unspent lists the UTXO set by outpoint
+func (c *testChain) unspent() map[string]int {
+	c.t.Helper()
+
+	UTXO := make(map[string]int)
+	err := c.Store.Iterate(utxoPrefix, func(key, value []byte) error {
+		outpoint := key[len(utxoPrefix):]
+		txID := outpoint[:len(outpoint)-4]
+		outIdx := int(binary.BigEndian.Uint32(outpoint[len(outpoint)-4:]))
+
+		out, err := UTXOSet{c.BlockChain}.FindOutput(txID, outIdx)
+		if err != nil {
+			return err
+		}
+		UTXO[fmt.Sprintf("%x:%d", txID, outIdx)] = out.Value
+		return nil
+	})
+	if err != nil {
+		c.t.Fatal(err)
+	}
+
+	return UTXO
+}
+
+// checkUnspent checks the UTXO set against the outputs left unspent by the
+// main chain
+func (c *testChain) checkUnspent() {
+	c.t.Helper()
+
+	outputs, err := c.FindAllUnspentOutputs()
+	if err != nil {
+		c.t.Fatal(err)
+	}
+
+	want := make(map[string]int)
+	for txID, outs := range outputs {
+		for outIdx, out := range outs {
+			want[fmt.Sprintf("%s:%d", txID, outIdx)] = out.Value
+		}
+	}
+
+	got := c.unspent()
+	if len(got) != len(want) {
+		c.t.Errorf("UTXO set holds %d outputs, want %d", len(got), len(want))
+	}
+	for outpoint, value := range want {
+		if got[outpoint] != value {
+			c.t.Errorf("output %s is %d in the UTXO set, want %d", outpoint, got[outpoint], value)
+		}
+	}
+}
+
+func TestMineBlock(t *testing.T) {
+	c := newTestChain(t)
+	genesis := c.tip()
+
+	tx := c.spend(genesis.Transactions[0], 0, c.address(), Policy.Subsidy(0)-3)
+	block, update, err := c.MineBlock(context.Background(), []*transactions.Transaction{tx})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(update.Disconnected) != 0 || len(update.Connected) != 1 || update.Connected[0] != block {
+		t.Errorf("update %+v, want only the mined block connected", update)
+	}
+	if string(c.LastHash) != string(block.Hash) {
+		t.Errorf("tip %x, want %x", c.LastHash, block.Hash)
+	}
+	if got, want := block.Transactions[0].Outputs[0].Value, Policy.Subsidy(1)+3; got != want {
+		t.Errorf("coinbase pays %d, want %d", got, want)
+	}
+	if block.Header.Timestamp <= genesis.Header.Timestamp {
+		t.Errorf("timestamp %d is not after the genesis %d", block.Header.Timestamp, genesis.Header.Timestamp)
+	}
+	c.checkUnspent()
+
+	// The output is spent now
+	if _, _, err := c.MineBlock(context.Background(), []*transactions.Transaction{tx}); err == nil {
+		t.Error("mining a spent output succeeded")
+	}
+}
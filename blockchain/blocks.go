@@ -2,49 +2,186 @@ package blockchain
 
 import (
 	"bytes"
+	"context"
 	"crypto/sha256"
 	"digitalWallet/transactions"
+	"fmt"
+	"strings"
+	"time"
 )
 
+// BlockHeader defines the fields of a block covered by proof of work
+type BlockHeader struct {
+	Version    int
+	Timestamp  int64
+	Height     int
+	PrevHash   []byte
+	MerkleRoot []byte
+	Bits       int
+	Nonce      int
+}
+
 // Block defines a block model
 type Block struct {
+	Header       BlockHeader
 	Hash         []byte
 	Transactions []*transactions.Transaction
-	PrevHash     []byte
-	Nonce        int
 }
 
+// Defines constants
+const (
+	// LegacyBlockVersion marks blocks migrated from the header-less format
+	LegacyBlockVersion = 0
+
+	// HeaderBlockVersion marks blocks created before transaction IDs were checked
+	HeaderBlockVersion = 1
+
+	// TxIDBlockVersion marks blocks whose transaction IDs must match the
+	// transaction contents
+	TxIDBlockVersion = 2
+
+	// BinaryBlockVersion marks blocks whose hash is taken over the binary
+	// encoding of the header
+	BinaryBlockVersion = 3
+
+	// SignatureBlockVersion marks blocks whose transactions all have
+	// transactions.TxVersion, so that only canonical signatures are valid in
+	// them
+	SignatureBlockVersion = 4
+
+	// BlockVersion is the version of newly created blocks
+	BlockVersion = SignatureBlockVersion
+)
+
 // CreateBlock creates new block
-func CreateBlock(txs []*transactions.Transaction, prevHash []byte) *Block {
+func CreateBlock(txs []*transactions.Transaction, prevHash []byte, height, bits int) (*Block, error) {
+	return NewBlock(context.Background(), DefaultMiner(), txs, prevHash, height, bits)
+}
+
+// NewBlock mines a new block with the miner
+// Mining stops with the context error when ctx is cancelled
+func NewBlock(ctx context.Context, m Miner, txs []*transactions.Transaction, prevHash []byte, height, bits int) (*Block, error) {
+	return newBlockAt(ctx, m, txs, prevHash, height, bits, time.Now().Unix())
+}
+
+// newBlockAt mines a new block with the timestamp
+func newBlockAt(ctx context.Context, m Miner, txs []*transactions.Transaction, prevHash []byte, height, bits int, timestamp int64) (*Block, error) {
+
+	block := &Block{Hash: []byte{}, Transactions: txs}
+	block.Header = BlockHeader{
+		Version:   BlockVersion,
+		Timestamp: timestamp,
+		Height:    height,
+		PrevHash:  prevHash,
+		Bits:      bits,
+	}
 
-	block := &Block{[]byte{}, txs, prevHash, 0}
+	// Refuses transactions whose ID does not match their contents
+	if err := block.CheckTransactionIDs(); err != nil {
+		return nil, err
+	}
+	if err := block.CheckTransactionVersions(); err != nil {
+		return nil, err
+	}
+	block.Header.MerkleRoot = block.HashTransactions()
 
 	// Executes creation of new proof of work
 	pow := NewProofOfWork(block)
 
 	// Executes hashing algorithm
-	nonce, hash := pow.RunPoW()
+	nonce, hash, err := pow.Mine(ctx, m)
+	if err != nil {
+		return nil, err
+	}
 
 	block.Hash = hash[:]
-	block.Nonce = nonce
+	block.Header.Nonce = nonce
 
-	return block
+	return block, nil
 }
 
 // Genesis creates initial Block
-func Genesis(coinbase *transactions.Transaction) *Block {
-	return CreateBlock([]*transactions.Transaction{coinbase}, []byte{})
+func Genesis(coinbase *transactions.Transaction) (*Block, error) {
+	return CreateBlock([]*transactions.Transaction{coinbase}, []byte{}, 0, Params.InitialBits)
 }
 
-// HashTransactions hashes all transactions in a block
+// HashTransactions computes the merkle root of all transactions in a block
 func (b *Block) HashTransactions() []byte {
+	var txIDs [][]byte
+
+	for _, tx := range b.Transactions {
+		txIDs = append(txIDs, tx.ID)
+	}
+	tree := NewMerkleTree(txIDs)
+
+	return tree.Root()
+}
+
+// legacyHashTransactions hashes the concatenated transaction IDs
+// the way blocks did before merkle roots, for proof of work on legacy blocks
+func (b *Block) legacyHashTransactions() []byte {
 	var txHashes [][]byte
-	var txHash [32]byte
 
 	for _, tx := range b.Transactions {
 		txHashes = append(txHashes, tx.ID)
 	}
-	txHash = sha256.Sum256(bytes.Join(txHashes, []byte{}))
+	txHash := sha256.Sum256(bytes.Join(txHashes, []byte{}))
 
 	return txHash[:]
 }
+
+// CheckTransactionIDs checks the ID of every transaction in the block
+// Blocks older than TxIDBlockVersion predate the check and always pass
+func (b *Block) CheckTransactionIDs() error {
+	if b.Header.Version < TxIDBlockVersion {
+		return nil
+	}
+
+	for _, tx := range b.Transactions {
+		if err := tx.CheckID(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CheckTransactionVersions checks that every transaction of the block has
+// transactions.TxVersion
+// Blocks older than SignatureBlockVersion may hold older transactions
+func (b *Block) CheckTransactionVersions() error {
+	if b.Header.Version < SignatureBlockVersion {
+		return nil
+	}
+
+	for _, tx := range b.Transactions {
+		if tx.Version != transactions.TxVersion {
+			return fmt.Errorf("%w: %d in transaction %x", ErrBadTxVersion, tx.Version, tx.ID)
+		}
+	}
+	return nil
+}
+
+// IsGenesis checks if the block is the first block of the chain
+func (b *Block) IsGenesis() bool {
+	return len(b.Header.PrevHash) == 0
+}
+
+// String creates strings of the block header for the CLI
+func (h BlockHeader) String() string {
+	var lines []string
+
+	timestamp := "unknown"
+	if h.Timestamp != 0 {
+		timestamp = time.Unix(h.Timestamp, 0).UTC().Format(time.RFC3339)
+	}
+
+	lines = append(lines, fmt.Sprintf("Height:        %d", h.Height))
+	lines = append(lines, fmt.Sprintf("Version:       %d", h.Version))
+	lines = append(lines, fmt.Sprintf("Timestamp:     %s", timestamp))
+	lines = append(lines, fmt.Sprintf("Previous hash: %x", h.PrevHash))
+	lines = append(lines, fmt.Sprintf("Merkle root:   %x", h.MerkleRoot))
+	lines = append(lines, fmt.Sprintf("Bits:          %d", h.Bits))
+	lines = append(lines, fmt.Sprintf("Nonce:         %d", h.Nonce))
+
+	return strings.Join(lines, "\n")
+}
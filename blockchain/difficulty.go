@@ -0,0 +1,150 @@
+package blockchain
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// ChainParams defines the difficulty parameters of the chain
+type ChainParams struct {
+	// InitialBits is the difficulty of the genesis block
+	InitialBits int
+
+	// TargetSpacing is the desired time between two blocks
+	TargetSpacing time.Duration
+
+	// RetargetInterval is the number of blocks between difficulty adjustments
+	RetargetInterval int
+
+	// MaxRetargetStep is the most bits difficulty may move per adjustment
+	MaxRetargetStep int
+
+	// MinBits and MaxBits bound the difficulty
+	MinBits int
+	MaxBits int
+
+	// MedianTimeBlocks is the number of blocks whose median timestamp a new
+	// block must be later than
+	MedianTimeBlocks int
+
+	// MaxFutureTime is how far ahead of the clock a block timestamp may be
+	MaxFutureTime time.Duration
+}
+
+// DefaultParams returns the default difficulty parameters
+func DefaultParams() ChainParams {
+	return ChainParams{
+		InitialBits:      LegacyDifficulty,
+		TargetSpacing:    10 * time.Second,
+		RetargetInterval: 10,
+		MaxRetargetStep:  2,
+		MinBits:          1,
+		MaxBits:          255,
+		MedianTimeBlocks: 11,
+		MaxFutureTime:    2 * time.Minute,
+	}
+}
+
+var (
+	// Params holds the difficulty parameters used by the chain
+	Params = DefaultParams()
+)
+
+// NextBits computes the difficulty of the block following prev
+//
+// Difficulty only changes on heights that are a multiple of the retarget
+// interval. The time it took to mine the last interval is compared with the
+// target spacing and difficulty moves by the log2 of that ratio, clamped to
+// MaxRetargetStep bits.
+func (c *BlockChain) NextBits(prev *Block) (int, error) {
+	if prev == nil {
+		return Params.InitialBits, nil
+	}
+
+	height := prev.Header.Height + 1
+	if Params.RetargetInterval <= 1 || height%Params.RetargetInterval != 0 {
+		return prev.Header.Bits, nil
+	}
+
+	// Walks back to the first block of the interval
+	first := prev
+	for i := 0; i < Params.RetargetInterval-1 && !first.IsGenesis(); i++ {
+		block, err := c.GetBlock(first.Header.PrevHash)
+		if err != nil {
+			return 0, err
+		}
+		first = block
+	}
+
+	// Legacy blocks have no timestamp to measure against
+	if first.Header.Timestamp == 0 {
+		return prev.Header.Bits, nil
+	}
+
+	return retarget(prev.Header.Bits, prev.Header.Height-first.Header.Height,
+		prev.Header.Timestamp-first.Header.Timestamp), nil
+}
+
+// retarget adjusts bits for blocks mined over timespan seconds
+func retarget(bits int, blocks int, timespan int64) int {
+	expected := Params.TargetSpacing.Seconds() * float64(blocks)
+	actual := float64(timespan)
+	if actual < 1 {
+		actual = 1
+	}
+
+	step := int(math.Round(math.Log2(expected / actual)))
+	if step > Params.MaxRetargetStep {
+		step = Params.MaxRetargetStep
+	}
+	if step < -Params.MaxRetargetStep {
+		step = -Params.MaxRetargetStep
+	}
+
+	bits += step
+	if bits < Params.MinBits {
+		bits = Params.MinBits
+	}
+	if bits > Params.MaxBits {
+		bits = Params.MaxBits
+	}
+
+	return bits
+}
+
+// MedianTimePast gets the median timestamp of a block and the blocks before
+// it, up to MedianTimeBlocks of them
+func (c *BlockChain) MedianTimePast(block *Block) (int64, error) {
+	timestamps := []int64{block.Header.Timestamp}
+	for len(timestamps) < Params.MedianTimeBlocks && !block.IsGenesis() {
+		var err error
+		if block, err = c.GetBlock(block.Header.PrevHash); err != nil {
+			return 0, err
+		}
+		timestamps = append(timestamps, block.Header.Timestamp)
+	}
+
+	sort.Slice(timestamps, func(i, j int) bool { return timestamps[i] < timestamps[j] })
+
+	return timestamps[len(timestamps)/2], nil
+}
+
+// checkTimestamp checks the timestamp of a block mined on top of parent
+// It must be later than the median time past of the parent, so that it keeps
+// moving forward, and not too far ahead of the clock, so that retargeting
+// cannot be gamed with timestamps from the future.
+func (c *BlockChain) checkTimestamp(block, parent *Block) error {
+	median, err := c.MedianTimePast(parent)
+	if err != nil {
+		return err
+	}
+	if block.Header.Timestamp <= median {
+		return ErrTimeTooOld
+	}
+	if block.Header.Timestamp > time.Now().Add(Params.MaxFutureTime).Unix() {
+		return ErrTimeTooNew
+	}
+
+	return nil
+}
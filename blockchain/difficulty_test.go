@@ -0,0 +1,139 @@
+package blockchain
+
+import (
+	"context"
+	"digitalWallet/transactions"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestRetarget(t *testing.T) {
+	// Nine blocks are expected to take 90 seconds
+	tests := []struct {
+		bits     int
+		timespan int64
+		want     int
+	}{
+		{12, 90, 12},
+		{12, 100, 12},
+		{12, 45, 13},
+		{12, 22, 14},
+		{12, 180, 11},
+		{12, 360, 10},
+		{12, 1, 14},
+		{12, 0, 14},
+		{12, -50, 14},
+		{12, 100000, 10},
+		{1, 1000, 1},
+		{2, 1000, 1},
+		{255, 1, 255},
+	}
+
+	for _, test := range tests {
+		if got := retarget(test.bits, 9, test.timespan); got != test.want {
+			t.Errorf("retarget(%d, 9, %d) = %d, want %d", test.bits, test.timespan, got, test.want)
+		}
+	}
+}
+
+// mineAt mines a block on top of parent with the timestamp and bits given
+func (c *testChain) mineAt(parent *Block, bits int, timestamp int64) *Block {
+	c.t.Helper()
+
+	height := parent.Header.Height + 1
+	coinbase, err := transactions.CoinbaseTxn(c.address(), fmt.Sprintf("at %d", height), Policy.Subsidy(height))
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	block, err := newBlockAt(context.Background(), c.Miner, []*transactions.Transaction{coinbase},
+		parent.Hash, height, bits, timestamp)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+
+	return block
+}
+
+func TestNextBits(t *testing.T) {
+	c := newTestChain(t)
+	genesis := c.tip()
+	bits := genesis.Header.Bits
+
+	// The interval is mined a second per block, much faster than the target
+	prev := genesis
+	for height := 1; height < Params.RetargetInterval; height++ {
+		if next, err := c.NextBits(prev); err != nil || next != bits {
+			t.Fatalf("bits after height %d are %d, %v, want %d", prev.Header.Height, next, err, bits)
+		}
+		prev = c.mineOn(prev, "fast", 0)
+		c.accept(prev)
+	}
+
+	want := bits + Params.MaxRetargetStep
+	if next, err := c.NextBits(prev); err != nil || next != want {
+		t.Fatalf("retargeted bits are %d, %v, want %d", next, err, want)
+	}
+
+	// Blocks keeping the old difficulty are refused
+	stale := c.mineAt(prev, bits, prev.Header.Timestamp+1)
+	if _, err := c.AcceptBlock(stale); !errors.Is(err, ErrBadProofOfWork) {
+		t.Errorf("block with the old difficulty gave %v, want %v", err, ErrBadProofOfWork)
+	}
+	c.accept(c.mineAt(prev, want, prev.Header.Timestamp+1))
+
+	if bits, err := c.NextBits(nil); err != nil || bits != Params.InitialBits {
+		t.Errorf("bits of the genesis are %d, %v, want %d", bits, err, Params.InitialBits)
+	}
+}
+
+func TestCheckTimestamp(t *testing.T) {
+	c := newTestChain(t)
+	genesis := c.tip()
+
+	// Timestamps one second apart have the middle one as median
+	prev := genesis
+	for i := 0; i < 4; i++ {
+		prev = c.mineOn(prev, "time", 0)
+		c.accept(prev)
+	}
+	median, err := c.MedianTimePast(prev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := genesis.Header.Timestamp + 2; median != want {
+		t.Fatalf("median time past %d, want %d", median, want)
+	}
+
+	// Only the last MedianTimeBlocks blocks count
+	for i := 0; i < Params.MedianTimeBlocks; i++ {
+		prev = c.mineOn(prev, "time", 0)
+		c.accept(prev)
+	}
+	median, err = c.MedianTimePast(prev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := prev.Header.Timestamp - int64(Params.MedianTimeBlocks/2); median != want {
+		t.Errorf("median time past of %d blocks is %d, want %d", Params.MedianTimeBlocks+5, median, want)
+	}
+
+	tests := []struct {
+		timestamp int64
+		want      error
+	}{
+		{median - 1, ErrTimeTooOld},
+		{median, ErrTimeTooOld},
+		{median + 1, nil},
+		{time.Now().Add(Params.MaxFutureTime).Add(-time.Minute).Unix(), nil},
+		{time.Now().Add(Params.MaxFutureTime).Add(time.Minute).Unix(), ErrTimeTooNew},
+	}
+
+	for _, test := range tests {
+		block := &Block{Header: BlockHeader{Timestamp: test.timestamp}}
+		if err := c.checkTimestamp(block, prev); !errors.Is(err, test.want) {
+			t.Errorf("timestamp %d after median %d gave %v, want %v", test.timestamp, median, err, test.want)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package blockchain
+
+import (
+	"digitalWallet/transactions"
+	"errors"
+)
+
+// Defines blockchain errors
+var (
+	// ErrChainNotFound is returned when no blockchain has been created yet
+	ErrChainNotFound = errors.New("no existing blockchain found, create one first")
+
+	// ErrChainExists is returned when creating a blockchain over an existing one
+	ErrChainExists = errors.New("blockchain already exists")
+
+	// ErrSchemaOutdated is returned when opening a store that needs migrating
+	ErrSchemaOutdated = errors.New("database schema is outdated, run migrate")
+
+	// ErrSchemaTooNew is returned when opening a store written by a newer binary
+	ErrSchemaTooNew = errors.New("database schema is newer than supported")
+
+	// ErrSchemaCorrupt is returned when the stored schema version is unreadable
+	ErrSchemaCorrupt = errors.New("database schema version is corrupt")
+
+	// ErrBlockNotFound is returned when a block is not in the database
+	ErrBlockNotFound = errors.New("block does not exist")
+
+	// ErrTxNotInBlock is returned when proving a transaction a block lacks
+	ErrTxNotInBlock = errors.New("transaction is not in block")
+
+	// ErrTxNotFound is returned when a transaction is not in the chain
+	ErrTxNotFound = transactions.ErrTxNotFound
+
+	// ErrBadTxID is returned when a transaction ID does not match its contents
+	ErrBadTxID = transactions.ErrBadTxID
+)
@@ -0,0 +1,215 @@
+package blockchain
+
+import (
+	"bytes"
+	"digitalWallet/transactions"
+	"digitalWallet/wallet"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Defines chain index keys
+//
+// The indexes only cover the main chain:
+//
+//	hgt-<height>            -> block hash
+//	txi-<txid>              -> block hash and position in the block
+//	atx-<pubKeyHash><txid>  -> nothing
+//
+// They are updated when blocks are connected to or disconnected from the
+// main chain, so lookups no longer walk the chain.
+var (
+	heightPrefix    = []byte("hgt-")
+	txIndexPrefix   = []byte("txi-")
+	addressTxPrefix = []byte("atx-")
+
+	// indexTipKey holds the hash of the block the indexes were last updated to
+	indexTipKey = []byte("idxt")
+)
+
+// TxLocation is where a transaction of the main chain is stored
+type TxLocation struct {
+	BlockHash []byte
+	Position  int
+}
+
+// heightKey builds the key of the main chain block at a height
+func heightKey(height int) []byte {
+	index := make([]byte, 8)
+	binary.BigEndian.PutUint64(index, uint64(height))
+
+	return bytes.Join([][]byte{heightPrefix, index}, []byte{})
+}
+
+// txIndexKey builds the key of the location of a transaction
+func txIndexKey(txID []byte) []byte {
+	return bytes.Join([][]byte{txIndexPrefix, txID}, []byte{})
+}
+
+// addressTxKey builds the key linking an address to a transaction
+func addressTxKey(pubKeyHash, txID []byte) []byte {
+	return bytes.Join([][]byte{addressTxPrefix, pubKeyHash, txID}, []byte{})
+}
+
+// txAddresses lists the public key hashes a transaction pays or spends from
+func txAddresses(tx *transactions.Transaction) [][]byte {
+	var hashes [][]byte
+	seen := make(map[string]bool)
+
+	add := func(pubKeyHash []byte) {
+		if !seen[string(pubKeyHash)] {
+			seen[string(pubKeyHash)] = true
+			hashes = append(hashes, pubKeyHash)
+		}
+	}
+
+	if !tx.IsCoinbase() {
+		for _, in := range tx.Inputs {
+			add(wallet.PublicKeyHash(in.PubKey))
+		}
+	}
+	for _, out := range tx.Outputs {
+		add(out.PubKeyHash)
+	}
+
+	return hashes
+}
+
+// indexBlock adds a block connected to the main chain to the indexes
+func indexBlock(batch Batch, block *Block) error {
+	if err := batch.Set(heightKey(block.Header.Height), block.Hash); err != nil {
+		return err
+	}
+
+	for i, tx := range block.Transactions {
+		position := make([]byte, 4)
+		binary.BigEndian.PutUint32(position, uint32(i))
+
+		if err := batch.Set(txIndexKey(tx.ID), bytes.Join([][]byte{block.Hash, position}, []byte{})); err != nil {
+			return err
+		}
+		for _, pubKeyHash := range txAddresses(tx) {
+			if err := batch.Set(addressTxKey(pubKeyHash, tx.ID), []byte{}); err != nil {
+				return err
+			}
+		}
+	}
+
+	return batch.Set(indexTipKey, block.Hash)
+}
+
+// unindexBlock removes a block disconnected from the main chain from the
+// indexes
+func unindexBlock(batch Batch, block *Block) error {
+	if err := batch.Delete(heightKey(block.Header.Height)); err != nil {
+		return err
+	}
+
+	for _, tx := range block.Transactions {
+		if err := batch.Delete(txIndexKey(tx.ID)); err != nil {
+			return err
+		}
+		for _, pubKeyHash := range txAddresses(tx) {
+			if err := batch.Delete(addressTxKey(pubKeyHash, tx.ID)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return batch.Set(indexTipKey, block.Header.PrevHash)
+}
+
+// indexesCurrent reports whether the indexes reflect the chain tip
+func (c *BlockChain) indexesCurrent() (bool, error) {
+	indexedHash, err := c.Store.Get(indexTipKey)
+	if errors.Is(err, ErrKeyNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return bytes.Equal(indexedHash, c.LastHash), nil
+}
+
+// ReindexChain rebuilds the height, transaction and address indexes from
+// the main chain
+func (c *BlockChain) ReindexChain() error {
+	UTXO := UTXOSet{c}
+	for _, prefix := range [][]byte{heightPrefix, txIndexPrefix, addressTxPrefix} {
+		if err := UTXO.DeleteByPrefix(prefix); err != nil {
+			return err
+		}
+	}
+
+	hashes, err := c.chainHashes()
+	if err != nil {
+		return err
+	}
+
+	// Indexes one block per batch to stay within a single transaction
+	for _, hash := range hashes {
+		block, err := c.GetBlock(hash)
+		if err != nil {
+			return err
+		}
+
+		err = c.Store.Update(func(batch Batch) error {
+			return indexBlock(batch, block)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetBlockByHeight gets the main chain block at a height
+func (c *BlockChain) GetBlockByHeight(height int) (*Block, error) {
+	if height < 0 {
+		return nil, fmt.Errorf("%w: height %d", ErrBlockNotFound, height)
+	}
+
+	hash, err := c.Store.Get(heightKey(height))
+	if errors.Is(err, ErrKeyNotFound) {
+		return nil, fmt.Errorf("%w: height %d", ErrBlockNotFound, height)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return c.GetBlock(hash)
+}
+
+// FindTransactionLocation gets the block and position of a main chain
+// transaction
+func (c *BlockChain) FindTransactionLocation(ID []byte) (TxLocation, error) {
+	data, err := c.Store.Get(txIndexKey(ID))
+	if errors.Is(err, ErrKeyNotFound) {
+		return TxLocation{}, fmt.Errorf("%w: %x", ErrTxNotFound, ID)
+	}
+	if err != nil {
+		return TxLocation{}, err
+	}
+
+	return TxLocation{
+		BlockHash: data[:len(data)-4],
+		Position:  int(binary.BigEndian.Uint32(data[len(data)-4:])),
+	}, nil
+}
+
+// FindAddressTransactions lists the IDs of the main chain transactions that
+// pay or spend from an address
+func (c *BlockChain) FindAddressTransactions(pubKeyHash []byte) ([][]byte, error) {
+	var txIDs [][]byte
+	prefix := bytes.Join([][]byte{addressTxPrefix, pubKeyHash}, []byte{})
+
+	err := c.Store.Iterate(prefix, func(key, value []byte) error {
+		txIDs = append(txIDs, append([]byte{}, key[len(prefix):]...))
+		return nil
+	})
+
+	return txIDs, err
+}
@@ -0,0 +1,171 @@
+package blockchain
+
+import (
+	"bytes"
+	"digitalWallet/transactions"
+	"digitalWallet/wallet"
+	"errors"
+	"sort"
+	"testing"
+)
+
+// checkIndexes checks the height, transaction and address indexes against
+// the blocks of the main chain
+func (c *testChain) checkIndexes(blocks []*Block, addresses ...[]byte) {
+	c.t.Helper()
+
+	for height, block := range blocks {
+		got, err := c.GetBlockByHeight(height)
+		if err != nil {
+			c.t.Fatal(err)
+		}
+		if !bytes.Equal(got.Hash, block.Hash) {
+			c.t.Errorf("height %d is %x, want %x", height, got.Hash, block.Hash)
+		}
+
+		for position, tx := range block.Transactions {
+			location, err := c.FindTransactionLocation(tx.ID)
+			if err != nil {
+				c.t.Fatal(err)
+			}
+			if !bytes.Equal(location.BlockHash, block.Hash) || location.Position != position {
+				c.t.Errorf("transaction %x is at %x:%d, want %x:%d",
+					tx.ID, location.BlockHash, location.Position, block.Hash, position)
+			}
+		}
+	}
+	for _, height := range []int{-1, len(blocks)} {
+		if _, err := c.GetBlockByHeight(height); !errors.Is(err, ErrBlockNotFound) {
+			c.t.Errorf("height %d gave %v, want %v", height, err, ErrBlockNotFound)
+		}
+	}
+
+	// Every address lists the transactions paying or spending from it
+	for _, pubKeyHash := range addresses {
+		var want []string
+		for _, block := range blocks {
+			for _, tx := range block.Transactions {
+				for _, txHash := range txAddresses(tx) {
+					if bytes.Equal(txHash, pubKeyHash) {
+						want = append(want, string(tx.ID))
+					}
+				}
+			}
+		}
+		sort.Strings(want)
+
+		txIDs, err := c.FindAddressTransactions(pubKeyHash)
+		if err != nil {
+			c.t.Fatal(err)
+		}
+		var got []string
+		for _, txID := range txIDs {
+			got = append(got, string(txID))
+		}
+		sort.Strings(got)
+
+		if len(got) != len(want) {
+			c.t.Errorf("address %x has %d transactions, want %d", pubKeyHash, len(got), len(want))
+			continue
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				c.t.Errorf("address %x lists %x, want %x", pubKeyHash, got[i], want[i])
+			}
+		}
+	}
+}
+
+func TestIndexes(t *testing.T) {
+	c := newTestChain(t)
+	genesis := c.tip()
+	other, err := wallet.MakeWallet(wallet.KeyTypeEd25519)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chainKey, otherKey := wallet.PublicKeyHash(c.wallet.PublicKey), wallet.PublicKeyHash(other.PublicKey)
+
+	tx := c.spend(genesis.Transactions[0], 0, string(other.Address()), Policy.Subsidy(0))
+	main1 := c.mine(tx)
+	main2 := c.mine()
+	c.checkIndexes([]*Block{genesis, main1, main2}, chainKey, otherKey)
+
+	txIDs, err := c.FindAddressTransactions(otherKey)
+	if err != nil || len(txIDs) != 1 || !bytes.Equal(txIDs[0], tx.ID) {
+		t.Errorf("payee lists %x, %v, want only %x", txIDs, err, tx.ID)
+	}
+	if _, err := c.FindTransactionLocation([]byte("unknown")); !errors.Is(err, ErrTxNotFound) {
+		t.Errorf("unknown transaction gave %v, want %v", err, ErrTxNotFound)
+	}
+
+	// A branch without the payment takes it out of the indexes
+	fork1 := c.mineOn(genesis, "fork", 0)
+	fork2 := c.mineOn(fork1, "fork", 0)
+	fork3 := c.mineOn(fork2, "fork", 0)
+	for _, block := range []*Block{fork1, fork2, fork3} {
+		c.accept(block)
+	}
+	c.checkIndexes([]*Block{genesis, fork1, fork2, fork3}, chainKey, otherKey)
+
+	if _, err := c.FindTransactionLocation(tx.ID); !errors.Is(err, ErrTxNotFound) {
+		t.Errorf("disconnected transaction gave %v, want %v", err, ErrTxNotFound)
+	}
+	if txIDs, err := c.FindAddressTransactions(otherKey); err != nil || len(txIDs) != 0 {
+		t.Errorf("payee still lists %x, %v", txIDs, err)
+	}
+	if indexed, err := c.indexesCurrent(); err != nil || !indexed {
+		t.Errorf("indexesCurrent() = %v, %v after a reorganization", indexed, err)
+	}
+}
+
+func TestReindexChain(t *testing.T) {
+	c := newTestChain(t)
+	genesis := c.tip()
+	main1 := c.mine(c.spend(genesis.Transactions[0], 0, c.address(), Policy.Subsidy(0)-2))
+	main2 := c.mine()
+	blocks := []*Block{genesis, main1, main2}
+	chainKey := wallet.PublicKeyHash(c.wallet.PublicKey)
+
+	// Stores created before the indexes only have the blocks
+	UTXO := UTXOSet{c.BlockChain}
+	for _, prefix := range [][]byte{heightPrefix, txIndexPrefix, addressTxPrefix, indexTipKey} {
+		if err := UTXO.DeleteByPrefix(prefix); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if indexed, err := c.indexesCurrent(); err != nil || indexed {
+		t.Fatalf("indexesCurrent() = %v, %v without indexes", indexed, err)
+	}
+	if _, err := c.GetBlockByHeight(1); !errors.Is(err, ErrBlockNotFound) {
+		t.Fatalf("height 1 gave %v without indexes", err)
+	}
+
+	if err := migrateIndexes(c.BlockChain); err != nil {
+		t.Fatal(err)
+	}
+	c.checkIndexes(blocks, chainKey)
+	if indexed, err := c.indexesCurrent(); err != nil || !indexed {
+		t.Errorf("indexesCurrent() = %v, %v after reindexing", indexed, err)
+	}
+
+	// Reindexing again changes nothing
+	if err := c.ReindexChain(); err != nil {
+		t.Fatal(err)
+	}
+	c.checkIndexes(blocks, chainKey)
+}
+
+func TestTxAddresses(t *testing.T) {
+	c := newTestChain(t)
+	coinbase := c.tip().Transactions[0]
+	chainKey := wallet.PublicKeyHash(c.wallet.PublicKey)
+
+	// Spending to the same key lists it once
+	spend := c.spend(coinbase, 0, c.address(), 1)
+	for _, tx := range []*transactions.Transaction{coinbase, spend} {
+		hashes := txAddresses(tx)
+		if len(hashes) != 1 || !bytes.Equal(hashes[0], chainKey) {
+			t.Errorf("transaction %x lists %x, want only %x", tx.ID, hashes, chainKey)
+		}
+	}
+}
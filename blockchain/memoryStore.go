@@ -0,0 +1,137 @@
+package blockchain
+
+import (
+	"bytes"
+	"errors"
+	"sort"
+	"sync"
+)
+
+// MemoryStore is a ChainStore kept in memory
+// It is lost when the process exits and is meant for tests and tooling
+type MemoryStore struct {
+	mu   sync.RWMutex
+	data map[string][]byte
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{data: make(map[string][]byte)}
+}
+
+// GetBlock gets a block by its hash
+func (s *MemoryStore) GetBlock(hash []byte) (*Block, error) {
+	return getBlock(s.Get, hash)
+}
+
+// GetTip gets the hash of the last block
+func (s *MemoryStore) GetTip() ([]byte, error) {
+	return getTip(s.Get)
+}
+
+// Get gets the value of a key
+func (s *MemoryStore) Get(key []byte) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	value, ok := s.data[string(key)]
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+
+	return append([]byte{}, value...), nil
+}
+
+// Iterate calls fn for every key starting with prefix
+// It works on a snapshot so fn may write to the store
+func (s *MemoryStore) Iterate(prefix []byte, fn func(key, value []byte) error) error {
+	s.mu.RLock()
+	var keys []string
+	for key := range s.data {
+		if bytes.HasPrefix([]byte(key), prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	values := make([][]byte, len(keys))
+	for i, key := range keys {
+		values[i] = append([]byte{}, s.data[key]...)
+	}
+	s.mu.RUnlock()
+
+	for i, key := range keys {
+		err := fn([]byte(key), values[i])
+		if errors.Is(err, ErrStopIteration) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Update runs fn and applies its writes when it succeeds
+func (s *MemoryStore) Update(fn func(batch Batch) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	batch := &memoryBatch{store: s, writes: make(map[string][]byte)}
+	if err := fn(batch); err != nil {
+		return err
+	}
+
+	for key, value := range batch.writes {
+		if value == nil {
+			delete(s.data, key)
+		} else {
+			s.data[key] = value
+		}
+	}
+
+	return nil
+}
+
+// Close does nothing, the data lives as long as the store
+func (s *MemoryStore) Close() error {
+	return nil
+}
+
+// memoryBatch buffers the writes of an update
+// A nil value marks a deleted key
+type memoryBatch struct {
+	store  *MemoryStore
+	writes map[string][]byte
+}
+
+func (b *memoryBatch) PutBlock(block *Block) error {
+	return b.Set(block.Hash, block.Serialize())
+}
+
+func (b *memoryBatch) SetTip(hash []byte) error {
+	return b.Set(tipKey, hash)
+}
+
+func (b *memoryBatch) Get(key []byte) ([]byte, error) {
+	value, ok := b.writes[string(key)]
+	if !ok {
+		value, ok = b.store.data[string(key)]
+	}
+	if !ok || value == nil {
+		return nil, ErrKeyNotFound
+	}
+
+	return append([]byte{}, value...), nil
+}
+
+func (b *memoryBatch) Set(key, value []byte) error {
+	b.writes[string(key)] = append([]byte{}, value...)
+	return nil
+}
+
+func (b *memoryBatch) Delete(key []byte) error {
+	b.writes[string(key)] = nil
+	return nil
+}
@@ -0,0 +1,143 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+)
+
+// MerkleTree is a binary hash tree over the transaction IDs of a block
+//
+// Leaves and inner nodes are hashed with different prefixes so that an inner
+// node can never be passed off as a leaf. A node without a sibling is carried
+// up to the next level unchanged instead of being paired with itself.
+type MerkleTree struct {
+	// Levels holds the hashes of every level, starting with the leaves
+	Levels [][][]byte
+}
+
+// MerkleStep is one sibling hash on the path from a leaf to the root
+type MerkleStep struct {
+	Hash []byte
+	// Left is true when the sibling sits to the left of the running hash
+	Left bool
+}
+
+// MerkleProof proves that a transaction is part of a block
+type MerkleProof struct {
+	TxID  []byte
+	Index int
+	Steps []MerkleStep
+}
+
+// Defines merkle hash prefixes
+const (
+	merkleLeafPrefix = byte(0x00)
+	merkleNodePrefix = byte(0x01)
+)
+
+// merkleLeaf hashes a leaf of the tree
+func merkleLeaf(data []byte) []byte {
+	hash := sha256.Sum256(append([]byte{merkleLeafPrefix}, data...))
+
+	return hash[:]
+}
+
+// merkleNode hashes two children into their parent
+func merkleNode(left, right []byte) []byte {
+	data := bytes.Join([][]byte{{merkleNodePrefix}, left, right}, []byte{})
+	hash := sha256.Sum256(data)
+
+	return hash[:]
+}
+
+// NewMerkleTree builds a merkle tree from the data of its leaves
+func NewMerkleTree(data [][]byte) *MerkleTree {
+	var leaves [][]byte
+
+	for _, datum := range data {
+		leaves = append(leaves, merkleLeaf(datum))
+	}
+
+	tree := MerkleTree{[][][]byte{leaves}}
+
+	for level := leaves; len(level) > 1; {
+		var next [][]byte
+
+		for i := 0; i < len(level); i += 2 {
+			if i+1 == len(level) {
+				next = append(next, level[i])
+				continue
+			}
+			next = append(next, merkleNode(level[i], level[i+1]))
+		}
+
+		tree.Levels = append(tree.Levels, next)
+		level = next
+	}
+
+	return &tree
+}
+
+// Root returns the merkle root of the tree
+func (t *MerkleTree) Root() []byte {
+	top := t.Levels[len(t.Levels)-1]
+	if len(top) == 0 {
+		hash := sha256.Sum256([]byte{})
+		return hash[:]
+	}
+
+	return top[0]
+}
+
+// Proof builds the inclusion proof of the leaf at index
+func (t *MerkleTree) Proof(index int) []MerkleStep {
+	var steps []MerkleStep
+
+	for _, level := range t.Levels[:len(t.Levels)-1] {
+		sibling := index ^ 1
+		if sibling < len(level) {
+			steps = append(steps, MerkleStep{level[sibling], sibling < index})
+		}
+		index /= 2
+	}
+
+	return steps
+}
+
+// MerkleProof builds the inclusion proof of a transaction in the block
+func (b *Block) MerkleProof(txID []byte) (*MerkleProof, error) {
+	var txIDs [][]byte
+	index := -1
+
+	for i, tx := range b.Transactions {
+		txIDs = append(txIDs, tx.ID)
+		if bytes.Equal(tx.ID, txID) {
+			index = i
+		}
+	}
+
+	if index < 0 {
+		return nil, fmt.Errorf("%w: %x", ErrTxNotInBlock, txID)
+	}
+
+	tree := NewMerkleTree(txIDs)
+	proof := MerkleProof{txID, index, tree.Proof(index)}
+
+	return &proof, nil
+}
+
+// VerifyMerkleProof checks that the proof leads from its transaction to the root
+func VerifyMerkleProof(root []byte, proof *MerkleProof) bool {
+	hash := merkleLeaf(proof.TxID)
+
+	for _, step := range proof.Steps {
+		if step.Left {
+			hash = merkleNode(step.Hash, hash)
+		} else {
+			hash = merkleNode(hash, step.Hash)
+		}
+	}
+
+	return bytes.Equal(hash, root)
+}
@@ -0,0 +1,113 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// merkleData creates the leaves of a tree of count transactions
+func merkleData(count int) [][]byte {
+	var data [][]byte
+	for i := 0; i < count; i++ {
+		hash := sha256.Sum256([]byte(fmt.Sprintf("tx %d", i)))
+		data = append(data, hash[:])
+	}
+
+	return data
+}
+
+func TestMerkleRoot(t *testing.T) {
+	empty := sha256.Sum256([]byte{})
+	if root := NewMerkleTree(nil).Root(); !bytes.Equal(root, empty[:]) {
+		t.Errorf("empty root %x, want %x", root, empty)
+	}
+
+	data := merkleData(3)
+	if root := NewMerkleTree(data[:1]).Root(); !bytes.Equal(root, merkleLeaf(data[0])) {
+		t.Errorf("root of one leaf %x, want the leaf hash", root)
+	}
+
+	// The last node is carried up rather than paired with itself
+	leaves := [][]byte{merkleLeaf(data[0]), merkleLeaf(data[1]), merkleLeaf(data[2])}
+	want := merkleNode(merkleNode(leaves[0], leaves[1]), leaves[2])
+	if root := NewMerkleTree(data).Root(); !bytes.Equal(root, want) {
+		t.Errorf("root of three leaves %x, want %x", root, want)
+	}
+	duplicated := NewMerkleTree(append(data, data[2])).Root()
+	if bytes.Equal(duplicated, want) {
+		t.Error("repeating the last leaf keeps the root")
+	}
+}
+
+func TestMerkleProofs(t *testing.T) {
+	for count := 1; count <= 9; count++ {
+		data := merkleData(count)
+		tree := NewMerkleTree(data)
+		root := tree.Root()
+
+		for index, txID := range data {
+			proof := &MerkleProof{txID, index, tree.Proof(index)}
+			if !VerifyMerkleProof(root, proof) {
+				t.Errorf("%d leaves: proof of leaf %d does not verify", count, index)
+			}
+
+			other := &MerkleProof{merkleData(count + 1)[count], index, proof.Steps}
+			if VerifyMerkleProof(root, other) {
+				t.Errorf("%d leaves: proof of leaf %d verifies another transaction", count, index)
+			}
+
+			for step := range proof.Steps {
+				flipped := append([]MerkleStep{}, proof.Steps...)
+				flipped[step].Left = !flipped[step].Left
+				if VerifyMerkleProof(root, &MerkleProof{txID, index, flipped}) {
+					t.Errorf("%d leaves: leaf %d verifies with step %d on the other side", count, index, step)
+				}
+
+				tampered := append([]MerkleStep{}, proof.Steps...)
+				tampered[step].Hash = merkleLeaf(tampered[step].Hash)
+				if VerifyMerkleProof(root, &MerkleProof{txID, index, tampered}) {
+					t.Errorf("%d leaves: leaf %d verifies with step %d changed", count, index, step)
+				}
+			}
+		}
+	}
+}
+
+func TestMerkleProofInnerNode(t *testing.T) {
+	data := merkleData(4)
+	tree := NewMerkleTree(data)
+
+	// An inner node with the proof of its parent is not a leaf
+	inner := tree.Levels[1][0]
+	proof := &MerkleProof{inner, 0, []MerkleStep{{tree.Levels[1][1], false}}}
+	if VerifyMerkleProof(tree.Root(), proof) {
+		t.Error("inner node verifies as a transaction")
+	}
+}
+
+func TestBlockMerkleProof(t *testing.T) {
+	c := newTestChain(t)
+	genesis := c.tip()
+	tx := c.spend(genesis.Transactions[0], 0, c.address(), Policy.Subsidy(0))
+	block := c.mine(tx)
+
+	for _, blockTx := range block.Transactions {
+		proof, err := block.MerkleProof(blockTx.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !VerifyMerkleProof(block.Header.MerkleRoot, proof) {
+			t.Errorf("proof of %x does not verify against the header", blockTx.ID)
+		}
+		if VerifyMerkleProof(genesis.Header.MerkleRoot, proof) {
+			t.Errorf("proof of %x verifies against another block", blockTx.ID)
+		}
+	}
+
+	if _, err := block.MerkleProof(genesis.Transactions[0].ID); !errors.Is(err, ErrTxNotInBlock) {
+		t.Errorf("proof of a transaction of another block gave %v, want %v", err, ErrTxNotInBlock)
+	}
+}
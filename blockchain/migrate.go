@@ -0,0 +1,280 @@
+package blockchain
+
+import (
+	"bytes"
+	"digitalWallet/transactions"
+	"digitalWallet/utils"
+	"encoding/gob"
+	"errors"
+)
+
+const (
+	// migrateBatchSize limits how many blocks are converted per batch
+	migrateBatchSize = 1000
+)
+
+// legacyBlock is the block layout used before block headers
+// Header is only set when the stored block already uses the header format
+type legacyBlock struct {
+	Hash         []byte
+	Transactions []*transactions.Transaction
+	PrevHash     []byte
+	Nonce        int
+	Header       *BlockHeader
+}
+
+// decodeLegacyBlock decodes a stored block with the legacy layout
+func decodeLegacyBlock(data []byte) (*legacyBlock, error) {
+	var block legacyBlock
+
+	decoder := gob.NewDecoder(bytes.NewReader(data))
+	err := decoder.Decode(&block)
+
+	return &block, err
+}
+
+// IsLegacyFormat checks if the last block is stored without a header
+func IsLegacyFormat(store ChainStore) (bool, error) {
+	lastHash, err := store.GetTip()
+	if errors.Is(err, ErrChainNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	data, err := store.Get(lastHash)
+	if errors.Is(err, ErrKeyNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if utils.IsBinaryEncoding(data) {
+		return false, nil
+	}
+
+	block, err := decodeLegacyBlock(data)
+	if err != nil {
+		return false, err
+	}
+
+	return block.Header == nil, nil
+}
+
+// MigrateLegacyBlocks rewrites blocks stored without a header
+//
+// Migrated blocks keep their hash and nonce and get LegacyBlockVersion, so
+// their proof of work is still checked against the data they were mined with.
+// Heights follow the last block that already has a header, or the genesis
+// block, timestamps are unknown. Blocks are written oldest first in batches,
+// so an interrupted migration resumes above the blocks it converted.
+func MigrateLegacyBlocks(store ChainStore) (int, error) {
+	var chain []*legacyBlock
+	height := 0
+
+	// Collects the chain from the last block back to genesis or to the first
+	// block with a header
+	hash, err := store.GetTip()
+	if err != nil {
+		return 0, err
+	}
+
+	for len(hash) > 0 {
+		data, err := store.Get(hash)
+		if err != nil {
+			return 0, err
+		}
+
+		// Converted blocks are stored in the binary encoding
+		if utils.IsBinaryEncoding(data) {
+			converted, err := decodeBlock(data)
+			if err != nil {
+				return 0, err
+			}
+			height = converted.Header.Height + 1
+			break
+		}
+
+		block, err := decodeLegacyBlock(data)
+		if err != nil {
+			return 0, err
+		}
+		if block.Header != nil {
+			height = block.Header.Height + 1
+			break
+		}
+
+		chain = append(chain, block)
+		hash = block.PrevHash
+	}
+
+	// Puts the oldest block first
+	for i, j := 0, len(chain)-1; i < j; i, j = i+1, j-1 {
+		chain[i], chain[j] = chain[j], chain[i]
+	}
+
+	for start := 0; start < len(chain); start += migrateBatchSize {
+		end := start + migrateBatchSize
+		if end > len(chain) {
+			end = len(chain)
+		}
+
+		err := store.Update(func(batch Batch) error {
+			for i := start; i < end; i++ {
+				legacy := chain[i]
+				block := Block{Hash: legacy.Hash, Transactions: legacy.Transactions}
+				block.Header = BlockHeader{
+					Version:  LegacyBlockVersion,
+					Height:   height + i,
+					PrevHash: legacy.PrevHash,
+					Bits:     LegacyDifficulty,
+					Nonce:    legacy.Nonce,
+				}
+				block.Header.MerkleRoot = block.HashTransactions()
+
+				if err := batch.PutBlock(&block); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return len(chain), nil
+}
+
+// MigrateGobBlocks rewrites blocks and unspent outputs stored with gob in
+// the binary encoding
+//
+// Blocks keep their hash, version and transaction IDs. The blocks of the
+// main chain and of every stored branch are converted, and data already in
+// the binary encoding is left as it is.
+func MigrateGobBlocks(store ChainStore) (int, error) {
+	var hashes [][]byte
+
+	if err := migrateGobOutputs(store); err != nil {
+		return 0, err
+	}
+
+	// Collects the main chain, which older stores have no work for
+	hash, err := store.GetTip()
+	if err != nil {
+		return 0, err
+	}
+	for len(hash) > 0 {
+		data, err := store.Get(hash)
+		if err != nil {
+			return 0, err
+		}
+
+		var block *Block
+		if utils.IsBinaryEncoding(data) {
+			block, err = decodeBlock(data)
+		} else {
+			block, err = decodeGobBlock(data)
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		hashes = append(hashes, hash)
+		hash = block.Header.PrevHash
+	}
+
+	// Collects the blocks of other branches by their cumulative work
+	// Blocks of the main chain are listed again and skipped once converted
+	err = store.Iterate(workPrefix, func(key, value []byte) error {
+		hashes = append(hashes, append([]byte{}, key[len(workPrefix):]...))
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	converted := 0
+	for start := 0; start < len(hashes); start += migrateBatchSize {
+		end := start + migrateBatchSize
+		if end > len(hashes) {
+			end = len(hashes)
+		}
+
+		err := store.Update(func(batch Batch) error {
+			for _, hash := range hashes[start:end] {
+				data, err := batch.Get(hash)
+				if err != nil {
+					return err
+				}
+				if utils.IsBinaryEncoding(data) {
+					continue
+				}
+
+				block, err := decodeGobBlock(data)
+				if err != nil {
+					return err
+				}
+				if err := batch.PutBlock(block); err != nil {
+					return err
+				}
+				converted++
+			}
+			return nil
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return converted, nil
+}
+
+// migrateGobOutputs rewrites the unspent outputs stored with gob
+func migrateGobOutputs(store ChainStore) error {
+	outputs := make(map[string]transactions.TxOutput)
+
+	err := store.Iterate(utxoAddrPrefix, func(key, value []byte) error {
+		if utils.IsBinaryEncoding(value) {
+			return nil
+		}
+
+		var out transactions.TxOutput
+		if err := gob.NewDecoder(bytes.NewReader(value)).Decode(&out); err != nil {
+			return err
+		}
+		outputs[string(key)] = out
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Writes the outputs in batches small enough for a single transaction
+	var keys []string
+	for key := range outputs {
+		keys = append(keys, key)
+	}
+
+	for start := 0; start < len(keys); start += reindexBatchSize {
+		end := start + reindexBatchSize
+		if end > len(keys) {
+			end = len(keys)
+		}
+
+		err := store.Update(func(batch Batch) error {
+			for _, key := range keys[start:end] {
+				if err := batch.Set([]byte(key), outputs[key].Serialize()); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,328 @@
+package blockchain
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"digitalWallet/transactions"
+	"digitalWallet/utils"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// limitedStore is a memory store refusing updates with more writes than a
+// Badger transaction would take
+type limitedStore struct {
+	*MemoryStore
+	limit int
+}
+
+// countingBatch counts the writes of an update
+type countingBatch struct {
+	Batch
+	writes int
+}
+
+func (b *countingBatch) PutBlock(block *Block) error {
+	b.writes++
+	return b.Batch.PutBlock(block)
+}
+
+func (b *countingBatch) SetTip(hash []byte) error {
+	b.writes++
+	return b.Batch.SetTip(hash)
+}
+
+func (b *countingBatch) Set(key, value []byte) error {
+	b.writes++
+	return b.Batch.Set(key, value)
+}
+
+func (b *countingBatch) Delete(key []byte) error {
+	b.writes++
+	return b.Batch.Delete(key)
+}
+
+func (s *limitedStore) Update(fn func(batch Batch) error) error {
+	return s.MemoryStore.Update(func(batch Batch) error {
+		counting := &countingBatch{Batch: batch}
+		if err := fn(counting); err != nil {
+			return err
+		}
+		if counting.writes > s.limit {
+			return fmt.Errorf("update of %d writes, limit %d", counting.writes, s.limit)
+		}
+		return nil
+	})
+}
+
+// putGob stores a value encoded with gob
+func putGob(t *testing.T, store ChainStore, key []byte, value interface{}) {
+	t.Helper()
+
+	var data bytes.Buffer
+	if err := gob.NewEncoder(&data).Encode(value); err != nil {
+		t.Fatal(err)
+	}
+	err := store.Update(func(batch Batch) error {
+		return batch.Set(key, data.Bytes())
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// setTip stores the tip
+func setTip(t *testing.T, store ChainStore, hash []byte) {
+	t.Helper()
+
+	if err := store.Update(func(batch Batch) error { return batch.SetTip(hash) }); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// addLegacyBlocks stores count blocks without a header on top of prev,
+// mined over their legacy data when mine is set, and returns their hashes
+func addLegacyBlocks(t *testing.T, store ChainStore, prev []byte, count int, address string, mine bool) [][]byte {
+	t.Helper()
+
+	var hashes [][]byte
+	for i := 0; i < count; i++ {
+		coinbase, err := transactions.CoinbaseTxn(address, fmt.Sprintf("legacy %x %d", prev, i), Policy.Subsidy(0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		coinbase.Version = transactions.LegacyTxVersion
+		coinbase.SetID()
+
+		block := &Block{Transactions: []*transactions.Transaction{coinbase}}
+		block.Header = BlockHeader{Version: LegacyBlockVersion, PrevHash: prev, Bits: LegacyDifficulty}
+
+		legacy := legacyBlock{Transactions: block.Transactions, PrevHash: prev}
+		if mine {
+			legacy.Nonce, legacy.Hash, err = NewProofOfWork(block).Mine(context.Background(), Miner{Workers: 1})
+			if err != nil {
+				t.Fatal(err)
+			}
+		} else {
+			hash := sha256.Sum256(coinbase.ID)
+			legacy.Hash = hash[:]
+		}
+
+		putGob(t, store, legacy.Hash, legacy)
+		hashes = append(hashes, legacy.Hash)
+		prev = legacy.Hash
+	}
+	setTip(t, store, prev)
+
+	return hashes
+}
+
+// setStoredSchema stores a schema version
+func setStoredSchema(t *testing.T, store ChainStore, version int) {
+	t.Helper()
+
+	if err := store.Update(func(batch Batch) error { return setSchemaVersion(batch, version) }); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMigrateLegacyChain(t *testing.T) {
+	c := newTestChain(t)
+	store := NewMemoryStore()
+	hashes := addLegacyBlocks(t, store, nil, 3, c.address(), true)
+
+	legacy, err := IsLegacyFormat(store)
+	if err != nil || !legacy {
+		t.Fatalf("IsLegacyFormat() = %v, %v, want true", legacy, err)
+	}
+	if _, err := ContinueBlockChain(store); !errors.Is(err, ErrSchemaOutdated) {
+		t.Fatalf("opening a legacy store gave %v, want %v", err, ErrSchemaOutdated)
+	}
+
+	var steps []int
+	ran, err := Migrate(store, func(m Migration) { steps = append(steps, m.Version) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ran != len(migrations) || len(steps) != len(migrations) {
+		t.Errorf("ran %d migrations with steps %v, want %d", ran, steps, len(migrations))
+	}
+
+	chain, err := ContinueBlockChain(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.BlockChain = chain
+
+	for height, hash := range hashes {
+		block := c.block(hash)
+		if block.Header.Height != height || block.Header.Version != LegacyBlockVersion {
+			t.Errorf("block %x has height %d and version %d, want %d and %d",
+				hash, block.Header.Height, block.Header.Version, height, LegacyBlockVersion)
+		}
+		if byHeight, err := c.GetBlockByHeight(height); err != nil || !bytes.Equal(byHeight.Hash, hash) {
+			t.Errorf("height %d is %v, %v", height, byHeight, err)
+		}
+	}
+	if checked, err := c.Verify(VerifyOptions{}); err != nil || checked != len(hashes) {
+		t.Fatalf("Verify() = %d, %v", checked, err)
+	}
+	c.checkUnspent()
+
+	// Migrated stores are left alone
+	if ran, err := Migrate(store, nil); err != nil || ran != 0 {
+		t.Errorf("Migrate() again = %d, %v", ran, err)
+	}
+}
+
+func TestMigrateLegacyBlocksResumes(t *testing.T) {
+	store := &limitedStore{NewMemoryStore(), migrateBatchSize}
+	address := newTestChain(t).address()
+	const first, second = migrateBatchSize + 200, migrateBatchSize + 300
+
+	// A first run converts the blocks stored so far
+	hashes := addLegacyBlocks(t, store, nil, first, address, false)
+	migrated, err := MigrateLegacyBlocks(store)
+	if err != nil || migrated != first {
+		t.Fatalf("MigrateLegacyBlocks() = %d, %v, want %d", migrated, err, first)
+	}
+
+	// Blocks stored without a header on top of them are numbered after them
+	hashes = append(hashes, addLegacyBlocks(t, store, hashes[len(hashes)-1], second, address, false)...)
+	migrated, err = MigrateLegacyBlocks(store)
+	if err != nil || migrated != second {
+		t.Fatalf("MigrateLegacyBlocks() = %d, %v, want %d", migrated, err, second)
+	}
+
+	var prev []byte
+	for height, hash := range hashes {
+		block, err := store.GetBlock(hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if block.Header.Height != height || !bytes.Equal(block.Header.PrevHash, prev) {
+			t.Fatalf("block %x has height %d and parent %x, want %d and %x",
+				hash, block.Header.Height, block.Header.PrevHash, height, prev)
+		}
+		prev = hash
+	}
+
+	if legacy, err := IsLegacyFormat(store); err != nil || legacy {
+		t.Errorf("IsLegacyFormat() = %v, %v after migrating", legacy, err)
+	}
+}
+
+func TestMigrateGobBlocks(t *testing.T) {
+	c := newTestChain(t)
+	genesis := c.tip()
+	main1 := c.mine(c.spend(genesis.Transactions[0], 0, c.address(), Policy.Subsidy(0)-1))
+	main2 := c.mine()
+	fork2 := c.mineOn(main1, "fork", 0)
+	c.accept(fork2)
+
+	// Stores every block and output the way older binaries did
+	blocks := []*Block{genesis, main1, main2, fork2}
+	for _, block := range blocks {
+		putGob(t, c.Store, block.Hash, block)
+	}
+	outputs := 0
+	err := c.Store.Iterate(utxoAddrPrefix, func(key, value []byte) error {
+		out, err := transactions.DeserializeOutput(value)
+		if err != nil {
+			return err
+		}
+		putGob(t, c.Store, key, out)
+		outputs++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if outputs == 0 {
+		t.Fatal("no outputs to convert")
+	}
+
+	converted, err := MigrateGobBlocks(c.Store)
+	if err != nil || converted != len(blocks) {
+		t.Fatalf("MigrateGobBlocks() = %d, %v, want %d", converted, err, len(blocks))
+	}
+
+	for _, block := range blocks {
+		data, err := c.Store.Get(block.Hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, block.Serialize()) {
+			t.Errorf("block %x was not converted to the binary encoding", block.Hash)
+		}
+	}
+	err = c.Store.Iterate(utxoAddrPrefix, func(key, value []byte) error {
+		if !utils.IsBinaryEncoding(value) {
+			t.Errorf("output %x was not converted to the binary encoding", key)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.checkUnspent()
+	if _, err := c.Verify(VerifyOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if converted, err := MigrateGobBlocks(c.Store); err != nil || converted != 0 {
+		t.Errorf("MigrateGobBlocks() again = %d, %v", converted, err)
+	}
+}
+
+func TestSchemaVersion(t *testing.T) {
+	c := newTestChain(t)
+
+	if version, err := GetSchemaVersion(c.Store); err != nil || version != SchemaVersion {
+		t.Fatalf("new store has version %d, %v, want %d", version, err, SchemaVersion)
+	}
+	if _, err := ContinueBlockChain(c.Store); err != nil {
+		t.Fatal(err)
+	}
+
+	// Stores written by newer binaries are refused, even by migrations
+	setStoredSchema(t, c.Store, SchemaVersion+1)
+	if _, err := ContinueBlockChain(c.Store); !errors.Is(err, ErrSchemaTooNew) {
+		t.Errorf("opening a newer store gave %v, want %v", err, ErrSchemaTooNew)
+	}
+	if _, err := Migrate(c.Store, nil); !errors.Is(err, ErrSchemaTooNew) {
+		t.Errorf("migrating a newer store gave %v, want %v", err, ErrSchemaTooNew)
+	}
+
+	// Older stores must be migrated first
+	setStoredSchema(t, c.Store, SchemaVersion-1)
+	if _, err := ContinueBlockChain(c.Store); !errors.Is(err, ErrSchemaOutdated) {
+		t.Errorf("opening an older store gave %v, want %v", err, ErrSchemaOutdated)
+	}
+	if ran, err := Migrate(c.Store, nil); err != nil || ran != 1 {
+		t.Errorf("Migrate() = %d, %v, want 1", ran, err)
+	}
+	if _, err := ContinueBlockChain(c.Store); err != nil {
+		t.Error(err)
+	}
+
+	err := c.Store.Update(func(batch Batch) error {
+		return batch.Set(schemaKey, []byte{1, 2, 3})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ContinueBlockChain(c.Store); !errors.Is(err, ErrSchemaCorrupt) {
+		t.Errorf("opening a store with a corrupt version gave %v, want %v", err, ErrSchemaCorrupt)
+	}
+
+	if got := Migrations(0); len(got) != len(migrations) || got[0].Version != 1 {
+		t.Errorf("Migrations(0) = %v", got)
+	}
+	if got := Migrations(SchemaVersion); len(got) != 0 {
+		t.Errorf("Migrations(%d) = %v", SchemaVersion, got)
+	}
+}
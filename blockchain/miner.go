@@ -0,0 +1,171 @@
+package blockchain
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"math"
+	"math/big"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Miner configures how proof of work is searched
+type Miner struct {
+	// Workers is the number of goroutines searching the nonce space
+	Workers int
+
+	// OnHashrate is called every ReportInterval with the hashes per second
+	OnHashrate func(hashesPerSecond float64)
+
+	// ReportInterval is how often OnHashrate is called
+	ReportInterval time.Duration
+
+	// Address receives the reward and the fees of mined blocks
+	Address string
+}
+
+var (
+	// ErrNonceSpaceExhausted is returned when no nonce satisfies the target
+	ErrNonceSpaceExhausted = errors.New("nonce space exhausted")
+
+	// ErrNoMinerAddress is returned when mining without a reward address
+	ErrNoMinerAddress = errors.New("miner address is not set")
+)
+
+// DefaultMiner returns a miner using one worker per CPU
+func DefaultMiner() Miner {
+	return Miner{
+		Workers:        runtime.NumCPU(),
+		ReportInterval: time.Second,
+	}
+}
+
+// checkInterval is how many hashes a worker makes between checks for
+// cancellation and updates of the hash count
+const checkInterval = 1024
+
+// solution is a nonce found by a worker
+type solution struct {
+	nonce int
+	hash  []byte
+}
+
+// Mine searches for a nonce whose header hash is below the target
+//
+// Worker i tries the nonces i, i+Workers, i+2*Workers and so on. All workers
+// stop as soon as one of them finds a solution or ctx is cancelled, in which
+// case the context error is returned.
+func (pow *ProofOfWork) Mine(ctx context.Context, m Miner) (int, []byte, error) {
+	if pow.Target.Sign() == 0 {
+		return 0, nil, ErrBadBits
+	}
+
+	workers := m.Workers
+	if workers < 1 {
+		workers = 1
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var hashes uint64
+	found := make(chan solution, 1)
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(start int) {
+			defer wg.Done()
+			pow.work(ctx, start, workers, &hashes, found)
+		}(i)
+	}
+
+	if m.OnHashrate != nil {
+		go reportHashrate(ctx, m, &hashes)
+	}
+
+	// Closes found once every worker gave up
+	go func() {
+		wg.Wait()
+		close(found)
+	}()
+
+	select {
+	case s, ok := <-found:
+		if !ok {
+			if ctx.Err() != nil {
+				return 0, nil, ctx.Err()
+			}
+			return 0, nil, ErrNonceSpaceExhausted
+		}
+		return s.nonce, s.hash, nil
+	case <-ctx.Done():
+		return 0, nil, ctx.Err()
+	}
+}
+
+// work tries every step-th nonce from start until a solution is found
+// Hashes are counted locally and added to hashes every checkInterval hashes
+// so that workers do not contend on the shared counter
+func (pow *ProofOfWork) work(ctx context.Context, start, step int, hashes *uint64, found chan<- solution) {
+	var intHash big.Int
+
+	var counted uint64
+	defer func() {
+		atomic.AddUint64(hashes, counted)
+	}()
+
+	for i, nonce := 0, start; nonce < math.MaxInt64-step; i, nonce = i+1, nonce+step {
+		// Checks for cancellation without slowing down every hash
+		if i%checkInterval == 0 {
+			atomic.AddUint64(hashes, counted)
+			counted = 0
+
+			select {
+			case <-ctx.Done():
+				return
+			default:
+			}
+		}
+
+		hash := sha256.Sum256(pow.InitNonce(nonce))
+		counted++
+
+		intHash.SetBytes(hash[:])
+		if intHash.Cmp(pow.Target) == -1 {
+			select {
+			case found <- solution{nonce, hash[:]}:
+			default:
+			}
+			return
+		}
+	}
+}
+
+// reportHashrate calls OnHashrate until ctx is done
+func reportHashrate(ctx context.Context, m Miner, hashes *uint64) {
+	interval := m.ReportInterval
+	if interval <= 0 {
+		interval = time.Second
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	last := time.Now()
+	var lastHashes uint64
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			total := atomic.LoadUint64(hashes)
+			m.OnHashrate(float64(total-lastHashes) / now.Sub(last).Seconds())
+			last, lastHashes = now, total
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package blockchain
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"math/big"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// powBlock creates an unmined block header of the difficulty
+func powBlock(bits int) *Block {
+	return &Block{Header: BlockHeader{
+		Version:    BlockVersion,
+		Timestamp:  time.Now().Unix(),
+		Height:     1,
+		PrevHash:   bytes.Repeat([]byte{1}, 32),
+		MerkleRoot: bytes.Repeat([]byte{2}, 32),
+		Bits:       bits,
+	}}
+}
+
+// waitGoroutines waits for the number of goroutines to drop to want
+func waitGoroutines(t *testing.T, want int) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > want {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d goroutines are left running, want %d", runtime.NumGoroutine(), want)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestMine(t *testing.T) {
+	for _, workers := range []int{0, 1, 4} {
+		pow := NewProofOfWork(powBlock(10))
+		nonce, hash, err := pow.Mine(context.Background(), Miner{Workers: workers})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		sum := sha256.Sum256(pow.InitNonce(nonce))
+		if !bytes.Equal(hash, sum[:]) || new(big.Int).SetBytes(hash).Cmp(pow.Target) >= 0 {
+			t.Errorf("%d workers found nonce %d with hash %x above the target", workers, nonce, hash)
+		}
+	}
+
+	for _, bits := range []int{0, -1, hashBits} {
+		if _, _, err := NewProofOfWork(powBlock(bits)).Mine(context.Background(), Miner{}); !errors.Is(err, ErrBadBits) {
+			t.Errorf("bits %d gave %v, want %v", bits, err, ErrBadBits)
+		}
+	}
+}
+
+func TestMineCancel(t *testing.T) {
+	before := runtime.NumGoroutine()
+
+	// No nonce is below a target this low
+	pow := NewProofOfWork(powBlock(hashBits - 1))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	start := time.Now()
+	if _, _, err := pow.Mine(ctx, Miner{Workers: 4}); !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled mining gave %v, want %v", err, context.Canceled)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("mining stopped %v after being cancelled", elapsed)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, _, err := pow.Mine(ctx, Miner{Workers: 2}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("mining past the deadline gave %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	// Every worker stops with the search
+	waitGoroutines(t, before)
+}
+
+func TestMineReportsHashrate(t *testing.T) {
+	var reports, zero int32
+	m := Miner{
+		Workers:        2,
+		ReportInterval: 5 * time.Millisecond,
+		OnHashrate: func(rate float64) {
+			atomic.AddInt32(&reports, 1)
+			if rate <= 0 {
+				atomic.AddInt32(&zero, 1)
+			}
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, _, err := NewProofOfWork(powBlock(hashBits-1)).Mine(ctx, m); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Mine() gave %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	if atomic.LoadInt32(&reports) == 0 {
+		t.Error("no hash rate was reported")
+	}
+	if n := atomic.LoadInt32(&zero); n == atomic.LoadInt32(&reports) {
+		t.Errorf("%d reports counted no hashes", n)
+	}
+}
+
+func TestMineBlockCancel(t *testing.T) {
+	c := newTestChain(t)
+	genesis := c.tip()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, _, err := c.MineBlock(ctx, nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled MineBlock gave %v, want %v", err, context.Canceled)
+	}
+	c.checkTip(genesis)
+	c.checkUnspent()
+}
@@ -0,0 +1,151 @@
+package blockchain
+
+// MonetaryPolicy defines how many coins every block may mint
+type MonetaryPolicy struct {
+	// InitialSubsidy is the reward of the first blocks
+	InitialSubsidy int
+
+	// HalvingInterval is the number of blocks between two halvings of the
+	// subsidy, 0 never halves it
+	HalvingInterval int
+
+	// MaxSupply caps the coins minted by all blocks together
+	MaxSupply int
+}
+
+// DefaultPolicy returns the default monetary policy
+func DefaultPolicy() MonetaryPolicy {
+	return MonetaryPolicy{
+		InitialSubsidy:  100,
+		HalvingInterval: 1000,
+		MaxSupply:       200000,
+	}
+}
+
+var (
+	// Policy holds the monetary policy used by the chain
+	Policy = DefaultPolicy()
+)
+
+// Supply describes the coins minted by the chain
+type Supply struct {
+	// Height is the height of the last block
+	Height int
+
+	// Minted is the sum of the coinbases minus the fees they collected
+	Minted int
+
+	// Subsidy is the reward of the next block
+	Subsidy int
+
+	// NextHalving is the height at which the subsidy halves next, -1 if never
+	NextHalving int
+}
+
+// scheduledSubsidy is the halved subsidy at height, ignoring the max supply
+func (p MonetaryPolicy) scheduledSubsidy(height int) int {
+	if p.HalvingInterval <= 0 {
+		return p.InitialSubsidy
+	}
+
+	halvings := height / p.HalvingInterval
+	if halvings >= 63 {
+		return 0
+	}
+
+	return p.InitialSubsidy >> uint(halvings)
+}
+
+// MintedBefore is the sum of the subsidies of the blocks below height
+func (p MonetaryPolicy) MintedBefore(height int) int {
+	minted := 0
+
+	// Adds up whole halving eras, the subsidy is constant within each
+	for start := 0; start < height; {
+		subsidy := p.scheduledSubsidy(start)
+		if subsidy == 0 {
+			break
+		}
+
+		end := height
+		if p.HalvingInterval > 0 && start+p.HalvingInterval-start%p.HalvingInterval < end {
+			end = start + p.HalvingInterval - start%p.HalvingInterval
+		}
+
+		minted += subsidy * (end - start)
+		if minted >= p.MaxSupply {
+			return p.MaxSupply
+		}
+		start = end
+	}
+
+	return minted
+}
+
+// Subsidy is the number of coins the block at height may mint
+// It halves every HalvingInterval blocks and never exceeds what is left
+// of MaxSupply
+func (p MonetaryPolicy) Subsidy(height int) int {
+	subsidy := p.scheduledSubsidy(height)
+
+	if left := p.MaxSupply - p.MintedBefore(height); subsidy > left {
+		subsidy = left
+	}
+	if subsidy < 0 {
+		subsidy = 0
+	}
+
+	return subsidy
+}
+
+// NextHalving is the height of the first halving after height
+// It is -1 once the subsidy has run out or when it never halves
+func (p MonetaryPolicy) NextHalving(height int) int {
+	if p.HalvingInterval <= 0 || p.Subsidy(height) == 0 {
+		return -1
+	}
+
+	return (height/p.HalvingInterval + 1) * p.HalvingInterval
+}
+
+// Supply replays the chain and reports the coins minted so far
+//
+// Invalid transactions are skipped, verifychain reports them.
+func (c *BlockChain) Supply() (Supply, error) {
+	hashes, err := c.chainHashes()
+	if err != nil {
+		return Supply{}, err
+	}
+
+	state := newChainState()
+	minted := 0
+
+	for _, hash := range hashes {
+		block, err := c.rawBlock(hash)
+		if err != nil {
+			return Supply{}, err
+		}
+
+		fees := 0
+		for i, tx := range block.Transactions {
+			fee, err := state.apply(tx, i, false)
+			if err != nil {
+				continue
+			}
+			fees += fee
+		}
+
+		if len(block.Transactions) > 0 && block.Transactions[0].IsCoinbase() {
+			minted += block.Transactions[0].OutputValue() - fees
+		}
+	}
+
+	height := len(hashes) - 1
+
+	return Supply{
+		Height:      height,
+		Minted:      minted,
+		Subsidy:     Policy.Subsidy(height + 1),
+		NextHalving: Policy.NextHalving(height + 1),
+	}, nil
+}
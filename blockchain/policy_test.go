@@ -0,0 +1,98 @@
+package blockchain
+
+import (
+	"math"
+	"testing"
+)
+
+// testPolicy halves every 10 blocks and runs out of coins in the fourth era
+var testPolicy = MonetaryPolicy{InitialSubsidy: 100, HalvingInterval: 10, MaxSupply: 1790}
+
+func TestSubsidy(t *testing.T) {
+	tests := []struct {
+		height      int
+		subsidy     int
+		mintedAfter int
+		nextHalving int
+	}{
+		{0, 100, 100, 10},
+		{9, 100, 1000, 10},
+		{10, 50, 1050, 20},
+		{19, 50, 1500, 20},
+		{20, 25, 1525, 30},
+		{29, 25, 1750, 30},
+		{30, 12, 1762, 40},
+		{32, 12, 1786, 40},
+		{33, 4, 1790, 40},
+		{34, 0, 1790, -1},
+		{1000, 0, 1790, -1},
+	}
+
+	for _, test := range tests {
+		if got := testPolicy.Subsidy(test.height); got != test.subsidy {
+			t.Errorf("Subsidy(%d) = %d, want %d", test.height, got, test.subsidy)
+		}
+		if got := testPolicy.MintedBefore(test.height + 1); got != test.mintedAfter {
+			t.Errorf("MintedBefore(%d) = %d, want %d", test.height+1, got, test.mintedAfter)
+		}
+		if got := testPolicy.NextHalving(test.height); got != test.nextHalving {
+			t.Errorf("NextHalving(%d) = %d, want %d", test.height, got, test.nextHalving)
+		}
+	}
+
+	// The subsidies add up to what was minted
+	minted := 0
+	for height := 0; height < 50; height++ {
+		if got := testPolicy.MintedBefore(height); got != minted {
+			t.Errorf("MintedBefore(%d) = %d, want %d", height, got, minted)
+		}
+		minted += testPolicy.Subsidy(height)
+	}
+}
+
+func TestSubsidyWithoutHalving(t *testing.T) {
+	policy := MonetaryPolicy{InitialSubsidy: 100, MaxSupply: 250}
+
+	for height, want := range []int{100, 100, 50, 0, 0} {
+		if got := policy.Subsidy(height); got != want {
+			t.Errorf("Subsidy(%d) = %d, want %d", height, got, want)
+		}
+	}
+	if got := policy.NextHalving(0); got != -1 {
+		t.Errorf("NextHalving(0) = %d, want -1", got)
+	}
+}
+
+func TestSubsidyRunsOut(t *testing.T) {
+	// Halving every block leaves nothing after 63 halvings, without
+	// overflowing the sum
+	policy := MonetaryPolicy{InitialSubsidy: 1 << 62, HalvingInterval: 1, MaxSupply: math.MaxInt64}
+
+	if got := policy.Subsidy(62); got != 1 {
+		t.Errorf("Subsidy(62) = %d, want 1", got)
+	}
+	if got := policy.Subsidy(63); got != 0 {
+		t.Errorf("Subsidy(63) = %d, want 0", got)
+	}
+	if got := policy.MintedBefore(1000); got != math.MaxInt64 {
+		t.Errorf("MintedBefore(1000) = %d, want %d", got, int64(math.MaxInt64))
+	}
+}
+
+func TestSupply(t *testing.T) {
+	c := newTestChain(t)
+	genesis := c.tip()
+
+	// Fees are collected again by the coinbase and not minted
+	c.mine(c.spend(genesis.Transactions[0], 0, c.address(), Policy.Subsidy(0)-7))
+	c.mine()
+
+	supply, err := c.Supply()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Supply{Height: 2, Minted: Policy.MintedBefore(3), Subsidy: Policy.Subsidy(3), NextHalving: Policy.HalvingInterval}
+	if supply != want {
+		t.Errorf("Supply() = %+v, want %+v", supply, want)
+	}
+}
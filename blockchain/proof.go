@@ -2,10 +2,9 @@ package blockchain
 
 import (
 	"bytes"
+	"context"
 	"crypto/sha256"
 	"digitalWallet/utils"
-	"fmt"
-	"math"
 	"math/big"
 )
 
@@ -17,13 +16,21 @@ type ProofOfWork struct {
 
 // Defines constants
 const (
-	Difficulty = 12
+	// LegacyDifficulty is the difficulty every block had before retargeting
+	LegacyDifficulty = 12
+
+	// hashBits is the size of block hashes, difficulty bits must be below it
+	hashBits = 256
 )
 
 // NewProofOfWork initializes ProofOfWork struct
+// The target is taken from the difficulty bits of the block header. Headers
+// are not trusted, so bits out of range get a zero target no hash is below.
 func NewProofOfWork(b *Block) *ProofOfWork {
-	target := big.NewInt(1)
-	target.Lsh(target, uint(256-Difficulty))
+	target := new(big.Int)
+	if bits := b.Header.Bits; bits > 0 && bits < hashBits {
+		target.Lsh(big.NewInt(1), uint(hashBits-bits))
+	}
 
 	pow := &ProofOfWork{b, target}
 
@@ -31,60 +38,85 @@ func NewProofOfWork(b *Block) *ProofOfWork {
 }
 
 // InitNonce initiates nonce
+// It returns the block header with the nonce applied, ready to be hashed
 func (pow *ProofOfWork) InitNonce(nonce int) []byte {
+	header := pow.Block.Header
+
+	// Legacy blocks were mined over their previous hash and transactions only
+	if header.Version == LegacyBlockVersion {
+		return bytes.Join(
+			[][]byte{
+				header.PrevHash,
+				pow.Block.legacyHashTransactions(),
+				utils.ToHex(int64(nonce)),
+				utils.ToHex(int64(LegacyDifficulty))},
+			[]byte{},
+		)
+	}
+
+	// Newer blocks are mined over the binary encoding of their header
+	if header.Version >= BinaryBlockVersion {
+		header.Nonce = nonce
+		return header.Serialize()
+	}
 
 	data := bytes.Join(
 		[][]byte{
-			pow.Block.PrevHash,
-			pow.Block.HashTransactions(),
-			utils.ToHex(int64(nonce)),
-			utils.ToHex(int64(Difficulty))},
+			utils.ToHex(int64(header.Version)),
+			utils.ToHex(header.Timestamp),
+			utils.ToHex(int64(header.Height)),
+			header.PrevHash,
+			header.MerkleRoot,
+			utils.ToHex(int64(header.Bits)),
+			utils.ToHex(int64(nonce))},
 		[]byte{},
 	)
 
 	return data
 }
 
-// RunPoW runs Proof of Work algorithm
-func (pow *ProofOfWork) RunPoW() (int, []byte) {
+// RunPoW runs Proof of Work algorithm on every CPU until a nonce is found
+func (pow *ProofOfWork) RunPoW() (int, []byte, error) {
+	return pow.Mine(context.Background(), DefaultMiner())
+}
 
+// Validates Proof of Work algorithm
+// The block hash must match its header and be below the target, and the
+// difficulty bits must follow the retarget rule of the chain
+func (pow *ProofOfWork) Validate(c *BlockChain) bool {
 	var intHash big.Int
-	var hash [32]byte
-
-	nonce := 0
-
-	// This essentially is an infinite loop
-	// Due to how large MaxInt64 is
 
-	for nonce < math.MaxInt64 {
-		data := pow.InitNonce(nonce)
-		hash = sha256.Sum256(data)
-
-		fmt.Printf("\r%x", hash)
-		intHash.SetBytes(hash[:])
-
-		if intHash.Cmp(pow.Target) == -1 {
-			break
-		} else {
-			nonce++
-		}
+	if pow.Block.Header.Bits != pow.expectedBits(c) {
+		return false
 	}
 
-	fmt.Println()
+	data := pow.InitNonce(pow.Block.Header.Nonce)
 
-	return nonce, hash[:]
+	hash := sha256.Sum256(data)
 
-}
+	intHash.SetBytes(hash[:])
 
-// Validates Proof of Work algorithm
-func (pow *ProofOfWork) Validate() bool {
-	var intHash big.Int
+	return bytes.Equal(hash[:], pow.Block.Hash) && intHash.Cmp(pow.Target) == -1
+}
 
-	data := pow.InitNonce(pow.Block.Nonce)
+// expectedBits computes the difficulty the block should have been mined at
+func (pow *ProofOfWork) expectedBits(c *BlockChain) int {
+	if pow.Block.Header.Version == LegacyBlockVersion {
+		return LegacyDifficulty
+	}
+	if pow.Block.IsGenesis() {
+		return Params.InitialBits
+	}
 
-	hash := sha256.Sum256(data)
+	prev, err := c.GetBlock(pow.Block.Header.PrevHash)
+	if err != nil {
+		return -1
+	}
 
-	intHash.SetBytes(hash[:])
+	bits, err := c.NextBits(prev)
+	if err != nil {
+		return -1
+	}
 
-	return intHash.Cmp(pow.Target) == -1
+	return bits
 }
@@ -0,0 +1,489 @@
+package blockchain
+
+import (
+	"bytes"
+	"digitalWallet/transactions"
+	"digitalWallet/utils"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// ChainUpdate describes how accepting a block changed the main chain
+type ChainUpdate struct {
+	// Disconnected holds the blocks removed from the main chain, tip first
+	Disconnected []*Block
+
+	// Connected holds the blocks added to the main chain, oldest first
+	Connected []*Block
+}
+
+// Defines block index keys
+var (
+	// workPrefix keys the cumulative work of a block by its hash
+	workPrefix = []byte("work-")
+
+	// undoPrefix keys the outputs spent by a block by its hash
+	undoPrefix = []byte("undo-")
+)
+
+// Defines block acceptance errors
+var (
+	// ErrBlockExists is returned when a block is accepted twice
+	ErrBlockExists = errors.New("block is already stored")
+
+	// ErrOrphanBlock is returned when the parent of a block is unknown
+	ErrOrphanBlock = errors.New("parent block is unknown")
+)
+
+// workKey builds the key of the cumulative work of a block
+func workKey(hash []byte) []byte {
+	return bytes.Join([][]byte{workPrefix, hash}, []byte{})
+}
+
+// undoKey builds the key of the outputs spent by a block
+func undoKey(hash []byte) []byte {
+	return bytes.Join([][]byte{undoPrefix, hash}, []byte{})
+}
+
+// blockWork is the expected number of hashes needed to mine a block at bits
+func blockWork(bits int) *big.Int {
+	return new(big.Int).Lsh(big.NewInt(1), uint(bits))
+}
+
+// CumulativeWork gets the work of a block and all of its ancestors
+func (c *BlockChain) CumulativeWork(hash []byte) (*big.Int, error) {
+	data, err := c.Store.Get(workKey(hash))
+	if errors.Is(err, ErrKeyNotFound) {
+		return nil, fmt.Errorf("%w: %x", ErrBlockNotFound, hash)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return new(big.Int).SetBytes(data), nil
+}
+
+// indexWork stores the cumulative work of the main chain
+// Chains stored before forks were supported are indexed once
+func (c *BlockChain) indexWork() error {
+	if _, err := c.CumulativeWork(c.LastHash); err == nil {
+		return nil
+	}
+
+	hashes, err := c.chainHashes()
+	if err != nil {
+		return err
+	}
+
+	works := make([][]byte, len(hashes))
+	work := new(big.Int)
+	for i, hash := range hashes {
+		block, err := c.GetBlock(hash)
+		if err != nil {
+			return err
+		}
+		work.Add(work, blockWork(block.Header.Bits))
+		works[i] = work.Bytes()
+	}
+
+	return c.Store.Update(func(batch Batch) error {
+		for i, hash := range hashes {
+			if err := batch.Set(workKey(hash), works[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// AcceptBlock stores a block mined by any producer
+//
+// Blocks are kept by hash whatever branch they extend. When the branch of
+// the block has more cumulative work than the main chain, the main chain is
+// reorganized onto it: blocks are disconnected back to the fork and the
+// UTXO set rolled back, then the blocks of the branch are validated and
+// connected. Nothing is written when any block of the branch is invalid.
+func (c *BlockChain) AcceptBlock(block *Block) (*ChainUpdate, error) {
+	fail := func(reason error) error {
+		return &VerificationError{block.Header.Height, block.Hash, nil, reason}
+	}
+
+	if _, err := c.CumulativeWork(block.Hash); err == nil {
+		return nil, fmt.Errorf("%w: %x", ErrBlockExists, block.Hash)
+	}
+
+	parent, err := c.GetBlock(block.Header.PrevHash)
+	if errors.Is(err, ErrBlockNotFound) {
+		return nil, fmt.Errorf("%w: %x", ErrOrphanBlock, block.Header.PrevHash)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Checks everything that does not depend on the UTXO set
+	if block.Header.Version != BlockVersion {
+		return nil, fail(fmt.Errorf("unsupported block version %d", block.Header.Version))
+	}
+	if block.Header.Height != parent.Header.Height+1 {
+		return nil, fail(ErrBadHeight)
+	}
+	if err := c.checkTimestamp(block, parent); err != nil {
+		if errors.Is(err, ErrTimeTooOld) || errors.Is(err, ErrTimeTooNew) {
+			return nil, fail(err)
+		}
+		return nil, err
+	}
+	if !NewProofOfWork(block).Validate(c) {
+		return nil, fail(ErrBadProofOfWork)
+	}
+	if !bytes.Equal(block.Header.MerkleRoot, block.HashTransactions()) {
+		return nil, fail(ErrBadMerkleRoot)
+	}
+	if err := block.CheckTransactionIDs(); err != nil {
+		return nil, fail(fmt.Errorf("%w: %v", ErrBadTxID, err))
+	}
+	if err := block.CheckTransactionVersions(); err != nil {
+		return nil, fail(err)
+	}
+	for _, tx := range block.Transactions {
+		if _, err := tx.CheckValue(); err != nil {
+			return nil, &VerificationError{block.Header.Height, block.Hash, tx.ID, err}
+		}
+	}
+
+	parentWork, err := c.CumulativeWork(parent.Hash)
+	if err != nil {
+		return nil, err
+	}
+	work := new(big.Int).Add(parentWork, blockWork(block.Header.Bits))
+
+	tipWork, err := c.CumulativeWork(c.LastHash)
+	if err != nil {
+		return nil, err
+	}
+
+	update := &ChainUpdate{}
+	newTip := c.LastHash
+
+	err = c.Store.Update(func(batch Batch) error {
+		if err := batch.PutBlock(block); err != nil {
+			return err
+		}
+		if err := batch.Set(workKey(block.Hash), work.Bytes()); err != nil {
+			return err
+		}
+
+		// Ties keep the branch seen first
+		if work.Cmp(tipWork) <= 0 {
+			return nil
+		}
+
+		if err := c.reorganize(batch, block, update); err != nil {
+			return err
+		}
+		newTip = block.Hash
+
+		return batch.SetTip(block.Hash)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	c.LastHash = newTip
+
+	return update, nil
+}
+
+// reorganize moves the main chain and the UTXO set from the current tip to
+// the branch ending with tip, filling update
+// Blocks are read through the batch, which holds the store while it is open
+func (c *BlockChain) reorganize(batch Batch, tip *Block, update *ChainUpdate) error {
+	parent := func(block *Block) (*Block, error) {
+		return getBlock(batch.Get, block.Header.PrevHash)
+	}
+
+	oldBlock, err := getBlock(batch.Get, c.LastHash)
+	if err != nil {
+		return err
+	}
+
+	// Walks both sides back to their common ancestor
+	var branch []*Block
+	newBlock := tip
+	for newBlock.Header.Height > oldBlock.Header.Height {
+		branch = append(branch, newBlock)
+		if newBlock, err = parent(newBlock); err != nil {
+			return err
+		}
+	}
+	for oldBlock.Header.Height > newBlock.Header.Height {
+		update.Disconnected = append(update.Disconnected, oldBlock)
+		if oldBlock, err = parent(oldBlock); err != nil {
+			return err
+		}
+	}
+	for !bytes.Equal(newBlock.Hash, oldBlock.Hash) {
+		branch = append(branch, newBlock)
+		update.Disconnected = append(update.Disconnected, oldBlock)
+		if newBlock, err = parent(newBlock); err != nil {
+			return err
+		}
+		if oldBlock, err = parent(oldBlock); err != nil {
+			return err
+		}
+	}
+
+	UTXO := UTXOSet{c}
+
+	for _, block := range update.Disconnected {
+		if err := c.disconnectBlock(batch, UTXO, block); err != nil {
+			return err
+		}
+	}
+
+	for i := len(branch) - 1; i >= 0; i-- {
+		if err := c.connectBlock(batch, UTXO, branch[i]); err != nil {
+			return err
+		}
+		update.Connected = append(update.Connected, branch[i])
+	}
+
+	return nil
+}
+
+// connectBlock validates the transactions of a block against the UTXO set
+// and applies them to the UTXO set and the indexes
+func (c *BlockChain) connectBlock(batch Batch, UTXO UTXOSet, block *Block) error {
+	fail := func(txID []byte, reason error) error {
+		return &VerificationError{block.Header.Height, block.Hash, txID, reason}
+	}
+
+	var spent []UnspentOutput
+	created := make(map[string]bool)
+	fees := 0
+
+	for i, tx := range block.Transactions {
+		// Outputs of a transaction with the same ID would be overwritten
+		if len(tx.Outputs) > 0 {
+			if _, err := batch.Get(outpointKey(tx.ID, 0)); err == nil {
+				return fail(tx.ID, ErrDuplicateTx)
+			}
+		}
+
+		if tx.IsCoinbase() {
+			if i != 0 {
+				return fail(tx.ID, ErrBadCoinbase)
+			}
+		} else {
+			// Verify only needs the outputs being spent, so the previous
+			// transactions are rebuilt from the UTXO set
+			prevTXs := make(map[string]transactions.Transaction)
+			var inputs []int
+
+			for _, in := range tx.Inputs {
+				out, err := lookupOutput(batch.Get, in.ID, in.Out)
+				if errors.Is(err, ErrMissingInput) {
+					return fail(tx.ID, ErrMissingInput)
+				}
+				if err != nil {
+					return err
+				}
+
+				inTxID := hex.EncodeToString(in.ID)
+				prevTX := prevTXs[inTxID]
+				prevTX.ID = in.ID
+				for len(prevTX.Outputs) <= in.Out {
+					prevTX.Outputs = append(prevTX.Outputs, transactions.TxOutput{})
+				}
+				prevTX.Outputs[in.Out] = out
+				prevTXs[inTxID] = prevTX
+
+				inputs = append(inputs, out.Value)
+			}
+
+			fee, err := tx.FeeOf(inputs)
+			if err != nil {
+				return fail(tx.ID, err)
+			}
+			if !tx.Verify(prevTXs) {
+				return fail(tx.ID, ErrBadSignature)
+			}
+			if fees, err = transactions.AddValue(fees, fee); err != nil {
+				return fail(tx.ID, err)
+			}
+		}
+
+		outs, err := UTXO.updateTx(batch, tx)
+		if errors.Is(err, ErrMissingInput) {
+			// An input spent twice in the same transaction
+			return fail(tx.ID, ErrMissingInput)
+		}
+		if err != nil {
+			return err
+		}
+
+		// Outputs created and spent in the block are not restored on rollback
+		for _, out := range outs {
+			if !created[hex.EncodeToString(out.TxID)] {
+				spent = append(spent, out)
+			}
+		}
+		created[hex.EncodeToString(tx.ID)] = true
+	}
+
+	if err := checkCoinbase(block, fees); err != nil {
+		return err
+	}
+
+	if err := batch.Set(undoKey(block.Hash), encodeUndo(spent)); err != nil {
+		return err
+	}
+	if err := batch.Set(utxoTipKey, block.Hash); err != nil {
+		return err
+	}
+
+	return indexBlock(batch, block)
+}
+
+// disconnectBlock rolls the UTXO set and the indexes back to the parent of
+// the block
+func (c *BlockChain) disconnectBlock(batch Batch, UTXO UTXOSet, block *Block) error {
+	spent, err := c.spentOutputs(batch, block)
+	if err != nil {
+		return err
+	}
+
+	if err := UTXO.rollback(batch, block, spent); err != nil {
+		return err
+	}
+
+	return unindexBlock(batch, block)
+}
+
+// spentOutputs gets the outputs a block spent from its undo data
+// Blocks connected before undo data was stored are looked up in their
+// ancestors instead
+func (c *BlockChain) spentOutputs(batch Batch, block *Block) ([]UnspentOutput, error) {
+	var spent []UnspentOutput
+
+	data, err := batch.Get(undoKey(block.Hash))
+	if err == nil {
+		return decodeUndo(data)
+	}
+	if !errors.Is(err, ErrKeyNotFound) {
+		return nil, err
+	}
+
+	created := make(map[string]*transactions.Transaction)
+	for _, tx := range block.Transactions {
+		created[hex.EncodeToString(tx.ID)] = tx
+	}
+
+	for _, tx := range block.Transactions {
+		if tx.IsCoinbase() {
+			continue
+		}
+		for _, in := range tx.Inputs {
+			// Outputs created and spent in the block are not restored
+			if _, ok := created[hex.EncodeToString(in.ID)]; ok {
+				continue
+			}
+
+			prevTX, err := findAncestorTransaction(batch, block, in.ID)
+			if err != nil {
+				return nil, err
+			}
+			if in.Out < 0 || in.Out >= len(prevTX.Outputs) {
+				return nil, fmt.Errorf("%w: %x:%d", ErrMissingInput, in.ID, in.Out)
+			}
+			spent = append(spent, UnspentOutput{TxID: in.ID, Index: in.Out, Output: prevTX.Outputs[in.Out]})
+		}
+	}
+
+	return spent, nil
+}
+
+// encodeUndo converts the outputs spent by a block to byte
+// The encoding is EncodingMagic followed by the number of outputs and, for
+// each, the transaction ID as bytes, the index as int and the serialized
+// output as bytes, with the layout of utils.Encoder.
+func encodeUndo(spent []UnspentOutput) []byte {
+	var e utils.Encoder
+
+	e.WriteMagic()
+	e.WriteUint(uint64(len(spent)))
+	for _, out := range spent {
+		e.WriteBytes(out.TxID)
+		e.WriteInt(int64(out.Index))
+		e.WriteBytes(out.Output.Serialize())
+	}
+
+	return e.Bytes()
+}
+
+// decodeUndo converts byte to the outputs spent by a block
+// Undo data stored with gob before the binary encoding is still read
+func decodeUndo(data []byte) ([]UnspentOutput, error) {
+	var spent []UnspentOutput
+
+	if !utils.IsBinaryEncoding(data) {
+		err := gob.NewDecoder(bytes.NewReader(data)).Decode(&spent)
+		return spent, err
+	}
+
+	d := utils.NewDecoder(data)
+	if err := d.ReadMagic(); err != nil {
+		return nil, err
+	}
+
+	count, err := d.ReadLength()
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i < count; i++ {
+		var out UnspentOutput
+
+		if out.TxID, err = d.ReadBytes(); err != nil {
+			return nil, err
+		}
+		index, err := d.ReadInt()
+		if err != nil {
+			return nil, err
+		}
+		data, err := d.ReadBytes()
+		if err != nil {
+			return nil, err
+		}
+		if out.Output, err = transactions.DeserializeOutput(data); err != nil {
+			return nil, err
+		}
+
+		out.Index = int(index)
+		spent = append(spent, out)
+	}
+
+	return spent, d.Finish()
+}
+
+// findAncestorTransaction finds a transaction in the ancestors of a block
+func findAncestorTransaction(batch Batch, block *Block, ID []byte) (*transactions.Transaction, error) {
+	ancestor := block
+	for !ancestor.IsGenesis() {
+		var err error
+		ancestor, err = getBlock(batch.Get, ancestor.Header.PrevHash)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, tx := range ancestor.Transactions {
+			if bytes.Equal(tx.ID, ID) {
+				return tx, nil
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("%w: %x", ErrTxNotFound, ID)
+}
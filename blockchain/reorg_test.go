@@ -0,0 +1,224 @@
+package blockchain
+
+import (
+	"bytes"
+	"digitalWallet/transactions"
+	"digitalWallet/utils"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// checkTip checks the tip in memory and in the store
+func (c *testChain) checkTip(want *Block) {
+	c.t.Helper()
+
+	stored, err := c.Store.GetTip()
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if !bytes.Equal(c.LastHash, want.Hash) || !bytes.Equal(stored, want.Hash) {
+		c.t.Fatalf("tip %x, stored tip %x, want %x", c.LastHash, stored, want.Hash)
+	}
+}
+
+// checkHashes checks that an update lists the blocks in order
+func checkHashes(t *testing.T, name string, got, want []*Block) {
+	t.Helper()
+
+	if len(got) != len(want) {
+		t.Fatalf("%s %d blocks, want %d", name, len(got), len(want))
+	}
+	for i := range want {
+		if !bytes.Equal(got[i].Hash, want[i].Hash) {
+			t.Errorf("%s block %d is %x, want %x", name, i, got[i].Hash, want[i].Hash)
+		}
+	}
+}
+
+func TestAcceptBlockReorganizes(t *testing.T) {
+	c := newTestChain(t)
+	genesis := c.tip()
+	coinbase := genesis.Transactions[0]
+	subsidy := Policy.Subsidy(0)
+
+	// The main chain pays the genesis coinbase to a first transaction
+	mainTx := c.spend(coinbase, 0, c.address(), subsidy-1)
+	main1 := c.mine(mainTx)
+	main2 := c.mine()
+
+	// The branch spends it differently, and spends that output again in the
+	// same block
+	forkTx := c.spend(coinbase, 0, c.address(), subsidy-2)
+	childTx := c.spend(forkTx, 0, c.address(), subsidy-4)
+	fork1 := c.mineOn(genesis, "fork", 4, forkTx, childTx)
+	fork2 := c.mineOn(fork1, "fork", 0)
+	fork3 := c.mineOn(fork2, "fork", 0)
+
+	// Branches with less or as much work are only stored
+	for _, block := range []*Block{fork1, fork2} {
+		update := c.accept(block)
+		if len(update.Connected) != 0 || len(update.Disconnected) != 0 {
+			t.Fatalf("side branch changed the main chain: %+v", update)
+		}
+		c.checkTip(main2)
+	}
+	if _, err := c.AcceptBlock(fork2); !errors.Is(err, ErrBlockExists) {
+		t.Errorf("accepting a block twice gave %v, want %v", err, ErrBlockExists)
+	}
+
+	update := c.accept(fork3)
+	c.checkTip(fork3)
+	checkHashes(t, "disconnected", update.Disconnected, []*Block{main2, main1})
+	checkHashes(t, "connected", update.Connected, []*Block{fork1, fork2, fork3})
+	c.checkUnspent()
+
+	if _, err := c.FindTransactionLocation(mainTx.ID); !errors.Is(err, ErrTxNotFound) {
+		t.Errorf("disconnected transaction is still indexed: %v", err)
+	}
+	if block, err := c.FindTransactionBlock(childTx.ID); err != nil || !bytes.Equal(block.Hash, fork1.Hash) {
+		t.Errorf("connected transaction found in %v, %v", block, err)
+	}
+	if block, err := c.GetBlockByHeight(2); err != nil || !bytes.Equal(block.Hash, fork2.Hash) {
+		t.Errorf("height 2 is %v, %v", block, err)
+	}
+	if _, err := c.Verify(VerifyOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Growing the first branch again moves back to it, which rolls back an
+	// output created and spent in the same block
+	main3 := c.mineOn(main2, "main", 0)
+	main4 := c.mineOn(main3, "main", 0)
+	c.accept(main3)
+	c.checkTip(fork3)
+
+	update = c.accept(main4)
+	c.checkTip(main4)
+	checkHashes(t, "disconnected", update.Disconnected, []*Block{fork3, fork2, fork1})
+	checkHashes(t, "connected", update.Connected, []*Block{main1, main2, main3, main4})
+	c.checkUnspent()
+
+	if _, err := (UTXOSet{c.BlockChain}).FindOutput(forkTx.ID, 0); !errors.Is(err, ErrMissingInput) {
+		t.Errorf("output created and spent in a disconnected block was restored: %v", err)
+	}
+	if _, err := c.Verify(VerifyOptions{}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAcceptBlockInvalidBranch(t *testing.T) {
+	c := newTestChain(t)
+	genesis := c.tip()
+	coinbase := genesis.Transactions[0]
+
+	main1 := c.mine()
+	before := c.unspent()
+
+	// The second block of the branch spends more than its input
+	fork1 := c.mineOn(genesis, "fork", 0)
+	c.accept(fork1)
+
+	badTx := c.spend(coinbase, 0, c.address(), Policy.Subsidy(0)+1)
+	fork2 := c.mineOn(fork1, "fork", 0, badTx)
+
+	var verificationErr *VerificationError
+	_, err := c.AcceptBlock(fork2)
+	if !errors.As(err, &verificationErr) || !errors.Is(err, ErrOutputsTooLarge) {
+		t.Fatalf("invalid branch gave %v, want %v", err, ErrOutputsTooLarge)
+	}
+	if !bytes.Equal(verificationErr.TxID, badTx.ID) {
+		t.Errorf("error names transaction %x, want %x", verificationErr.TxID, badTx.ID)
+	}
+
+	// Nothing of the branch switch is written
+	c.checkTip(main1)
+	if _, err := c.GetBlock(fork2.Hash); !errors.Is(err, ErrBlockNotFound) {
+		t.Errorf("invalid block was stored: %v", err)
+	}
+	after := c.unspent()
+	if len(after) != len(before) {
+		t.Errorf("UTXO set changed from %d to %d outputs", len(before), len(after))
+	}
+	for outpoint, value := range before {
+		if after[outpoint] != value {
+			t.Errorf("output %s changed from %d to %d", outpoint, value, after[outpoint])
+		}
+	}
+}
+
+func TestAcceptBlockRejects(t *testing.T) {
+	c := newTestChain(t)
+	genesis := c.tip()
+
+	orphan := c.mineOn(genesis, "orphan", 0)
+	orphan.Header.PrevHash = []byte("unknown")
+	if _, err := c.AcceptBlock(orphan); !errors.Is(err, ErrOrphanBlock) {
+		t.Errorf("orphan gave %v, want %v", err, ErrOrphanBlock)
+	}
+
+	// The merkle root and proof of work only cover the transaction IDs
+	badID := c.mineOn(genesis, "bad ID", 0)
+	badID.Transactions[0].Outputs[0].Value--
+	_, err := c.AcceptBlock(badID)
+	if !errors.Is(err, ErrBadTxID) {
+		t.Errorf("bad transaction ID gave %v, want %v", err, ErrBadTxID)
+	} else if !strings.Contains(err.Error(), hex.EncodeToString(badID.Transactions[0].ID)) {
+		t.Errorf("error %q does not name the transaction", err)
+	}
+
+	tooOld := c.mineOn(genesis, "too old", 0)
+	tooOld.Header.Timestamp = genesis.Header.Timestamp
+	if _, err := c.AcceptBlock(tooOld); !errors.Is(err, ErrTimeTooOld) {
+		t.Errorf("old timestamp gave %v, want %v", err, ErrTimeTooOld)
+	}
+
+	badCoinbase := c.mineOn(genesis, "greedy", 1)
+	if _, err := c.AcceptBlock(badCoinbase); !errors.Is(err, ErrBadCoinbase) {
+		t.Errorf("greedy coinbase gave %v, want %v", err, ErrBadCoinbase)
+	}
+
+	c.checkTip(genesis)
+}
+
+func TestUndoRoundTrip(t *testing.T) {
+	spent := []UnspentOutput{
+		{TxID: bytes.Repeat([]byte{1}, 32), Index: 0, Output: transactions.TxOutput{Value: 50, PubKeyHash: bytes.Repeat([]byte{2}, 20)}},
+		{TxID: bytes.Repeat([]byte{3}, 32), Index: 7, Output: transactions.TxOutput{Value: 1 << 40, PubKeyHash: bytes.Repeat([]byte{4}, 20)}},
+	}
+
+	decoded, err := decodeUndo(encodeUndo(spent))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, spent) {
+		t.Errorf("round trip gave %+v, want %+v", decoded, spent)
+	}
+
+	if decoded, err := decodeUndo(encodeUndo(nil)); err != nil || len(decoded) != 0 {
+		t.Errorf("empty undo data decoded to %+v, %v", decoded, err)
+	}
+
+	// Undo data stored with gob is still read
+	var stored bytes.Buffer
+	if err := gob.NewEncoder(&stored).Encode(spent); err != nil {
+		t.Fatal(err)
+	}
+	decoded, err = decodeUndo(stored.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, spent) {
+		t.Errorf("gob undo data decoded to %+v, want %+v", decoded, spent)
+	}
+
+	encoded := encodeUndo(spent)
+	for _, data := range [][]byte{encoded[:len(encoded)-1], append(append([]byte{}, encoded...), 0)} {
+		if _, err := decodeUndo(data); !errors.Is(err, utils.ErrMalformedEncoding) {
+			t.Errorf("malformed undo data gave %v, want %v", err, utils.ErrMalformedEncoding)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package blockchain
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Migration upgrades the store from the previous schema version to Version
+type Migration struct {
+	Version     int
+	Description string
+
+	// Migrate converts the store of chain
+	// It may be run again on a store it already converted
+	Migrate func(chain *BlockChain) error
+}
+
+// Defines schema keys
+var (
+	// schemaKey holds the schema version of the store
+	// Stores created before it existed are at version 0
+	schemaKey = []byte("schema")
+)
+
+// migrations lists every migration in version order
+var migrations = []Migration{
+	{1, "add headers to blocks stored without one", migrateHeaders},
+	{2, "store blocks and unspent outputs in the binary encoding", migrateBinaryEncoding},
+	{3, "rebuild the UTXO set", migrateUTXOSet},
+	{4, "store the cumulative work of the main chain", migrateWork},
+	{5, "build the height, transaction and address indexes", migrateIndexes},
+}
+
+// SchemaVersion is the schema version of the stores this binary creates and
+// opens
+var SchemaVersion = migrations[len(migrations)-1].Version
+
+// Migrations lists the migrations a store at version needs, in order
+func Migrations(version int) []Migration {
+	var pending []Migration
+
+	for _, m := range migrations {
+		if m.Version > version {
+			pending = append(pending, m)
+		}
+	}
+
+	return pending
+}
+
+// GetSchemaVersion gets the schema version of the store
+func GetSchemaVersion(store ChainStore) (int, error) {
+	data, err := store.Get(schemaKey)
+	if errors.Is(err, ErrKeyNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	if len(data) != 8 {
+		return 0, fmt.Errorf("%w: schema version of %d bytes", ErrSchemaCorrupt, len(data))
+	}
+
+	return int(binary.BigEndian.Uint64(data)), nil
+}
+
+// setSchemaVersion stores the schema version in the batch
+func setSchemaVersion(batch Batch, version int) error {
+	data := make([]byte, 8)
+	binary.BigEndian.PutUint64(data, uint64(version))
+
+	return batch.Set(schemaKey, data)
+}
+
+// checkSchemaVersion refuses stores this binary cannot read
+func checkSchemaVersion(store ChainStore) error {
+	version, err := GetSchemaVersion(store)
+	if err != nil {
+		return err
+	}
+	if version > SchemaVersion {
+		return fmt.Errorf("%w: version %d, supported %d", ErrSchemaTooNew, version, SchemaVersion)
+	}
+	if version < SchemaVersion {
+		return fmt.Errorf("%w: version %d, current %d", ErrSchemaOutdated, version, SchemaVersion)
+	}
+
+	return nil
+}
+
+// Migrate upgrades the store to SchemaVersion
+//
+// The pending migrations run in order and the schema version is stored after
+// each one, so an interrupted upgrade resumes with the migration that
+// failed. onStep is called before each migration when it is set. It returns
+// the number of migrations run.
+func Migrate(store ChainStore, onStep func(m Migration)) (int, error) {
+	version, err := GetSchemaVersion(store)
+	if err != nil {
+		return 0, err
+	}
+	if version > SchemaVersion {
+		return 0, fmt.Errorf("%w: version %d, supported %d", ErrSchemaTooNew, version, SchemaVersion)
+	}
+
+	lastHash, err := store.GetTip()
+	if err != nil {
+		return 0, err
+	}
+	chain := &BlockChain{LastHash: lastHash, Store: store, Miner: DefaultMiner()}
+
+	pending := Migrations(version)
+	for _, m := range pending {
+		if onStep != nil {
+			onStep(m)
+		}
+		if err := m.Migrate(chain); err != nil {
+			return 0, fmt.Errorf("migration %d: %w", m.Version, err)
+		}
+
+		err := store.Update(func(batch Batch) error {
+			return setSchemaVersion(batch, m.Version)
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return len(pending), nil
+}
+
+// migrateHeaders converts blocks stored before headers were introduced
+func migrateHeaders(chain *BlockChain) error {
+	legacy, err := IsLegacyFormat(chain.Store)
+	if err != nil || !legacy {
+		return err
+	}
+
+	_, err = MigrateLegacyBlocks(chain.Store)
+	return err
+}
+
+// migrateBinaryEncoding converts blocks and outputs stored with gob
+func migrateBinaryEncoding(chain *BlockChain) error {
+	_, err := MigrateGobBlocks(chain.Store)
+	return err
+}
+
+// migrateUTXOSet indexes stores created before the UTXO set existed
+func migrateUTXOSet(chain *BlockChain) error {
+	UTXO := UTXOSet{chain}
+
+	current, err := UTXO.IsCurrent()
+	if err != nil || current {
+		return err
+	}
+
+	return UTXO.Reindex()
+}
+
+// migrateWork adds the block work missing from stores created before forks
+// were supported
+func migrateWork(chain *BlockChain) error {
+	return chain.indexWork()
+}
+
+// migrateIndexes indexes stores created before the chain indexes existed
+func migrateIndexes(chain *BlockChain) error {
+	indexed, err := chain.indexesCurrent()
+	if err != nil || indexed {
+		return err
+	}
+
+	return chain.ReindexChain()
+}
@@ -2,30 +2,159 @@ package blockchain
 
 import (
 	"bytes"
+	"digitalWallet/transactions"
 	"digitalWallet/utils"
 	"encoding/gob"
+	"fmt"
 )
 
 // Serialize converts struct to byte
+//
+// The encoding is EncodingMagic followed by the header fields as written by
+// BlockHeader.encode, the block hash as bytes, and the number of
+// transactions followed by each transaction encoding as bytes, with the
+// layout of utils.Encoder.
 func (b *Block) Serialize() []byte {
-	var res bytes.Buffer
-	encoder := gob.NewEncoder(&res)
+	var e utils.Encoder
 
-	err := encoder.Encode(b)
+	e.WriteMagic()
+	b.Header.encode(&e)
+	e.WriteBytes(b.Hash)
 
-	utils.HandleError(err)
+	e.WriteUint(uint64(len(b.Transactions)))
+	for _, tx := range b.Transactions {
+		e.WriteBytes(tx.Serialize())
+	}
 
-	return res.Bytes()
+	return e.Bytes()
 }
 
-func Deserialize(data []byte) *Block {
+// Serialize converts header to byte
+// Blocks from BinaryBlockVersion on are hashed over this encoding
+func (h BlockHeader) Serialize() []byte {
+	var e utils.Encoder
+
+	e.WriteMagic()
+	h.encode(&e)
+
+	return e.Bytes()
+}
+
+// encode writes the header fields
+//
+//	Version int, Timestamp int, Height int, PrevHash bytes,
+//	MerkleRoot bytes, Bits int, Nonce int
+func (h BlockHeader) encode(e *utils.Encoder) {
+	e.WriteInt(int64(h.Version))
+	e.WriteInt(h.Timestamp)
+	e.WriteInt(int64(h.Height))
+	e.WriteBytes(h.PrevHash)
+	e.WriteBytes(h.MerkleRoot)
+	e.WriteInt(int64(h.Bits))
+	e.WriteInt(int64(h.Nonce))
+}
+
+// Deserialize converts byte to block
+// Blocks holding a transaction whose ID does not match its contents are rejected
+func Deserialize(data []byte) (*Block, error) {
+	block, err := decodeBlock(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := block.CheckTransactionIDs(); err != nil {
+		return nil, fmt.Errorf("block %x: %w", block.Hash, err)
+	}
+
+	return block, nil
+}
+
+// decodeBlock converts byte to block without checking it
+func decodeBlock(data []byte) (*Block, error) {
+	var block Block
+
+	d := utils.NewDecoder(data)
+	if err := d.ReadMagic(); err != nil {
+		return nil, err
+	}
+
+	header, err := decodeHeader(d)
+	if err != nil {
+		return nil, err
+	}
+	block.Header = header
+
+	if block.Hash, err = d.ReadBytes(); err != nil {
+		return nil, err
+	}
+
+	count, err := d.ReadLength()
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i < count; i++ {
+		data, err := d.ReadBytes()
+		if err != nil {
+			return nil, err
+		}
+		tx, err := transactions.DecodeTransaction(data)
+		if err != nil {
+			return nil, err
+		}
+		block.Transactions = append(block.Transactions, &tx)
+	}
+
+	return &block, d.Finish()
+}
+
+// decodeHeader reads the header fields written by BlockHeader.encode
+func decodeHeader(d *utils.Decoder) (BlockHeader, error) {
+	var h BlockHeader
+
+	version, err := d.ReadInt()
+	if err != nil {
+		return BlockHeader{}, err
+	}
+	if h.Timestamp, err = d.ReadInt(); err != nil {
+		return BlockHeader{}, err
+	}
+	height, err := d.ReadInt()
+	if err != nil {
+		return BlockHeader{}, err
+	}
+	if h.PrevHash, err = d.ReadBytes(); err != nil {
+		return BlockHeader{}, err
+	}
+	if h.MerkleRoot, err = d.ReadBytes(); err != nil {
+		return BlockHeader{}, err
+	}
+	bits, err := d.ReadInt()
+	if err != nil {
+		return BlockHeader{}, err
+	}
+	nonce, err := d.ReadInt()
+	if err != nil {
+		return BlockHeader{}, err
+	}
+
+	h.Version = int(version)
+	h.Height = int(height)
+	h.Bits = int(bits)
+	h.Nonce = int(nonce)
+
+	return h, nil
+}
+
+// decodeGobBlock converts a block stored before the binary encoding
+func decodeGobBlock(data []byte) (*Block, error) {
 	var block Block
 
 	decoder := gob.NewDecoder(bytes.NewReader(data))
 
 	err := decoder.Decode(&block)
+	if err != nil {
+		return nil, err
+	}
 
-	utils.HandleError(err)
-
-	return &block
+	return &block, nil
 }
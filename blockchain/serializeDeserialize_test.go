@@ -0,0 +1,159 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"digitalWallet/transactions"
+	"digitalWallet/utils"
+	"digitalWallet/wallet"
+	"encoding/hex"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// goldenBlock is the block of the golden vectors
+func goldenBlock() *Block {
+	tx := &transactions.Transaction{
+		Version: transactions.TxVersion,
+		Inputs:  []transactions.TxInput{{ID: []byte{0xaa}, Out: 1, Signature: []byte{0xbb}, PubKey: []byte{0xcc}}},
+		Outputs: []transactions.TxOutput{{Value: 7, PubKeyHash: []byte{0xdd}}},
+	}
+	tx.SetID()
+
+	return &Block{
+		Header: BlockHeader{
+			Version:    BinaryBlockVersion,
+			Timestamp:  1600000000,
+			Height:     1,
+			PrevHash:   bytes.Repeat([]byte{0x01}, 4),
+			MerkleRoot: bytes.Repeat([]byte{0x02}, 4),
+			Bits:       12,
+			Nonce:      42,
+		},
+		Hash:         bytes.Repeat([]byte{0x03}, 4),
+		Transactions: []*transactions.Transaction{tx},
+	}
+}
+
+// Defines golden vectors
+const (
+	goldenHeader = "db" +
+		"0000000000000003" + // version
+		"000000005f5e1000" + // timestamp
+		"0000000000000001" + // height
+		"0000000000000004" + "01010101" +
+		"0000000000000004" + "02020202" +
+		"000000000000000c" + // bits
+		"000000000000002a" // nonce
+
+	// goldenHeaderHash is the hash proof of work is checked against
+	goldenHeaderHash = "8e8ba65676cfebe47ad1bbe0284e39895db26b6ee4c01ce9b61b5507ea71a845"
+
+	// goldenTx is the encoding of the transaction of the golden block
+	goldenTx = "db000000000000000200000000000000010000000000000001aa0000000000000001" +
+		"0000000000000001bb0000000000000001cc000000000000000100000000000000070000000000000001dd" +
+		"0000000000000020892290c710c5228ee3c1f0ff08717baffb7dce1c63dd75d79f20005d926653e4"
+
+	goldenBlockEncoding = goldenHeader +
+		"0000000000000004" + "03030303" +
+		"0000000000000001" + // transactions
+		"0000000000000075" + goldenTx
+)
+
+func mustDecodeHex(t *testing.T, s string) []byte {
+	t.Helper()
+
+	data, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return data
+}
+
+func TestHeaderGolden(t *testing.T) {
+	header := goldenBlock().Header
+
+	if got := hex.EncodeToString(header.Serialize()); got != goldenHeader {
+		t.Errorf("Serialize() = %s, want %s", got, goldenHeader)
+	}
+
+	pow := NewProofOfWork(&Block{Header: header})
+	hash := sha256.Sum256(pow.InitNonce(header.Nonce))
+	if got := hex.EncodeToString(hash[:]); got != goldenHeaderHash {
+		t.Errorf("header hash = %s, want %s", got, goldenHeaderHash)
+	}
+}
+
+func TestBlockGolden(t *testing.T) {
+	block := goldenBlock()
+
+	if got := hex.EncodeToString(block.Serialize()); got != goldenBlockEncoding {
+		t.Errorf("Serialize() = %s, want %s", got, goldenBlockEncoding)
+	}
+
+	decoded, err := Deserialize(mustDecodeHex(t, goldenBlockEncoding))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, block) {
+		t.Errorf("Deserialize() = %+v, want %+v", decoded, block)
+	}
+}
+
+func TestBlockRoundTrip(t *testing.T) {
+	w, err := wallet.MakeWallet(wallet.DefaultKeyType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	coinbase, err := transactions.CoinbaseTxn(string(w.Address()), genesisData, 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	genesis, err := Genesis(coinbase)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, block := range []*Block{genesis, goldenBlock(), {Header: BlockHeader{Version: BlockVersion}}} {
+		encoded := block.Serialize()
+
+		decoded, err := Deserialize(encoded)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(decoded.Serialize(), encoded) {
+			t.Errorf("encoding of block %x changed after a round trip", block.Hash)
+		}
+		if decoded.Header.String() != block.Header.String() {
+			t.Errorf("round trip gave header\n%s\nwant\n%s", decoded.Header, block.Header)
+		}
+	}
+}
+
+func TestDeserializeRejects(t *testing.T) {
+	golden := mustDecodeHex(t, goldenBlockEncoding)
+
+	// Changes the value of the output after the transaction ID was set
+	badTxID := append([]byte{}, golden...)
+	badTxID[len(badTxID)-32-8-1-8-1] ^= 1
+
+	tests := []struct {
+		name string
+		data []byte
+		err  error
+	}{
+		{"empty", nil, utils.ErrMalformedEncoding},
+		{"gob", golden[1:], utils.ErrMalformedEncoding},
+		{"truncated", golden[:len(golden)-1], utils.ErrMalformedEncoding},
+		{"trailing", append(append([]byte{}, golden...), 0), utils.ErrMalformedEncoding},
+		{"bad transaction ID", badTxID, ErrBadTxID},
+	}
+
+	for _, test := range tests {
+		if _, err := Deserialize(test.data); !errors.Is(err, test.err) {
+			t.Errorf("%s: got %v, want %v", test.name, err, test.err)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package blockchain
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ChainStore persists blocks, the chain tip and the indexes kept next to them
+//
+// Blocks are stored by hash and the tip is the hash of the last block. Other
+// keys, such as the UTXO set, are plain key value pairs. Writes that must be
+// applied together go through Update.
+type ChainStore interface {
+	// GetBlock gets a block by its hash, ErrBlockNotFound if it is missing
+	GetBlock(hash []byte) (*Block, error)
+
+	// GetTip gets the hash of the last block, ErrChainNotFound if there is none
+	GetTip() ([]byte, error)
+
+	// Get gets the value of a key, ErrKeyNotFound if it is missing
+	Get(key []byte) ([]byte, error)
+
+	// Iterate calls fn for every key starting with prefix in key order
+	// It stops without error when fn returns ErrStopIteration
+	Iterate(prefix []byte, fn func(key, value []byte) error) error
+
+	// Update runs fn with a batch whose writes are applied atomically
+	// Nothing is written when fn returns an error
+	Update(fn func(batch Batch) error) error
+
+	// Close releases the store
+	Close() error
+}
+
+// Batch is a set of writes applied atomically by ChainStore.Update
+// Reads see the writes already made in the batch
+type Batch interface {
+	// PutBlock stores a block under its hash
+	PutBlock(block *Block) error
+
+	// SetTip stores the hash of the last block
+	SetTip(hash []byte) error
+
+	Get(key []byte) ([]byte, error)
+	Set(key, value []byte) error
+	Delete(key []byte) error
+}
+
+// Defines store keys
+var (
+	// tipKey holds the hash of the last block
+	tipKey = []byte("lh")
+)
+
+// Defines store errors
+var (
+	// ErrKeyNotFound is returned when a key is not in the store
+	ErrKeyNotFound = errors.New("key does not exist")
+
+	// ErrStopIteration stops Iterate early when returned by its callback
+	ErrStopIteration = errors.New("stop iteration")
+)
+
+// getBlock decodes the block stored under hash with get
+func getBlock(get func(key []byte) ([]byte, error), hash []byte) (*Block, error) {
+	data, err := get(hash)
+	if errors.Is(err, ErrKeyNotFound) {
+		return nil, fmt.Errorf("%w: %x", ErrBlockNotFound, hash)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return Deserialize(data)
+}
+
+// getTip reads the tip with get
+func getTip(get func(key []byte) ([]byte, error)) ([]byte, error) {
+	hash, err := get(tipKey)
+	if errors.Is(err, ErrKeyNotFound) {
+		return nil, ErrChainNotFound
+	}
+
+	return hash, err
+}
@@ -0,0 +1,426 @@
+package blockchain
+
+import (
+	"bytes"
+	"digitalWallet/transactions"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// UTXOSet is an index of unspent transaction outputs kept in the chain store
+//
+// Every output is stored twice:
+//
+//	utxo-<txid><index>              -> public key hash of the output
+//	utxa-<pubKeyHash><txid><index>  -> serialized output
+//
+// so that spending needs a single lookup and balance queries only touch the
+// outputs of one address.
+type UTXOSet struct {
+	BlockChain *BlockChain
+}
+
+// Defines UTXO set keys
+var (
+	utxoPrefix     = []byte("utxo-")
+	utxoAddrPrefix = []byte("utxa-")
+
+	// utxoTipKey holds the hash of the block the UTXO set was last updated to
+	utxoTipKey = []byte("utxt")
+)
+
+const (
+	// reindexBatchSize limits how many outputs are written per batch
+	// Each output takes two writes, which must stay well below the number of
+	// writes a Badger transaction accepts
+	reindexBatchSize = 10000
+)
+
+// outpointKey builds the key of an output by transaction ID and index
+func outpointKey(txID []byte, outIdx int) []byte {
+	index := make([]byte, 4)
+	binary.BigEndian.PutUint32(index, uint32(outIdx))
+
+	return bytes.Join([][]byte{utxoPrefix, txID, index}, []byte{})
+}
+
+// addressKey builds the key of an output by owner, transaction ID and index
+func addressKey(pubKeyHash, txID []byte, outIdx int) []byte {
+	index := make([]byte, 4)
+	binary.BigEndian.PutUint32(index, uint32(outIdx))
+
+	return bytes.Join([][]byte{utxoAddrPrefix, pubKeyHash, txID, index}, []byte{})
+}
+
+// splitAddressKey extracts the transaction ID and index from an address key
+func splitAddressKey(key []byte, pubKeyHash []byte) ([]byte, int) {
+	rest := key[len(utxoAddrPrefix)+len(pubKeyHash):]
+	txID := rest[:len(rest)-4]
+	outIdx := int(binary.BigEndian.Uint32(rest[len(rest)-4:]))
+
+	return txID, outIdx
+}
+
+// Reindex rebuilds the UTXO set from the whole chain
+// The tip of the UTXO set is cleared first and only set once every batch is
+// written, so an interrupted reindex is never taken for a current one
+func (u UTXOSet) Reindex() error {
+	store := u.BlockChain.Store
+
+	err := store.Update(func(batch Batch) error {
+		return batch.Delete(utxoTipKey)
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := u.DeleteByPrefix(utxoPrefix); err != nil {
+		return err
+	}
+	if err := u.DeleteByPrefix(utxoAddrPrefix); err != nil {
+		return err
+	}
+
+	UTXO, err := u.BlockChain.FindAllUnspentOutputs()
+	if err != nil {
+		return err
+	}
+
+	// Writes the outputs in batches small enough for a single transaction
+	type entry struct {
+		txID   []byte
+		outIdx int
+		out    transactions.TxOutput
+	}
+	var entries []entry
+	for txId, outs := range UTXO {
+		txID, err := hex.DecodeString(txId)
+		if err != nil {
+			return err
+		}
+		for outIdx, out := range outs {
+			entries = append(entries, entry{txID, outIdx, out})
+		}
+	}
+
+	for start := 0; start < len(entries); start += reindexBatchSize {
+		end := start + reindexBatchSize
+		if end > len(entries) {
+			end = len(entries)
+		}
+
+		err := store.Update(func(batch Batch) error {
+			for _, e := range entries[start:end] {
+				if err := batch.Set(outpointKey(e.txID, e.outIdx), e.out.PubKeyHash); err != nil {
+					return err
+				}
+				if err := batch.Set(addressKey(e.out.PubKeyHash, e.txID, e.outIdx), e.out.Serialize()); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return store.Update(func(batch Batch) error {
+		return batch.Set(utxoTipKey, u.BlockChain.LastHash)
+	})
+}
+
+// IsCurrent reports whether the UTXO set reflects the chain tip
+func (u UTXOSet) IsCurrent() (bool, error) {
+	indexedHash, err := u.BlockChain.Store.Get(utxoTipKey)
+	if errors.Is(err, ErrKeyNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return bytes.Equal(indexedHash, u.BlockChain.LastHash), nil
+}
+
+// update applies the outputs spent and created by a block to the UTXO set
+// It is called inside the batch that stores the block and returns the spent
+// outputs, which are needed to roll the block back
+func (u UTXOSet) update(batch Batch, block *Block) ([]UnspentOutput, error) {
+	var spent []UnspentOutput
+
+	for _, tx := range block.Transactions {
+		outs, err := u.updateTx(batch, tx)
+		if err != nil {
+			return nil, err
+		}
+		spent = append(spent, outs...)
+	}
+
+	return spent, batch.Set(utxoTipKey, block.Hash)
+}
+
+// updateTx spends the inputs and adds the outputs of one transaction
+func (u UTXOSet) updateTx(batch Batch, tx *transactions.Transaction) ([]UnspentOutput, error) {
+	var spent []UnspentOutput
+
+	if !tx.IsCoinbase() {
+		for _, in := range tx.Inputs {
+			out, err := lookupOutput(batch.Get, in.ID, in.Out)
+			if err != nil {
+				return nil, err
+			}
+
+			if err := batch.Delete(outpointKey(in.ID, in.Out)); err != nil {
+				return nil, err
+			}
+			if err := batch.Delete(addressKey(out.PubKeyHash, in.ID, in.Out)); err != nil {
+				return nil, err
+			}
+			spent = append(spent, UnspentOutput{TxID: in.ID, Index: in.Out, Output: out})
+		}
+	}
+
+	for outIdx, out := range tx.Outputs {
+		if err := setOutput(batch, UnspentOutput{TxID: tx.ID, Index: outIdx, Output: out}); err != nil {
+			return nil, err
+		}
+	}
+
+	return spent, nil
+}
+
+// rollback undoes update for a block given the outputs it spent
+// The UTXO set is left at the parent of the block. Spent outputs created by
+// the block itself, which undo data stored by older binaries holds, are not
+// restored.
+func (u UTXOSet) rollback(batch Batch, block *Block, spent []UnspentOutput) error {
+	created := make(map[string]bool)
+
+	for i := len(block.Transactions) - 1; i >= 0; i-- {
+		tx := block.Transactions[i]
+		created[hex.EncodeToString(tx.ID)] = true
+
+		for outIdx, out := range tx.Outputs {
+			if err := batch.Delete(outpointKey(tx.ID, outIdx)); err != nil {
+				return err
+			}
+			if err := batch.Delete(addressKey(out.PubKeyHash, tx.ID, outIdx)); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, out := range spent {
+		if created[hex.EncodeToString(out.TxID)] {
+			continue
+		}
+		if err := setOutput(batch, out); err != nil {
+			return err
+		}
+	}
+
+	return batch.Set(utxoTipKey, block.Header.PrevHash)
+}
+
+// setOutput adds an output to the UTXO set
+func setOutput(batch Batch, out UnspentOutput) error {
+	if err := batch.Set(outpointKey(out.TxID, out.Index), out.Output.PubKeyHash); err != nil {
+		return err
+	}
+
+	return batch.Set(addressKey(out.Output.PubKeyHash, out.TxID, out.Index), out.Output.Serialize())
+}
+
+// lookupOutput reads an unspent output with get
+func lookupOutput(get func(key []byte) ([]byte, error), txID []byte, outIdx int) (transactions.TxOutput, error) {
+	pubKeyHash, err := get(outpointKey(txID, outIdx))
+	if errors.Is(err, ErrKeyNotFound) {
+		return transactions.TxOutput{}, fmt.Errorf("%w: %x:%d", ErrMissingInput, txID, outIdx)
+	}
+	if err != nil {
+		return transactions.TxOutput{}, err
+	}
+
+	data, err := get(addressKey(pubKeyHash, txID, outIdx))
+	if err != nil {
+		return transactions.TxOutput{}, err
+	}
+
+	return transactions.DeserializeOutput(data)
+}
+
+// FindOutput gets an unspent output by transaction ID and index
+func (u UTXOSet) FindOutput(txID []byte, outIdx int) (transactions.TxOutput, error) {
+	return lookupOutput(u.BlockChain.Store.Get, txID, outIdx)
+}
+
+// Fees sums the fees of transactions mined together on top of the UTXO set
+// Inputs must spend an unspent output or one created by an earlier
+// transaction of txs, and no output may be spent twice
+func (u UTXOSet) Fees(txs []*transactions.Transaction) (int, error) {
+	created := make(map[string]transactions.TxOutput)
+	spent := make(map[string]bool)
+	fees := 0
+
+	for _, tx := range txs {
+		var inputs []int
+		for _, in := range tx.Inputs {
+			key := string(outpointKey(in.ID, in.Out))
+			if spent[key] {
+				return 0, fmt.Errorf("%w: %x:%d", ErrMissingInput, in.ID, in.Out)
+			}
+
+			out, ok := created[key]
+			if !ok {
+				var err error
+				out, err = u.FindOutput(in.ID, in.Out)
+				if err != nil {
+					return 0, err
+				}
+			}
+
+			spent[key] = true
+			inputs = append(inputs, out.Value)
+		}
+
+		fee, err := tx.FeeOf(inputs)
+		if err != nil {
+			return 0, err
+		}
+		if fees, err = transactions.AddValue(fees, fee); err != nil {
+			return 0, fmt.Errorf("%w: %x", err, tx.ID)
+		}
+
+		for outIdx, out := range tx.Outputs {
+			created[string(outpointKey(tx.ID, outIdx))] = out
+		}
+	}
+
+	return fees, nil
+}
+
+// FindUTXO finds all unspent outputs locked with the public key hash
+func (u UTXOSet) FindUTXO(pubKeyHash []byte) ([]transactions.TxOutput, error) {
+	var UTXOs []transactions.TxOutput
+
+	prefix := append(append([]byte{}, utxoAddrPrefix...), pubKeyHash...)
+
+	err := u.BlockChain.Store.Iterate(prefix, func(key, value []byte) error {
+		out, err := transactions.DeserializeOutput(value)
+		if err != nil {
+			return err
+		}
+		UTXOs = append(UTXOs, out)
+		return nil
+	})
+
+	return UTXOs, err
+}
+
+// UnspentOutput is an unspent output with the outpoint it is stored under
+type UnspentOutput struct {
+	TxID   []byte
+	Index  int
+	Output transactions.TxOutput
+}
+
+// FindUnspentOutputs lists the unspent outputs locked with the public key hash
+// together with their transaction ID and index
+func (u UTXOSet) FindUnspentOutputs(pubKeyHash []byte) ([]UnspentOutput, error) {
+	var UTXOs []UnspentOutput
+
+	prefix := append(append([]byte{}, utxoAddrPrefix...), pubKeyHash...)
+
+	err := u.BlockChain.Store.Iterate(prefix, func(key, value []byte) error {
+		out, err := transactions.DeserializeOutput(value)
+		if err != nil {
+			return err
+		}
+		txID, outIdx := splitAddressKey(key, pubKeyHash)
+
+		UTXOs = append(UTXOs, UnspentOutput{TxID: txID, Index: outIdx, Output: out})
+		return nil
+	})
+
+	return UTXOs, err
+}
+
+// FindSpendableOutputs finds unspent outputs of the public key hash
+// until their value covers the amount
+func (u UTXOSet) FindSpendableOutputs(pubKeyHash []byte, amount int) (int, map[string][]int, error) {
+	unspentOuts := make(map[string][]int)
+	accumulated := 0
+
+	prefix := append(append([]byte{}, utxoAddrPrefix...), pubKeyHash...)
+
+	err := u.BlockChain.Store.Iterate(prefix, func(key, value []byte) error {
+		if accumulated >= amount {
+			return ErrStopIteration
+		}
+
+		out, err := transactions.DeserializeOutput(value)
+		if err != nil {
+			return err
+		}
+		txID, outIdx := splitAddressKey(key, pubKeyHash)
+
+		id := hex.EncodeToString(txID)
+		accumulated += out.Value
+		unspentOuts[id] = append(unspentOuts[id], outIdx)
+		return nil
+	})
+
+	return accumulated, unspentOuts, err
+}
+
+// CountTransactions counts the transactions that still have unspent outputs
+func (u UTXOSet) CountTransactions() (int, error) {
+	txIDs := make(map[string]bool)
+
+	err := u.BlockChain.Store.Iterate(utxoPrefix, func(key, value []byte) error {
+		txIDs[string(key[len(utxoPrefix):len(key)-4])] = true
+		return nil
+	})
+
+	return len(txIDs), err
+}
+
+// DeleteByPrefix deletes every key that starts with the prefix
+func (u UTXOSet) DeleteByPrefix(prefix []byte) error {
+	store := u.BlockChain.Store
+
+	deleteKeys := func(keysForDelete [][]byte) error {
+		return store.Update(func(batch Batch) error {
+			for _, key := range keysForDelete {
+				if err := batch.Delete(key); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+
+	var keysForDelete [][]byte
+	err := store.Iterate(prefix, func(key, value []byte) error {
+		keysForDelete = append(keysForDelete, key)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for start := 0; start < len(keysForDelete); start += reindexBatchSize {
+		end := start + reindexBatchSize
+		if end > len(keysForDelete) {
+			end = len(keysForDelete)
+		}
+		if err := deleteKeys(keysForDelete[start:end]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,266 @@
+package blockchain
+
+import (
+	"bytes"
+	"digitalWallet/transactions"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// VerifyOptions configures chain verification
+type VerifyOptions struct {
+	// Depth limits the checks to the most recent blocks, 0 checks every block
+	Depth int
+}
+
+// VerificationError reports the first invalid block found by Verify
+type VerificationError struct {
+	Height int
+	Hash   []byte
+	// TxID is set when a transaction of the block is invalid
+	TxID []byte
+	Err  error
+}
+
+// Defines verification failures
+var (
+	ErrBadHeight       = errors.New("height does not follow previous block")
+	ErrBadLink         = errors.New("previous hash does not match previous block")
+	ErrBadProofOfWork  = errors.New("proof of work is invalid")
+	ErrBadBits         = errors.New("difficulty bits are out of range")
+	ErrTimeTooOld      = errors.New("timestamp is not after the median of previous blocks")
+	ErrTimeTooNew      = errors.New("timestamp is too far in the future")
+	ErrBadMerkleRoot   = errors.New("merkle root does not match transactions")
+	ErrBadCoinbase     = errors.New("coinbase is misplaced or claims too much")
+	ErrDuplicateTx     = errors.New("transaction already exists in the chain")
+	ErrMissingInput    = errors.New("input spends an unknown or already spent output")
+	ErrBadSignature    = errors.New("signature is invalid")
+	ErrOutputsTooLarge = transactions.ErrNegativeFee
+	ErrBadValue        = transactions.ErrBadValue
+	ErrBadTxVersion    = transactions.ErrUnsupportedVersion
+)
+
+// Error formats the verification error
+func (e *VerificationError) Error() string {
+	if e.TxID != nil {
+		return fmt.Sprintf("block %d (%x): transaction %x: %s", e.Height, e.Hash, e.TxID, e.Err)
+	}
+	return fmt.Sprintf("block %d (%x): %s", e.Height, e.Hash, e.Err)
+}
+
+// Unwrap returns the reason of the verification error
+func (e *VerificationError) Unwrap() error {
+	return e.Err
+}
+
+// chainState tracks the outputs created and spent while replaying the chain
+type chainState struct {
+	// txs holds every transaction seen so far by ID
+	txs map[string]transactions.Transaction
+	// unspent holds the unspent output indexes of every transaction
+	unspent map[string]map[int]bool
+}
+
+// Verify walks the chain from genesis to the last block and checks
+// proof of work, block linkage, merkle roots, transaction IDs, signatures,
+// double spends and coinbase amounts
+//
+// Every block is replayed to track unspent outputs, but with a Depth only
+// the most recent blocks are checked. It returns the number of blocks checked
+// and the first invalid block as a *VerificationError.
+func (c *BlockChain) Verify(opts VerifyOptions) (int, error) {
+	hashes, err := c.chainHashes()
+	if err != nil {
+		return 0, err
+	}
+
+	state := newChainState()
+
+	firstChecked := 0
+	if opts.Depth > 0 && opts.Depth < len(hashes) {
+		firstChecked = len(hashes) - opts.Depth
+	}
+
+	var prevHash []byte
+	checked := 0
+
+	for height := 0; height < len(hashes); height++ {
+		block, err := c.rawBlock(hashes[height])
+		if err != nil {
+			return checked, err
+		}
+
+		check := height >= firstChecked
+		fail := func(txID []byte, reason error) error {
+			return &VerificationError{height, block.Hash, txID, reason}
+		}
+
+		if check {
+			if block.Header.Height != height {
+				return checked, fail(nil, ErrBadHeight)
+			}
+			if !bytes.Equal(block.Header.PrevHash, prevHash) {
+				return checked, fail(nil, ErrBadLink)
+			}
+			if !NewProofOfWork(block).Validate(c) {
+				return checked, fail(nil, ErrBadProofOfWork)
+			}
+			if !bytes.Equal(block.Header.MerkleRoot, block.HashTransactions()) {
+				return checked, fail(nil, ErrBadMerkleRoot)
+			}
+			if err := block.CheckTransactionVersions(); err != nil {
+				return checked, fail(nil, err)
+			}
+		}
+
+		fees := 0
+		for i, tx := range block.Transactions {
+			if check && block.Header.Version >= TxIDBlockVersion && tx.CheckID() != nil {
+				return checked, fail(tx.ID, ErrBadTxID)
+			}
+
+			fee, err := state.apply(tx, i, check)
+			if err != nil && check {
+				return checked, fail(tx.ID, err)
+			}
+			if fees, err = transactions.AddValue(fees, fee); err != nil && check {
+				return checked, fail(tx.ID, err)
+			}
+		}
+
+		// The coinbase may claim the reward and the fees of its block
+		if check {
+			if err := checkCoinbase(block, fees); err != nil {
+				return checked, err
+			}
+		}
+
+		if check {
+			checked++
+		}
+		prevHash = block.Hash
+	}
+
+	return checked, nil
+}
+
+// chainHashes lists the block hashes from genesis to the last block
+func (c *BlockChain) chainHashes() ([][]byte, error) {
+	var hashes [][]byte
+
+	hash := c.LastHash
+	for {
+		block, err := c.rawBlock(hash)
+		if err != nil {
+			return nil, err
+		}
+		hashes = append(hashes, block.Hash)
+
+		if block.IsGenesis() {
+			break
+		}
+		hash = block.Header.PrevHash
+	}
+
+	// Puts the genesis block first
+	for i, j := 0, len(hashes)-1; i < j; i, j = i+1, j-1 {
+		hashes[i], hashes[j] = hashes[j], hashes[i]
+	}
+
+	return hashes, nil
+}
+
+// newChainState creates an empty replay state
+func newChainState() chainState {
+	return chainState{
+		txs:     make(map[string]transactions.Transaction),
+		unspent: make(map[string]map[int]bool),
+	}
+}
+
+// rawBlock gets a block by its hash without rejecting invalid transactions
+// so that Verify can report them
+func (c *BlockChain) rawBlock(hash []byte) (*Block, error) {
+	data, err := c.Store.Get(hash)
+	if errors.Is(err, ErrKeyNotFound) {
+		return nil, fmt.Errorf("%w: %x", ErrBlockNotFound, hash)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeBlock(data)
+}
+
+// apply checks a transaction against the replayed state, adds it and
+// returns its fee
+// Signatures are only verified when check is set
+func (s *chainState) apply(tx *transactions.Transaction, position int, check bool) (int, error) {
+	txID := hex.EncodeToString(tx.ID)
+	fee := 0
+
+	if _, ok := s.txs[txID]; ok {
+		return 0, ErrDuplicateTx
+	}
+
+	if tx.IsCoinbase() {
+		if position != 0 {
+			return 0, ErrBadCoinbase
+		}
+		if _, err := tx.CheckValue(); err != nil {
+			return 0, err
+		}
+	} else {
+		prevTXs := make(map[string]transactions.Transaction)
+		var inputs []int
+
+		for _, in := range tx.Inputs {
+			inTxID := hex.EncodeToString(in.ID)
+			if !s.unspent[inTxID][in.Out] {
+				return 0, ErrMissingInput
+			}
+			prevTXs[inTxID] = s.txs[inTxID]
+			inputs = append(inputs, s.txs[inTxID].Outputs[in.Out].Value)
+
+			delete(s.unspent[inTxID], in.Out)
+		}
+
+		var err error
+		if fee, err = tx.FeeOf(inputs); err != nil {
+			return 0, err
+		}
+
+		if check && !tx.Verify(prevTXs) {
+			return 0, ErrBadSignature
+		}
+	}
+
+	s.txs[txID] = *tx
+	s.unspent[txID] = make(map[int]bool)
+	for outIdx := range tx.Outputs {
+		s.unspent[txID][outIdx] = true
+	}
+
+	return fee, nil
+}
+
+// checkCoinbase checks that the coinbase of a block claims at most the
+// subsidy and the fees of the block
+func checkCoinbase(block *Block, fees int) error {
+	if len(block.Transactions) == 0 || !block.Transactions[0].IsCoinbase() {
+		return nil
+	}
+	coinbase := block.Transactions[0]
+
+	claimed, err := coinbase.CheckValue()
+	if err != nil {
+		return &VerificationError{block.Header.Height, block.Hash, coinbase.ID, err}
+	}
+	allowed, err := transactions.AddValue(Policy.Subsidy(block.Header.Height), fees)
+	if err != nil || claimed > allowed {
+		return &VerificationError{block.Header.Height, block.Hash, coinbase.ID, ErrBadCoinbase}
+	}
+
+	return nil
+}
@@ -0,0 +1,73 @@
+package blockchain
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// corrupt stores a block again with its nonce changed, keeping its hash
+func (c *testChain) corrupt(block *Block) {
+	c.t.Helper()
+
+	corrupted := *block
+	corrupted.Header.Nonce++
+	if err := c.Store.Update(func(batch Batch) error { return batch.PutBlock(&corrupted) }); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+func TestVerifyDepth(t *testing.T) {
+	c := newTestChain(t)
+	genesis := c.tip()
+	subsidy := Policy.Subsidy(0)
+
+	// The last block spends an output of the genesis, which an unchecked
+	// block must still replay
+	early := c.mine()
+	c.mine()
+	c.mine()
+	c.mine(c.spend(genesis.Transactions[0], 0, c.address(), subsidy-1))
+	const blocks = 5
+
+	for _, depth := range []int{0, 1, 2, blocks, blocks + 1} {
+		want := depth
+		if depth == 0 || depth > blocks {
+			want = blocks
+		}
+		if checked, err := c.Verify(VerifyOptions{Depth: depth}); err != nil || checked != want {
+			t.Errorf("Verify(depth %d) = %d, %v, want %d", depth, checked, err, want)
+		}
+	}
+
+	// A corrupt block is reported by every depth reaching it
+	c.corrupt(early)
+	tests := []struct {
+		depth   int
+		checked int
+	}{
+		{0, 1},
+		{blocks - 1, 0},
+		{blocks, 1},
+	}
+
+	for _, test := range tests {
+		var verificationErr *VerificationError
+		checked, err := c.Verify(VerifyOptions{Depth: test.depth})
+		if !errors.As(err, &verificationErr) || !errors.Is(err, ErrBadProofOfWork) {
+			t.Fatalf("Verify(depth %d) gave %v, want %v", test.depth, err, ErrBadProofOfWork)
+		}
+		if verificationErr.Height != 1 || !bytes.Equal(verificationErr.Hash, early.Hash) {
+			t.Errorf("Verify(depth %d) reported block %d (%x), want 1 (%x)",
+				test.depth, verificationErr.Height, verificationErr.Hash, early.Hash)
+		}
+		if checked != test.checked {
+			t.Errorf("Verify(depth %d) checked %d blocks before failing, want %d", test.depth, checked, test.checked)
+		}
+	}
+
+	// and skipped by the others
+	if checked, err := c.Verify(VerifyOptions{Depth: blocks - 2}); err != nil || checked != blocks-2 {
+		t.Errorf("Verify(depth %d) = %d, %v", blocks-2, checked, err)
+	}
+}
@@ -1,17 +1,20 @@
 package cli
 
 import (
+	"context"
 	"digitalWallet/blockchain"
+	"digitalWallet/mempool"
 	"digitalWallet/services"
 	"digitalWallet/transactions"
-	"digitalWallet/utils"
 	"digitalWallet/wallet"
+	"encoding/hex"
 	"flag"
 	"fmt"
-	"log"
+	"io/ioutil"
 	"os"
-	"runtime"
+	"os/signal"
 	"strconv"
+	"strings"
 )
 
 // CommandLine defines commandline
@@ -27,131 +30,1052 @@ func (cli *CommandLine) PrintUsage() {
 
 	fmt.Println("printchain - Prints the blocks in the chain")
 
-	fmt.Println("send -from FROM -to TO -amount AMOUNT - Send amount of coins from one address to another")
+	fmt.Println("send -from FROM -to TO -amount AMOUNT [-fee FEE] [-mine] [-miner ADDRESS] [-workers N] [WALLET] - Send amount of coins from one address to another through the mempool, -mine also mines a block")
 
-	fmt.Println("createwallet - Creates a new wallet")
+	fmt.Println("mine -miner ADDRESS [-size BYTES] [-workers N] - Mines a block from the mempool, the miner gets the reward and fees")
 
-	fmt.Println("listaddresses - Lists the addresses in the wallet file")
+	fmt.Println("createwallet [-type p256|secp256k1|ed25519] [WALLET] - Creates the next address of the key type derived from the wallet mnemonic, creating the mnemonic when there is none")
+
+	fmt.Println("restorewallet -mnemonic MNEMONIC [-gap N] | -in FILE [WALLET] - Restores the addresses of a mnemonic that have activity in the chain, or the wallet from a backup")
+
+	fmt.Println("backupwallet -out FILE [WALLET] - Copies the wallet to FILE")
+
+	fmt.Println("encryptwallet [WALLET] - Encrypts the private keys of the wallets file with a passphrase")
+
+	fmt.Println("changepassphrase [WALLET] - Encrypts the wallets file with a new passphrase")
+
+	fmt.Println("unlock [WALLET] - Checks the wallet passphrase by decrypting the private keys")
+
+	fmt.Println("listaddresses [WALLET] - Lists the addresses in the wallet file")
+
+	fmt.Println("dumpprivkey -address ADDRESS [WALLET] - Prints the private key of ADDRESS")
+
+	fmt.Println("importprivkey -key KEY [WALLET] - Adds the address of a private key printed by dumpprivkey")
+
+	fmt.Println("importaddress -address ADDRESS [WALLET] - Watches ADDRESS without its private key")
+
+	fmt.Println("signmessage -address ADDRESS -message MESSAGE [WALLET] - Signs MESSAGE with the key of ADDRESS")
+
+	fmt.Println("verifymessage -address ADDRESS -signature SIGNATURE -message MESSAGE - Checks that MESSAGE was signed with the key of ADDRESS")
+
+	fmt.Println("getpubkey -address ADDRESS [WALLET] - Prints the public key of ADDRESS for createmultisig")
+
+	fmt.Println("createmultisig -m M -pubkeys KEY,KEY,... - Prints the address of M of the public keys and its script")
+
+	fmt.Println("createmultisigtx -script SCRIPT -to TO -amount AMOUNT [-fee FEE] -out FILE - Writes a transaction spending from the multisig of SCRIPT to FILE without signatures")
+
+	fmt.Println("signmultisigtx -in FILE [-out FILE] [WALLET] - Adds the signatures of the keys of the wallet to the multisig transaction in FILE")
+
+	fmt.Println("sendrawtx -in FILE - Adds the transaction in FILE to the mempool")
+
+	fmt.Println("listwallets [-walletdir DIR] - Lists the wallets in the wallet directory")
+
+	fmt.Println("reindexutxo - Rebuilds the UTXO set")
+
+	fmt.Println("getproof -txid TXID - Prints the merkle inclusion proof of a transaction")
+
+	fmt.Println("verifychain [-depth DEPTH] - Verifies the whole chain or only the last DEPTH blocks")
+
+	fmt.Println("supply - Prints the minted coins, the current subsidy and the next halving")
+
+	fmt.Println("getblock -height HEIGHT | -hash HASH - Prints a block by main chain height or by hash")
+
+	fmt.Println("gettx -id TXID - Prints a transaction of the main chain and the block holding it")
+
+	fmt.Println("migrate - Backs up the database and upgrades it to the current schema")
+
+	fmt.Println()
+	fmt.Println("WALLET is [-wallet NAME] [-walletdir DIR], selecting the wallet NAME, " + wallet.DefaultWalletName + " by default, in DIR, WALLET_DIR or " + wallet.DefaultWalletDir)
 }
 
 // ValidateArgs ensures the cli was given valid input
-func (cli *CommandLine) ValidateArgs() {
+func (cli *CommandLine) ValidateArgs() error {
 	if len(os.Args) < 2 {
 		cli.PrintUsage()
-		//go exit will exit the application by shutting down the goroutine
-		// if you were to use os.exit you might corrupt the data
-		runtime.Goexit()
+		return ErrUsage
 	}
+	return nil
 }
 
 // CreateBlockChain creates blockchain
-func (cli *CommandLine) CreateBlockChain(address string) {
+func (cli *CommandLine) CreateBlockChain(address string) error {
 	// Validates the address
-	if !wallet.ValidateAddress(address) {
-		log.Panic("Address is not Valid")
+	if _, err := wallet.DecodeAddress(address); err != nil {
+		return err
+	}
+	store, err := openStore(true)
+	if err != nil {
+		return err
 	}
+	defer store.Close()
+
 	// Initializes initial block chain
-	newChain := blockchain.InitBlockChain(address)
-	_ = newChain.Database.Close()
+	if _, err := blockchain.InitBlockChain(store, address); err != nil {
+		return err
+	}
+	fmt.Println("Genesis Created")
 	fmt.Println("Finished creating chain")
+	return nil
 }
 
 // GetBalance gets account balance
-func (cli *CommandLine) GetBalance(address string) {
+func (cli *CommandLine) GetBalance(address string) error {
 	// Validates the address
-	if !wallet.ValidateAddress(address) {
-		log.Panic("Address is not Valid")
+	pubKeyHash, err := wallet.DecodeAddress(address)
+	if err != nil {
+		return err
 	}
 
 	// Adds to an existing blockchain
-	chain := blockchain.ContinueBlockChain(address)
-	defer chain.Database.Close()
+	chain, err := openChain()
+	if err != nil {
+		return err
+	}
+	defer chain.Store.Close()
 
 	balance := 0
 
-	pubKeyHash := utils.Base58Decode([]byte(address))
-	pubKeyHash = pubKeyHash[1 : len(pubKeyHash)-4]
-
-	// Finds all transaction outputs
-	UTXOs := chain.FindUTXO(pubKeyHash)
+	// Finds all unspent outputs in the UTXO set
+	UTXOSet := blockchain.UTXOSet{BlockChain: chain}
+	UTXOs, err := UTXOSet.FindUTXO(pubKeyHash)
+	if err != nil {
+		return err
+	}
 
 	for _, out := range UTXOs {
 		balance += out.Value
 	}
 
 	fmt.Printf("Balance of %s: %d\n", address, balance)
+	return nil
 }
 
 // Send sends money to address
-func (cli *CommandLine) Send(from, to string, amount int) {
+// The transaction is added to the mempool. With mine set a block is mined
+// from the mempool right away, paying minerAddress or the sender when it is
+// empty
+func (cli *CommandLine) Send(walletFile, from, to string, amount, fee int, mine bool, minerAddress string, workers int) error {
 	// Validates the address
-	if !wallet.ValidateAddress(from) {
-		log.Panic("Address is not Valid")
+	if _, err := wallet.DecodeAddress(from); err != nil {
+		return err
 	}
 
 	// Validates the address
-	if !wallet.ValidateAddress(to) {
-		log.Panic("Address is not Valid")
+	if _, err := wallet.DecodeAddress(to); err != nil {
+		return err
+	}
+
+	if minerAddress == "" {
+		minerAddress = from
+	}
+	if _, err := wallet.DecodeAddress(minerAddress); err != nil {
+		return err
 	}
 
 	// Adds to an existing blockchain
-	chain := blockchain.ContinueBlockChain(from)
-	defer chain.Database.Close()
+	chain, err := openChain()
+	if err != nil {
+		return err
+	}
+	defer chain.Store.Close()
+
+	pool := mempool.Pool{BlockChain: chain}
+
+	tx, err := services.Txn.NewTransaction(walletFile, from, to, amount, fee, pool, walletPassphrase)
+	if err != nil {
+		return err
+	}
+	if err := pool.Add(tx); err != nil {
+		return err
+	}
+	fmt.Printf("Transaction %x added to the mempool\n", tx.ID)
+
+	if !mine {
+		return nil
+	}
+
+	return mineBlock(pool, minerAddress, mempool.DefaultBlockSize, workers)
+}
+
+// Mine mines a block from the mempool paying minerAddress
+func (cli *CommandLine) Mine(minerAddress string, size, workers int) error {
+	// Validates the address
+	if _, err := wallet.DecodeAddress(minerAddress); err != nil {
+		return err
+	}
+
+	chain, err := openChain()
+	if err != nil {
+		return err
+	}
+	defer chain.Store.Close()
+
+	return mineBlock(mempool.Pool{BlockChain: chain}, minerAddress, size, workers)
+}
+
+// mineBlock mines the best pending transactions fitting in size bytes
+// and brings the mempool in line with the new main chain
+func mineBlock(pool mempool.Pool, minerAddress string, size, workers int) error {
+	txs, err := pool.Select(size)
+	if err != nil {
+		return err
+	}
+
+	// Mines a new block until it is found or interrupted
+	ctx, cancel := interruptContext()
+	defer cancel()
+
+	chain := pool.BlockChain
+	chain.Miner = miner(workers)
+	chain.Miner.Address = minerAddress
+	block, update, err := chain.MineBlock(ctx, txs)
+	fmt.Println()
+	if err != nil {
+		return err
+	}
+
+	if err := pool.ApplyChainUpdate(update); err != nil {
+		return err
+	}
+
+	fmt.Printf("Mined block %d (%x) with %d transactions\n", block.Header.Height, block.Hash, len(txs))
+	return nil
+}
+
+// interruptContext returns a context cancelled on Ctrl-C
+func interruptContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt)
+	go func() {
+		select {
+		case <-sig:
+			cancel()
+		case <-ctx.Done():
+		}
+		signal.Stop(sig)
+	}()
 
-	tx := services.Txn.NewTransaction(from, to, amount, chain)
+	return ctx, cancel
+}
 
-	// Adds a new block to the block chain
-	chain.AddBlock([]*transactions.Transaction{tx})
-	fmt.Println("Success!")
+// miner returns a miner printing its hashrate
+func miner(workers int) blockchain.Miner {
+	m := blockchain.DefaultMiner()
+	if workers > 0 {
+		m.Workers = workers
+	}
+	m.OnHashrate = func(hashesPerSecond float64) {
+		fmt.Printf("\rMining with %d workers at %.0f hashes/s", m.Workers, hashesPerSecond)
+	}
+
+	return m
 }
 
 // PrintChain will display the entire contents of the blockchain
-func (cli *CommandLine) printChain() {
-	chain := blockchain.ContinueBlockChain("")
-	defer chain.Database.Close()
+func (cli *CommandLine) printChain() error {
+	chain, err := openChain()
+	if err != nil {
+		return err
+	}
+	defer chain.Store.Close()
 	iterator := chain.Iterator()
 
 	for {
-		block := iterator.Next()
-		fmt.Printf("Previous hash: %x\n", block.PrevHash)
-		fmt.Printf("hash: %x\n", block.Hash)
-		pow := blockchain.NewProofOfWork(block)
-		fmt.Printf("Pow: %s\n", strconv.FormatBool(pow.Validate()))
-		for _, tx := range block.Transactions {
-			fmt.Println(tx)
-		}
-		fmt.Println()
+		block, err := iterator.Next()
+		if err != nil {
+			return err
+		}
+		printBlock(chain, block)
 		// This works because the Genesis block has no PrevHash to point to.
-		if len(block.PrevHash) == 0 {
+		if block.IsGenesis() {
 			break
 		}
 	}
+	return nil
+}
+
+// printBlock displays a block and its transactions
+func printBlock(chain *blockchain.BlockChain, block *blockchain.Block) {
+	fmt.Printf("Hash:          %x\n", block.Hash)
+	fmt.Println(block.Header)
+	pow := blockchain.NewProofOfWork(block)
+	fmt.Printf("Pow:           %s\n", strconv.FormatBool(pow.Validate(chain)))
+	for _, tx := range block.Transactions {
+		fmt.Println(tx)
+	}
+	fmt.Println()
+}
+
+// GetBlock prints a main chain block by height, or by hash when hash is set
+func (cli *CommandLine) GetBlock(height int, hash string) error {
+	var blockHash []byte
+	if hash != "" {
+		var err error
+		if blockHash, err = hex.DecodeString(hash); err != nil {
+			return fmt.Errorf("%w: %s", ErrInvalidBlockHash, hash)
+		}
+	}
+
+	chain, err := openChain()
+	if err != nil {
+		return err
+	}
+	defer chain.Store.Close()
+
+	var block *blockchain.Block
+	if blockHash != nil {
+		block, err = chain.GetBlock(blockHash)
+	} else {
+		block, err = chain.GetBlockByHeight(height)
+	}
+	if err != nil {
+		return err
+	}
+
+	printBlock(chain, block)
+	return nil
+}
+
+// GetTx prints a main chain transaction and where it is stored
+func (cli *CommandLine) GetTx(txID string) error {
+	ID, err := hex.DecodeString(txID)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidTxID, txID)
+	}
+
+	chain, err := openChain()
+	if err != nil {
+		return err
+	}
+	defer chain.Store.Close()
+
+	location, err := chain.FindTransactionLocation(ID)
+	if err != nil {
+		return err
+	}
+
+	block, err := chain.GetBlock(location.BlockHash)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Block:    %x\n", block.Hash)
+	fmt.Printf("Height:   %d\n", block.Header.Height)
+	fmt.Printf("Position: %d\n", location.Position)
+	fmt.Println(block.Transactions[location.Position])
+	return nil
+}
+
+// ReindexUTXO rebuilds the UTXO set
+func (cli *CommandLine) ReindexUTXO() error {
+	chain, err := openChain()
+	if err != nil {
+		return err
+	}
+	defer chain.Store.Close()
+
+	UTXOSet := blockchain.UTXOSet{BlockChain: chain}
+	if err := UTXOSet.Reindex(); err != nil {
+		return err
+	}
+
+	count, err := UTXOSet.CountTransactions()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Done! There are %d transactions in the UTXO set.\n", count)
+	return nil
+}
+
+// GetProof prints the merkle inclusion proof of a transaction
+func (cli *CommandLine) GetProof(txID string) error {
+	ID, err := hex.DecodeString(txID)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidTxID, txID)
+	}
+
+	chain, err := openChain()
+	if err != nil {
+		return err
+	}
+	defer chain.Store.Close()
+
+	block, err := chain.FindTransactionBlock(ID)
+	if err != nil {
+		return err
+	}
+
+	proof, err := block.MerkleProof(ID)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Transaction: %x\n", proof.TxID)
+	fmt.Printf("Block:       %x\n", block.Hash)
+	fmt.Printf("Merkle root: %x\n", block.Header.MerkleRoot)
+	fmt.Printf("Index:       %d\n", proof.Index)
+	fmt.Println("Proof:")
+	for i, step := range proof.Steps {
+		side := "right"
+		if step.Left {
+			side = "left"
+		}
+		fmt.Printf("  %d: %-5s %x\n", i, side, step.Hash)
+	}
+	fmt.Printf("Valid: %s\n", strconv.FormatBool(blockchain.VerifyMerkleProof(block.Header.MerkleRoot, proof)))
+	return nil
+}
+
+// VerifyChain verifies the chain from genesis to the last block
+func (cli *CommandLine) VerifyChain(depth int) error {
+	chain, err := openChain()
+	if err != nil {
+		return err
+	}
+	defer chain.Store.Close()
+
+	checked, err := chain.Verify(blockchain.VerifyOptions{Depth: depth})
+	if err != nil {
+		fmt.Printf("Chain is invalid after %d valid blocks\n", checked)
+		return err
+	}
+
+	fmt.Printf("Chain is valid: %d blocks checked\n", checked)
+	return nil
+}
+
+// Supply prints the coins minted by the chain
+func (cli *CommandLine) Supply() error {
+	chain, err := openChain()
+	if err != nil {
+		return err
+	}
+	defer chain.Store.Close()
+
+	supply, err := chain.Supply()
+	if err != nil {
+		return err
+	}
+
+	nextHalving := "never"
+	if supply.NextHalving >= 0 {
+		nextHalving = strconv.Itoa(supply.NextHalving)
+	}
+
+	fmt.Printf("Height:       %d\n", supply.Height)
+	fmt.Printf("Minted:       %d of %d\n", supply.Minted, blockchain.Policy.MaxSupply)
+	fmt.Printf("Subsidy:      %d\n", supply.Subsidy)
+	fmt.Printf("Next halving: %s\n", nextHalving)
+	return nil
+}
+
+// Migrate upgrades the database to the current schema
+// The database directory is copied before anything is changed
+func (cli *CommandLine) Migrate() error {
+	store, err := openStore(false)
+	if err != nil {
+		return err
+	}
+	version, err := blockchain.GetSchemaVersion(store)
+	_ = store.Close()
+	if err != nil {
+		return err
+	}
+	if version == blockchain.SchemaVersion {
+		fmt.Printf("Database is up to date at schema version %d\n", version)
+		return nil
+	}
+	if version > blockchain.SchemaVersion {
+		return fmt.Errorf("%w: version %d, supported %d", blockchain.ErrSchemaTooNew, version, blockchain.SchemaVersion)
+	}
+
+	backup, err := backupStore()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Backed up the database to %s\n", backup)
+
+	store, err = openStore(false)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	count, err := blockchain.Migrate(store, func(m blockchain.Migration) {
+		fmt.Printf("Migrating to version %d: %s\n", m.Version, m.Description)
+	})
+	if err != nil {
+		return err
+	}
+
+	// Pending transactions stored with gob are converted with the chain
+	chain, err := blockchain.ContinueBlockChain(store)
+	if err != nil {
+		return err
+	}
+	if _, err := (mempool.Pool{BlockChain: chain}).MigrateGobEntries(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Done! Ran %d migrations, the database is at schema version %d\n", count, blockchain.SchemaVersion)
+	return nil
 }
 
 // ListAddresses lists all addresses
-func (cli *CommandLine) ListAddresses() {
-	wallets, _ := wallet.CreateWallets()
+func (cli *CommandLine) ListAddresses(walletFile string) error {
+	wallets, err := wallet.LoadWallets(walletFile)
+	if err != nil {
+		return err
+	}
 	addresses := wallets.GetAllAddresses()
 
 	for _, address := range addresses {
 		fmt.Println(address)
 	}
+	for _, address := range wallets.WatchOnlyAddresses() {
+		fmt.Printf("%s (watch-only)\n", address)
+	}
+
+	return nil
+}
+
+// DumpPrivKey prints the encoded private key of the address
+func (cli *CommandLine) DumpPrivKey(walletFile, address string) error {
+	if _, err := wallet.DecodeAddress(address); err != nil {
+		return err
+	}
+
+	wallets, err := wallet.LoadWallets(walletFile)
+	if err != nil {
+		return err
+	}
+	if err := unlockWallets(wallets); err != nil {
+		return err
+	}
+
+	key, err := wallets.DumpPrivateKey(address)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(key)
+	return nil
+}
+
+// SignMessage prints the signature of the message by the key of the address
+func (cli *CommandLine) SignMessage(walletFile, address, message string) error {
+	if _, err := wallet.DecodeAddress(address); err != nil {
+		return err
+	}
+
+	wallets, err := wallet.LoadWallets(walletFile)
+	if err != nil {
+		return err
+	}
+	if err := unlockWallets(wallets); err != nil {
+		return err
+	}
+
+	w, err := wallets.GetWallet(address)
+	if err != nil {
+		return err
+	}
+	signature, err := wallet.SignMessage(w.Signer(), []byte(message))
+	if err != nil {
+		return err
+	}
 
+	fmt.Println(signature)
+	return nil
 }
 
-// CreateWallet creates wallet
-func (cli *CommandLine) CreateWallet() {
-	wallets, _ := wallet.CreateWallets()
-	address := wallets.AddWallet()
-	wallets.SaveFile()
+// VerifyMessage checks the signature of the message by the key of the address
+func (cli *CommandLine) VerifyMessage(address, signature, message string) error {
+	if err := wallet.VerifyMessage(address, signature, []byte(message)); err != nil {
+		return err
+	}
+
+	fmt.Println("Signature is valid")
+	return nil
+}
+
+// GetPubKey prints the public key of the address
+func (cli *CommandLine) GetPubKey(walletFile, address string) error {
+	if _, err := wallet.DecodeAddress(address); err != nil {
+		return err
+	}
+
+	wallets, err := wallet.LoadWallets(walletFile)
+	if err != nil {
+		return err
+	}
+
+	publicKey, err := wallets.PublicKey(address)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%x\n", publicKey)
+	return nil
+}
+
+// CreateMultisig prints the address of m of the hex public keys and the
+// script spending from it needs
+func (cli *CommandLine) CreateMultisig(m int, publicKeys []string) error {
+	var keys [][]byte
+	for _, publicKey := range publicKeys {
+		key, err := hex.DecodeString(strings.TrimSpace(publicKey))
+		if err != nil {
+			return fmt.Errorf("%w: %q", ErrInvalidPublicKey, publicKey)
+		}
+		keys = append(keys, key)
+	}
+
+	ms, err := wallet.NewMultisig(m, keys)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Multisig address: %s\n", ms.Address())
+	fmt.Printf("Script: %x\n", ms.Script())
+	return nil
+}
+
+// CreateMultisigTx writes a transaction spending from the multisig of the
+// hex script to out
+// It has no signatures yet, see SignMultisigTx.
+func (cli *CommandLine) CreateMultisigTx(script, to string, amount, fee int, out string) error {
+	decoded, err := hex.DecodeString(script)
+	if err != nil {
+		return fmt.Errorf("%w: %v", wallet.ErrInvalidMultisig, err)
+	}
+	ms, err := wallet.ParseMultisig(decoded)
+	if err != nil {
+		return err
+	}
+
+	// Validates the address
+	if _, err := wallet.DecodeAddress(to); err != nil {
+		return err
+	}
+
+	chain, err := openChain()
+	if err != nil {
+		return err
+	}
+	defer chain.Store.Close()
+
+	tx, err := services.Txn.NewMultisigTransaction(ms, to, amount, fee, mempool.Pool{BlockChain: chain})
+	if err != nil {
+		return err
+	}
+	if err := writeTxFile(out, tx); err != nil {
+		return err
+	}
+
+	fmt.Printf("Transaction %x written to %s, it needs %d of %d signatures\n", tx.ID, out, ms.M, len(ms.PublicKeys))
+	return nil
+}
+
+// SignMultisigTx adds the signatures of the keys of the wallets file to the
+// multisig transaction in the file in and writes it to out
+func (cli *CommandLine) SignMultisigTx(walletFile, in, out string) error {
+	tx, err := readTxFile(in)
+	if err != nil {
+		return err
+	}
+
+	wallets, err := wallet.LoadWallets(walletFile)
+	if err != nil {
+		return err
+	}
+	if err := unlockWallets(wallets); err != nil {
+		return err
+	}
+
+	chain, err := openChain()
+	if err != nil {
+		return err
+	}
+	defer chain.Store.Close()
+
+	prevTXs, err := mempool.Pool{BlockChain: chain}.PrevTransactions(tx)
+	if err != nil {
+		return err
+	}
+
+	// Signs with every key of the wallets the multisig lists
+	listed := false
+	for _, address := range wallets.GetAllAddresses() {
+		w, err := wallets.GetWallet(address)
+		if err != nil {
+			return err
+		}
+		signed, err := tx.SignMultisig(w.Signer(), prevTXs)
+		if err != nil {
+			return err
+		}
+		if signed > 0 {
+			fmt.Printf("Signed with %s\n", address)
+		}
+		listed = listed || multisigLists(tx, w.PublicKey)
+	}
+	if !listed {
+		return wallet.ErrNotMultisigKey
+	}
+
+	// The ID covers the signatures
+	tx.SetID()
+	if err := writeTxFile(out, tx); err != nil {
+		return err
+	}
+
+	if tx.Verify(prevTXs) {
+		fmt.Printf("Transaction %x is fully signed, send it with sendrawtx\n", tx.ID)
+	} else {
+		fmt.Printf("Transaction %x needs more signatures\n", tx.ID)
+	}
+	return nil
+}
+
+// multisigLists reports whether a multisig input of the transaction lists
+// the public key
+func multisigLists(tx *transactions.Transaction, publicKey []byte) bool {
+	for _, in := range tx.Inputs {
+		ms, err := wallet.ParseMultisig(in.PubKey)
+		if err != nil {
+			continue
+		}
+		if ms.KeyIndex(publicKey) >= 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// SendRawTx adds the transaction in the file in to the mempool
+func (cli *CommandLine) SendRawTx(in string) error {
+	tx, err := readTxFile(in)
+	if err != nil {
+		return err
+	}
+
+	chain, err := openChain()
+	if err != nil {
+		return err
+	}
+	defer chain.Store.Close()
+
+	if err := (mempool.Pool{BlockChain: chain}).Add(tx); err != nil {
+		return err
+	}
+
+	fmt.Printf("Transaction %x added to the mempool\n", tx.ID)
+	return nil
+}
+
+// writeTxFile writes the transaction to path as hex
+func writeTxFile(path string, tx *transactions.Transaction) error {
+	return ioutil.WriteFile(path, []byte(hex.EncodeToString(tx.Serialize())+"\n"), 0644)
+}
+
+// readTxFile reads a transaction written by writeTxFile
+func readTxFile(path string) (*transactions.Transaction, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := hex.DecodeString(strings.TrimSpace(string(content)))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidTxFile, err)
+	}
+	tx, err := transactions.DeserializeTransaction(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidTxFile, err)
+	}
+
+	return &tx, nil
+}
+
+// ImportPrivKey adds the wallet of an encoded private key
+func (cli *CommandLine) ImportPrivKey(walletFile, key string) error {
+	wallets, err := wallet.CreateWallets(walletFile)
+	if err != nil {
+		return err
+	}
+	defer wallets.Close()
+	if err := unlockWallets(wallets); err != nil {
+		return err
+	}
+
+	address, err := wallets.ImportPrivateKey(key)
+	if err != nil {
+		return err
+	}
+	if err := wallets.SaveFile(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Imported address: %s\n", address)
+	return nil
+}
+
+// ImportAddress watches an address without its private key
+func (cli *CommandLine) ImportAddress(walletFile, address string) error {
+	wallets, err := wallet.CreateWallets(walletFile)
+	if err != nil {
+		return err
+	}
+	defer wallets.Close()
+	if err := unlockWallets(wallets); err != nil {
+		return err
+	}
+
+	if err := wallets.ImportAddress(address); err != nil {
+		return err
+	}
+	if err := wallets.SaveFile(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Watching address: %s\n", address)
+	return nil
+}
+
+// ListWallets lists the wallets in the wallet directory
+func (cli *CommandLine) ListWallets(dir string) error {
+	names, err := wallet.ListWallets(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		walletFile, err := wallet.WalletFile(dir, name)
+		if err != nil {
+			return err
+		}
+		wallets, err := wallet.LoadWallets(walletFile)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("%s: %d addresses\n", name, len(wallets.Wallets))
+	}
+
+	return nil
+}
+
+// CreateWallet creates the next derived address of the key type
+// Encrypted wallets files are unlocked to add it. A mnemonic is generated and
+// printed for wallets files without one.
+func (cli *CommandLine) CreateWallet(walletFile string, keyType wallet.KeyType) error {
+	wallets, err := wallet.CreateWallets(walletFile)
+	if err != nil {
+		return err
+	}
+	defer wallets.Close()
+	if err := unlockWallets(wallets); err != nil {
+		return err
+	}
+
+	if wallets.Mnemonic() == "" {
+		mnemonic, err := wallet.NewMnemonic()
+		if err != nil {
+			return err
+		}
+		if err := wallets.SetMnemonic(mnemonic); err != nil {
+			return err
+		}
+
+		fmt.Printf("New mnemonic, write it down to restore the wallet: %s\n", mnemonic)
+	}
+
+	address, err := wallets.AddWallet(keyType)
+	if err != nil {
+		return err
+	}
+	if err := wallets.SaveFile(); err != nil {
+		return err
+	}
 
 	fmt.Printf("New address is: %s\n", address)
 
+	return nil
+}
+
+// BackupWallet copies the wallets file to out
+func (cli *CommandLine) BackupWallet(walletFile, out string) error {
+	if err := wallet.BackupFile(walletFile, out); err != nil {
+		return err
+	}
+
+	fmt.Printf("Wallet backed up to %s\n", out)
+	return nil
+}
+
+// RestoreWalletFile replaces the wallets file with a backup
+// The replaced file is kept with the other automatic backups
+func (cli *CommandLine) RestoreWalletFile(walletFile, in string) error {
+	wallets, err := wallet.CreateWallets(walletFile)
+	if err != nil {
+		return err
+	}
+	defer wallets.Close()
+
+	if err := wallets.RestoreFile(in); err != nil {
+		return err
+	}
+
+	fmt.Printf("Restored %d addresses from %s\n", len(wallets.Wallets), in)
+	return nil
+}
+
+// RestoreWallet adds the addresses derived from the mnemonic that have
+// activity in the chain
+func (cli *CommandLine) RestoreWallet(walletFile, mnemonic string, gap int) error {
+	wallets, err := wallet.CreateWallets(walletFile)
+	if err != nil {
+		return err
+	}
+	defer wallets.Close()
+	if err := unlockWallets(wallets); err != nil {
+		return err
+	}
+
+	chain, err := openChain()
+	if err != nil {
+		return err
+	}
+	defer chain.Store.Close()
+
+	// An address is used when a transaction of the chain pays or spends it
+	used := func(address string) (bool, error) {
+		pubKeyHash, err := wallet.DecodeAddress(address)
+		if err != nil {
+			return false, err
+		}
+		txIDs, err := chain.FindAddressTransactions(pubKeyHash)
+
+		return len(txIDs) > 0, err
+	}
+
+	addresses, err := wallets.Restore(mnemonic, gap, used)
+	if err != nil {
+		return err
+	}
+	if err := wallets.SaveFile(); err != nil {
+		return err
+	}
+
+	for _, address := range addresses {
+		fmt.Println(address)
+	}
+	fmt.Printf("Restored %d addresses\n", len(addresses))
+
+	return nil
+}
+
+// EncryptWallet encrypts the private keys of the wallets file
+func (cli *CommandLine) EncryptWallet(walletFile string) error {
+	wallets, err := wallet.CreateWallets(walletFile)
+	if err != nil {
+		return err
+	}
+	defer wallets.Close()
+	if wallets.IsEncrypted() {
+		return wallet.ErrWalletEncrypted
+	}
+
+	passphrase, err := newWalletPassphrase()
+	if err != nil {
+		return err
+	}
+	if err := wallets.Encrypt(passphrase); err != nil {
+		return err
+	}
+	if err := wallets.SaveFile(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Encrypted %d wallets\n", len(wallets.Wallets))
+	return nil
+}
+
+// ChangePassphrase encrypts the wallets file with a new passphrase
+func (cli *CommandLine) ChangePassphrase(walletFile string) error {
+	wallets, err := wallet.CreateWallets(walletFile)
+	if err != nil {
+		return err
+	}
+	defer wallets.Close()
+	if !wallets.IsEncrypted() {
+		return wallet.ErrWalletNotEncrypted
+	}
+
+	current, err := walletPassphrase()
+	if err != nil {
+		return err
+	}
+	passphrase, err := newWalletPassphrase()
+	if err != nil {
+		return err
+	}
+	if err := wallets.ChangePassphrase(current, passphrase); err != nil {
+		return err
+	}
+	if err := wallets.SaveFile(); err != nil {
+		return err
+	}
+
+	fmt.Println("Passphrase changed")
+	return nil
+}
+
+// Unlock checks the wallet passphrase
+func (cli *CommandLine) Unlock(walletFile string) error {
+	wallets, err := wallet.LoadWallets(walletFile)
+	if err != nil {
+		return err
+	}
+	if !wallets.IsEncrypted() {
+		return wallet.ErrWalletNotEncrypted
+	}
+	if err := unlockWallets(wallets); err != nil {
+		return err
+	}
+
+	fmt.Printf("Unlocked %d wallets\n", len(wallets.Wallets))
+	return nil
+}
+
+// unlockWallets asks for the passphrase of locked wallets
+func unlockWallets(wallets *wallet.Wallets) error {
+	if !wallets.IsLocked() {
+		return nil
+	}
+
+	passphrase, err := walletPassphrase()
+	if err != nil {
+		return err
+	}
+
+	return wallets.Unlock(passphrase)
 }
 
 // Run will start up the command line
-func (cli *CommandLine) Run() {
-	cli.ValidateArgs()
+func (cli *CommandLine) Run() error {
+	if err := cli.ValidateArgs(); err != nil {
+		return err
+	}
+
+	// Reads difficulty parameters from the environment
+	if err := loadParams(); err != nil {
+		return err
+	}
 
 	getBalanceCmd := flag.NewFlagSet("getbalance", flag.ExitOnError)
 	createBlockchainCmd := flag.NewFlagSet("createblockchain", flag.ExitOnError)
@@ -159,81 +1083,401 @@ func (cli *CommandLine) Run() {
 	printChainCmd := flag.NewFlagSet("printchain", flag.ExitOnError)
 	createWalletCmd := flag.NewFlagSet("createwallet", flag.ExitOnError)   // this Cmd is new
 	listAddressesCmd := flag.NewFlagSet("listaddresses", flag.ExitOnError) // this Cmd is new
+	reindexUTXOCmd := flag.NewFlagSet("reindexutxo", flag.ExitOnError)
+	getProofCmd := flag.NewFlagSet("getproof", flag.ExitOnError)
+	verifyChainCmd := flag.NewFlagSet("verifychain", flag.ExitOnError)
+	mineCmd := flag.NewFlagSet("mine", flag.ExitOnError)
+	supplyCmd := flag.NewFlagSet("supply", flag.ExitOnError)
+	getBlockCmd := flag.NewFlagSet("getblock", flag.ExitOnError)
+	getTxCmd := flag.NewFlagSet("gettx", flag.ExitOnError)
+	migrateCmd := flag.NewFlagSet("migrate", flag.ExitOnError)
+	restoreWalletCmd := flag.NewFlagSet("restorewallet", flag.ExitOnError)
+	backupWalletCmd := flag.NewFlagSet("backupwallet", flag.ExitOnError)
+	dumpPrivKeyCmd := flag.NewFlagSet("dumpprivkey", flag.ExitOnError)
+	importPrivKeyCmd := flag.NewFlagSet("importprivkey", flag.ExitOnError)
+	importAddressCmd := flag.NewFlagSet("importaddress", flag.ExitOnError)
+	signMessageCmd := flag.NewFlagSet("signmessage", flag.ExitOnError)
+	verifyMessageCmd := flag.NewFlagSet("verifymessage", flag.ExitOnError)
+	encryptWalletCmd := flag.NewFlagSet("encryptwallet", flag.ExitOnError)
+	changePassphraseCmd := flag.NewFlagSet("changepassphrase", flag.ExitOnError)
+	unlockCmd := flag.NewFlagSet("unlock", flag.ExitOnError)
+	listWalletsCmd := flag.NewFlagSet("listwallets", flag.ExitOnError)
+	getPubKeyCmd := flag.NewFlagSet("getpubkey", flag.ExitOnError)
+	createMultisigCmd := flag.NewFlagSet("createmultisig", flag.ExitOnError)
+	createMultisigTxCmd := flag.NewFlagSet("createmultisigtx", flag.ExitOnError)
+	signMultisigTxCmd := flag.NewFlagSet("signmultisigtx", flag.ExitOnError)
+	sendRawTxCmd := flag.NewFlagSet("sendrawtx", flag.ExitOnError)
 
 	getBalanceAddress := getBalanceCmd.String("address", "", "The address to get balance for")
 	createBlockchainAddress := createBlockchainCmd.String("address", "", "The address to send genesis block reward to")
 	sendFrom := sendCmd.String("from", "", "Source wallet address")
 	sendTo := sendCmd.String("to", "", "Destination wallet address")
 	sendAmount := sendCmd.Int("amount", 0, "Amount to send")
+	sendFee := sendCmd.Int("fee", 0, "Fee paid to the miner")
+	sendMine := sendCmd.Bool("mine", false, "Mine a block from the mempool after sending")
+	sendMiner := sendCmd.String("miner", "", "Address receiving the block reward and fees with -mine, defaults to the sender")
+	sendWorkers := sendCmd.Int("workers", 0, "Number of mining goroutines, defaults to the number of CPUs")
+	getProofTxID := getProofCmd.String("txid", "", "The transaction to prove")
+	verifyChainDepth := verifyChainCmd.Int("depth", 0, "Number of most recent blocks to check, 0 checks all")
+	mineMiner := mineCmd.String("miner", "", "Address receiving the block reward and fees")
+	mineSize := mineCmd.Int("size", mempool.DefaultBlockSize, "Maximum size in bytes of the mined transactions")
+	mineWorkers := mineCmd.Int("workers", 0, "Number of mining goroutines, defaults to the number of CPUs")
+	getBlockHeight := getBlockCmd.Int("height", -1, "Height of the block in the main chain")
+	getBlockHash := getBlockCmd.String("hash", "", "Hash of the block")
+	getTxID := getTxCmd.String("id", "", "The transaction to print")
+	createWalletType := createWalletCmd.String("type", wallet.DefaultKeyType.String(), "Key type of the address, p256, secp256k1 or ed25519")
+	restoreWalletMnemonic := restoreWalletCmd.String("mnemonic", "", "The mnemonic to restore addresses from")
+	restoreWalletGap := restoreWalletCmd.Int("gap", wallet.DefaultGapLimit, "Number of unused addresses in a row that ends the scan")
+	restoreWalletIn := restoreWalletCmd.String("in", "", "The backup to restore the wallet from")
+	backupWalletOut := backupWalletCmd.String("out", "", "The file to copy the wallet to")
+	dumpPrivKeyAddress := dumpPrivKeyCmd.String("address", "", "The address to print the private key of")
+	importPrivKeyKey := importPrivKeyCmd.String("key", "", "The private key to import")
+	importAddressAddress := importAddressCmd.String("address", "", "The address to watch")
+	signMessageAddress := signMessageCmd.String("address", "", "The address to sign with")
+	signMessageMessage := signMessageCmd.String("message", "", "The message to sign")
+	verifyMessageAddress := verifyMessageCmd.String("address", "", "The address that signed")
+	verifyMessageSignature := verifyMessageCmd.String("signature", "", "The signature printed by signmessage")
+	verifyMessageMessage := verifyMessageCmd.String("message", "", "The signed message")
+	getPubKeyAddress := getPubKeyCmd.String("address", "", "The address to print the public key of")
+	createMultisigM := createMultisigCmd.Int("m", 0, "Number of signatures needed")
+	createMultisigPubKeys := createMultisigCmd.String("pubkeys", "", "Comma separated hex public keys, see getpubkey")
+	createMultisigTxScript := createMultisigTxCmd.String("script", "", "Hex script printed by createmultisig")
+	createMultisigTxTo := createMultisigTxCmd.String("to", "", "Destination wallet address")
+	createMultisigTxAmount := createMultisigTxCmd.Int("amount", 0, "Amount to send")
+	createMultisigTxFee := createMultisigTxCmd.Int("fee", 0, "Fee paid to the miner")
+	createMultisigTxOut := createMultisigTxCmd.String("out", "", "The file to write the transaction to")
+	signMultisigTxIn := signMultisigTxCmd.String("in", "", "The file of the transaction to sign")
+	signMultisigTxOut := signMultisigTxCmd.String("out", "", "The file to write the signed transaction to, defaults to -in")
+	sendRawTxIn := sendRawTxCmd.String("in", "", "The file of the transaction to send")
+	sendWallet := addWalletFlags(sendCmd)
+	createWalletWallet := addWalletFlags(createWalletCmd)
+	listAddressesWallet := addWalletFlags(listAddressesCmd)
+	restoreWalletWallet := addWalletFlags(restoreWalletCmd)
+	encryptWalletWallet := addWalletFlags(encryptWalletCmd)
+	changePassphraseWallet := addWalletFlags(changePassphraseCmd)
+	unlockWallet := addWalletFlags(unlockCmd)
+	backupWalletWallet := addWalletFlags(backupWalletCmd)
+	dumpPrivKeyWallet := addWalletFlags(dumpPrivKeyCmd)
+	importPrivKeyWallet := addWalletFlags(importPrivKeyCmd)
+	importAddressWallet := addWalletFlags(importAddressCmd)
+	signMessageWallet := addWalletFlags(signMessageCmd)
+	getPubKeyWallet := addWalletFlags(getPubKeyCmd)
+	signMultisigTxWallet := addWalletFlags(signMultisigTxCmd)
+	listWalletsDir := addWalletDirFlag(listWalletsCmd)
+
+	var err error
 
 	switch os.Args[1] {
 	case "getbalance":
-		err := getBalanceCmd.Parse(os.Args[2:])
-		if err != nil {
-			log.Panic(err)
-		}
+		err = getBalanceCmd.Parse(os.Args[2:])
 	case "createblockchain":
-		err := createBlockchainCmd.Parse(os.Args[2:])
-		if err != nil {
-			log.Panic(err)
-		}
+		err = createBlockchainCmd.Parse(os.Args[2:])
 	case "printchain":
-		err := printChainCmd.Parse(os.Args[2:])
-		if err != nil {
-			log.Panic(err)
-		}
+		err = printChainCmd.Parse(os.Args[2:])
 	case "send":
-		err := sendCmd.Parse(os.Args[2:])
-		if err != nil {
-			log.Panic(err)
-		}
+		err = sendCmd.Parse(os.Args[2:])
 	case "listaddresses": // this case statement is new
-		err := listAddressesCmd.Parse(os.Args[2:])
-		if err != nil {
-			log.Panic(err)
-		}
+		err = listAddressesCmd.Parse(os.Args[2:])
 	case "createwallet": // this case statement is new
-		err := createWalletCmd.Parse(os.Args[2:])
-		if err != nil {
-			log.Panic(err)
-		}
+		err = createWalletCmd.Parse(os.Args[2:])
+	case "reindexutxo":
+		err = reindexUTXOCmd.Parse(os.Args[2:])
+	case "getproof":
+		err = getProofCmd.Parse(os.Args[2:])
+	case "verifychain":
+		err = verifyChainCmd.Parse(os.Args[2:])
+	case "supply":
+		err = supplyCmd.Parse(os.Args[2:])
+	case "mine":
+		err = mineCmd.Parse(os.Args[2:])
+	case "getblock":
+		err = getBlockCmd.Parse(os.Args[2:])
+	case "gettx":
+		err = getTxCmd.Parse(os.Args[2:])
+	case "migrate":
+		err = migrateCmd.Parse(os.Args[2:])
+	case "restorewallet":
+		err = restoreWalletCmd.Parse(os.Args[2:])
+	case "backupwallet":
+		err = backupWalletCmd.Parse(os.Args[2:])
+	case "dumpprivkey":
+		err = dumpPrivKeyCmd.Parse(os.Args[2:])
+	case "importprivkey":
+		err = importPrivKeyCmd.Parse(os.Args[2:])
+	case "importaddress":
+		err = importAddressCmd.Parse(os.Args[2:])
+	case "signmessage":
+		err = signMessageCmd.Parse(os.Args[2:])
+	case "verifymessage":
+		err = verifyMessageCmd.Parse(os.Args[2:])
+	case "encryptwallet":
+		err = encryptWalletCmd.Parse(os.Args[2:])
+	case "changepassphrase":
+		err = changePassphraseCmd.Parse(os.Args[2:])
+	case "unlock":
+		err = unlockCmd.Parse(os.Args[2:])
+	case "listwallets":
+		err = listWalletsCmd.Parse(os.Args[2:])
+	case "getpubkey":
+		err = getPubKeyCmd.Parse(os.Args[2:])
+	case "createmultisig":
+		err = createMultisigCmd.Parse(os.Args[2:])
+	case "createmultisigtx":
+		err = createMultisigTxCmd.Parse(os.Args[2:])
+	case "signmultisigtx":
+		err = signMultisigTxCmd.Parse(os.Args[2:])
+	case "sendrawtx":
+		err = sendRawTxCmd.Parse(os.Args[2:])
 	default:
 		cli.PrintUsage()
-		runtime.Goexit()
+		return ErrUsage
+	}
+	if err != nil {
+		return err
 	}
 
 	if getBalanceCmd.Parsed() {
 		if *getBalanceAddress == "" {
 			getBalanceCmd.Usage()
-			runtime.Goexit()
+			return ErrUsage
 		}
-		cli.GetBalance(*getBalanceAddress)
+		return cli.GetBalance(*getBalanceAddress)
 	}
 
 	if createBlockchainCmd.Parsed() {
 		if *createBlockchainAddress == "" {
 			createBlockchainCmd.Usage()
-			runtime.Goexit()
+			return ErrUsage
 		}
-		cli.CreateBlockChain(*createBlockchainAddress)
+		return cli.CreateBlockChain(*createBlockchainAddress)
 	}
 
 	if printChainCmd.Parsed() {
-		cli.printChain()
+		return cli.printChain()
 	}
 
 	if sendCmd.Parsed() {
-		if *sendFrom == "" || *sendTo == "" || *sendAmount <= 0 {
+		if *sendFrom == "" || *sendTo == "" || *sendAmount <= 0 || *sendFee < 0 {
 			sendCmd.Usage()
-			runtime.Goexit()
+			return ErrUsage
 		}
-
-		cli.Send(*sendFrom, *sendTo, *sendAmount)
+		walletFile, err := sendWallet.file()
+		if err != nil {
+			return err
+		}
+		return cli.Send(walletFile, *sendFrom, *sendTo, *sendAmount, *sendFee, *sendMine, *sendMiner, *sendWorkers)
 	}
 	if listAddressesCmd.Parsed() {
-		cli.ListAddresses()
+		walletFile, err := listAddressesWallet.file()
+		if err != nil {
+			return err
+		}
+		return cli.ListAddresses(walletFile)
 	}
 	if createWalletCmd.Parsed() {
-		cli.CreateWallet()
+		walletFile, err := createWalletWallet.file()
+		if err != nil {
+			return err
+		}
+		keyType, err := wallet.ParseKeyType(*createWalletType)
+		if err != nil {
+			return err
+		}
+		return cli.CreateWallet(walletFile, keyType)
+	}
+	if reindexUTXOCmd.Parsed() {
+		return cli.ReindexUTXO()
+	}
+	if getProofCmd.Parsed() {
+		if *getProofTxID == "" {
+			getProofCmd.Usage()
+			return ErrUsage
+		}
+		return cli.GetProof(*getProofTxID)
+	}
+	if verifyChainCmd.Parsed() {
+		if *verifyChainDepth < 0 {
+			verifyChainCmd.Usage()
+			return ErrUsage
+		}
+		return cli.VerifyChain(*verifyChainDepth)
+	}
+	if supplyCmd.Parsed() {
+		return cli.Supply()
+	}
+	if mineCmd.Parsed() {
+		if *mineMiner == "" || *mineSize < 0 {
+			mineCmd.Usage()
+			return ErrUsage
+		}
+		return cli.Mine(*mineMiner, *mineSize, *mineWorkers)
+	}
+	if getBlockCmd.Parsed() {
+		// Exactly one of height and hash selects the block
+		if (*getBlockHeight < 0) == (*getBlockHash == "") {
+			getBlockCmd.Usage()
+			return ErrUsage
+		}
+		return cli.GetBlock(*getBlockHeight, *getBlockHash)
+	}
+	if getTxCmd.Parsed() {
+		if *getTxID == "" {
+			getTxCmd.Usage()
+			return ErrUsage
+		}
+		return cli.GetTx(*getTxID)
+	}
+	if migrateCmd.Parsed() {
+		return cli.Migrate()
 	}
+	if restoreWalletCmd.Parsed() {
+		// Exactly one of mnemonic and in is restored from
+		if (*restoreWalletMnemonic == "") == (*restoreWalletIn == "") || *restoreWalletGap <= 0 {
+			restoreWalletCmd.Usage()
+			return ErrUsage
+		}
+		walletFile, err := restoreWalletWallet.file()
+		if err != nil {
+			return err
+		}
+		if *restoreWalletIn != "" {
+			return cli.RestoreWalletFile(walletFile, *restoreWalletIn)
+		}
+		return cli.RestoreWallet(walletFile, *restoreWalletMnemonic, *restoreWalletGap)
+	}
+	if backupWalletCmd.Parsed() {
+		if *backupWalletOut == "" {
+			backupWalletCmd.Usage()
+			return ErrUsage
+		}
+		walletFile, err := backupWalletWallet.file()
+		if err != nil {
+			return err
+		}
+		return cli.BackupWallet(walletFile, *backupWalletOut)
+	}
+	if dumpPrivKeyCmd.Parsed() {
+		if *dumpPrivKeyAddress == "" {
+			dumpPrivKeyCmd.Usage()
+			return ErrUsage
+		}
+		walletFile, err := dumpPrivKeyWallet.file()
+		if err != nil {
+			return err
+		}
+		return cli.DumpPrivKey(walletFile, *dumpPrivKeyAddress)
+	}
+	if importPrivKeyCmd.Parsed() {
+		if *importPrivKeyKey == "" {
+			importPrivKeyCmd.Usage()
+			return ErrUsage
+		}
+		walletFile, err := importPrivKeyWallet.file()
+		if err != nil {
+			return err
+		}
+		return cli.ImportPrivKey(walletFile, *importPrivKeyKey)
+	}
+	if importAddressCmd.Parsed() {
+		if *importAddressAddress == "" {
+			importAddressCmd.Usage()
+			return ErrUsage
+		}
+		walletFile, err := importAddressWallet.file()
+		if err != nil {
+			return err
+		}
+		return cli.ImportAddress(walletFile, *importAddressAddress)
+	}
+	if signMessageCmd.Parsed() {
+		if *signMessageAddress == "" {
+			signMessageCmd.Usage()
+			return ErrUsage
+		}
+		walletFile, err := signMessageWallet.file()
+		if err != nil {
+			return err
+		}
+		return cli.SignMessage(walletFile, *signMessageAddress, *signMessageMessage)
+	}
+	if verifyMessageCmd.Parsed() {
+		if *verifyMessageAddress == "" || *verifyMessageSignature == "" {
+			verifyMessageCmd.Usage()
+			return ErrUsage
+		}
+		return cli.VerifyMessage(*verifyMessageAddress, *verifyMessageSignature, *verifyMessageMessage)
+	}
+	if encryptWalletCmd.Parsed() {
+		walletFile, err := encryptWalletWallet.file()
+		if err != nil {
+			return err
+		}
+		return cli.EncryptWallet(walletFile)
+	}
+	if changePassphraseCmd.Parsed() {
+		walletFile, err := changePassphraseWallet.file()
+		if err != nil {
+			return err
+		}
+		return cli.ChangePassphrase(walletFile)
+	}
+	if unlockCmd.Parsed() {
+		walletFile, err := unlockWallet.file()
+		if err != nil {
+			return err
+		}
+		return cli.Unlock(walletFile)
+	}
+	if listWalletsCmd.Parsed() {
+		return cli.ListWallets(walletDir(*listWalletsDir))
+	}
+	if getPubKeyCmd.Parsed() {
+		if *getPubKeyAddress == "" {
+			getPubKeyCmd.Usage()
+			return ErrUsage
+		}
+		walletFile, err := getPubKeyWallet.file()
+		if err != nil {
+			return err
+		}
+		return cli.GetPubKey(walletFile, *getPubKeyAddress)
+	}
+	if createMultisigCmd.Parsed() {
+		if *createMultisigM <= 0 || *createMultisigPubKeys == "" {
+			createMultisigCmd.Usage()
+			return ErrUsage
+		}
+		return cli.CreateMultisig(*createMultisigM, strings.Split(*createMultisigPubKeys, ","))
+	}
+	if createMultisigTxCmd.Parsed() {
+		if *createMultisigTxScript == "" || *createMultisigTxTo == "" || *createMultisigTxAmount <= 0 ||
+			*createMultisigTxFee < 0 || *createMultisigTxOut == "" {
+			createMultisigTxCmd.Usage()
+			return ErrUsage
+		}
+		return cli.CreateMultisigTx(*createMultisigTxScript, *createMultisigTxTo, *createMultisigTxAmount, *createMultisigTxFee, *createMultisigTxOut)
+	}
+	if signMultisigTxCmd.Parsed() {
+		if *signMultisigTxIn == "" {
+			signMultisigTxCmd.Usage()
+			return ErrUsage
+		}
+		if *signMultisigTxOut == "" {
+			*signMultisigTxOut = *signMultisigTxIn
+		}
+		walletFile, err := signMultisigTxWallet.file()
+		if err != nil {
+			return err
+		}
+		return cli.SignMultisigTx(walletFile, *signMultisigTxIn, *signMultisigTxOut)
+	}
+	if sendRawTxCmd.Parsed() {
+		if *sendRawTxIn == "" {
+			sendRawTxCmd.Usage()
+			return ErrUsage
+		}
+		return cli.SendRawTx(*sendRawTxIn)
+	}
+
+	return nil
 }
@@ -0,0 +1,176 @@
+package cli
+
+import (
+	"digitalWallet/blockchain"
+	"digitalWallet/wallet"
+	"flag"
+	"fmt"
+	"github.com/joho/godotenv"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+func init() {
+	// Load .env file
+	e := godotenv.Load()
+	if e != nil {
+		log.Println(e)
+	}
+}
+
+// openStore opens the Badger chain store at BADGE_DB
+// Unless create is set the database must already exist
+func openStore(create bool) (*blockchain.BadgerStore, error) {
+	return blockchain.OpenBadgerStore(blockchain.BadgerOptions{
+		Path:      os.Getenv("BADGE_DB"),
+		MustExist: !create,
+	})
+}
+
+// openChain opens the store and loads the existing blockchain
+func openChain() (*blockchain.BlockChain, error) {
+	store, err := openStore(false)
+	if err != nil {
+		return nil, err
+	}
+
+	chain, err := blockchain.ContinueBlockChain(store)
+	if err != nil {
+		_ = store.Close()
+		return nil, err
+	}
+
+	return chain, nil
+}
+
+// walletFlags selects the wallet a command uses
+type walletFlags struct {
+	dir  *string
+	name *string
+}
+
+// addWalletFlags adds -walletdir and -wallet to the flag set
+func addWalletFlags(fs *flag.FlagSet) walletFlags {
+	return walletFlags{
+		dir:  addWalletDirFlag(fs),
+		name: fs.String("wallet", wallet.DefaultWalletName, "Name of the wallet"),
+	}
+}
+
+// addWalletDirFlag adds -walletdir to the flag set
+func addWalletDirFlag(fs *flag.FlagSet) *string {
+	return fs.String("walletdir", "", "Directory of the wallets, defaults to WALLET_DIR or "+wallet.DefaultWalletDir)
+}
+
+// walletDir gets the wallet directory from the flag value, WALLET_DIR or
+// the default
+func walletDir(dir string) string {
+	if dir != "" {
+		return dir
+	}
+	if env := os.Getenv("WALLET_DIR"); env != "" {
+		return env
+	}
+
+	return wallet.DefaultWalletDir
+}
+
+// file gets the path of the selected wallets file
+func (f walletFlags) file() (string, error) {
+	return wallet.WalletFile(walletDir(*f.dir), *f.name)
+}
+
+// backupStore copies the database directory at BADGE_DB next to it
+// The store must be closed. It returns the directory of the copy.
+func backupStore() (string, error) {
+	src := filepath.Clean(os.Getenv("BADGE_DB"))
+	dst := fmt.Sprintf("%s-backup-%s", src, time.Now().UTC().Format("20060102T150405"))
+
+	err := filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		if info.IsDir() {
+			return os.MkdirAll(target, info.Mode())
+		}
+		return copyFile(path, target, info.Mode())
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return dst, nil
+}
+
+// copyFile copies the file at src to dst
+func copyFile(src, dst string, mode os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_EXCL|os.O_WRONLY, mode)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		_ = out.Close()
+		return err
+	}
+
+	return out.Close()
+}
+
+// loadParams reads difficulty and monetary parameters from the environment
+// TARGET_BLOCK_TIME is a duration such as 30s, RETARGET_INTERVAL a block count,
+// INITIAL_SUBSIDY, HALVING_INTERVAL and MAX_SUPPLY are numbers
+func loadParams() error {
+	if spacing := os.Getenv("TARGET_BLOCK_TIME"); spacing != "" {
+		d, err := time.ParseDuration(spacing)
+		if err != nil {
+			return fmt.Errorf("TARGET_BLOCK_TIME: %w", err)
+		}
+		blockchain.Params.TargetSpacing = d
+	}
+
+	if interval := os.Getenv("RETARGET_INTERVAL"); interval != "" {
+		n, err := strconv.Atoi(interval)
+		if err != nil {
+			return fmt.Errorf("RETARGET_INTERVAL: %w", err)
+		}
+		blockchain.Params.RetargetInterval = n
+	}
+
+	policy := map[string]*int{
+		"INITIAL_SUBSIDY":  &blockchain.Policy.InitialSubsidy,
+		"HALVING_INTERVAL": &blockchain.Policy.HalvingInterval,
+		"MAX_SUPPLY":       &blockchain.Policy.MaxSupply,
+	}
+	for name, value := range policy {
+		if env := os.Getenv(name); env != "" {
+			n, err := strconv.Atoi(env)
+			if err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			if n < 0 {
+				return fmt.Errorf("%s: must not be negative", name)
+			}
+			*value = n
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,94 @@
+package cli
+
+import (
+	"digitalWallet/blockchain"
+	"digitalWallet/services"
+	"digitalWallet/wallet"
+	"errors"
+)
+
+// Defines command line errors
+var (
+	// ErrUsage is returned when the command line arguments are invalid
+	// Usage has already been printed when it is returned
+	ErrUsage = errors.New("invalid usage")
+
+	// ErrInvalidTxID is returned for transaction IDs that are not hex
+	ErrInvalidTxID = errors.New("transaction ID is not valid")
+
+	// ErrInvalidBlockHash is returned for block hashes that are not hex
+	ErrInvalidBlockHash = errors.New("block hash is not valid")
+
+	// ErrPassphraseMismatch is returned when a new passphrase is repeated differently
+	ErrPassphraseMismatch = errors.New("passphrases do not match")
+
+	// ErrInvalidPublicKey is returned for public keys that are not hex
+	ErrInvalidPublicKey = errors.New("public key is not valid")
+
+	// ErrInvalidTxFile is returned for transaction files that fail to decode
+	ErrInvalidTxFile = errors.New("transaction file is not valid")
+)
+
+// Defines exit codes
+const (
+	ExitOK                = 0
+	ExitFailure           = 1
+	ExitUsage             = 2
+	ExitInvalidAddress    = 3
+	ExitInsufficientFunds = 4
+	ExitChainNotFound     = 5
+	ExitWalletNotFound    = 6
+	ExitTxNotFound        = 7
+	ExitInvalidChain      = 8
+	ExitBlockNotFound     = 9
+	ExitSchemaMismatch    = 10
+	ExitWalletLocked      = 11
+	ExitInvalidSignature  = 12
+	ExitChainExists       = 13
+	ExitWatchOnly         = 14
+	ExitNotMultisigKey    = 15
+)
+
+// ExitCode maps an error returned by Run to the process exit code
+func ExitCode(err error) int {
+	var verificationErr *blockchain.VerificationError
+
+	switch {
+	case err == nil:
+		return ExitOK
+	case errors.Is(err, ErrUsage), errors.Is(err, ErrInvalidTxID), errors.Is(err, ErrInvalidBlockHash),
+		errors.Is(err, wallet.ErrInvalidMnemonic), errors.Is(err, wallet.ErrInvalidWalletName),
+		errors.Is(err, wallet.ErrInvalidPrivateKey), errors.Is(err, wallet.ErrUnknownKeyType),
+		errors.Is(err, ErrInvalidPublicKey), errors.Is(err, ErrInvalidTxFile), errors.Is(err, wallet.ErrInvalidMultisig):
+		return ExitUsage
+	case errors.Is(err, wallet.ErrInvalidAddress):
+		return ExitInvalidAddress
+	case errors.Is(err, services.ErrInsufficientFunds):
+		return ExitInsufficientFunds
+	case errors.Is(err, blockchain.ErrChainNotFound):
+		return ExitChainNotFound
+	case errors.Is(err, blockchain.ErrChainExists):
+		return ExitChainExists
+	case errors.Is(err, wallet.ErrWalletNotFound):
+		return ExitWalletNotFound
+	case errors.Is(err, wallet.ErrWatchOnly):
+		return ExitWatchOnly
+	case errors.Is(err, wallet.ErrNotMultisigKey):
+		return ExitNotMultisigKey
+	case errors.Is(err, wallet.ErrWalletLocked), errors.Is(err, wallet.ErrBadPassphrase),
+		errors.Is(err, ErrPassphraseMismatch):
+		return ExitWalletLocked
+	case errors.Is(err, wallet.ErrInvalidSignature):
+		return ExitInvalidSignature
+	case errors.Is(err, blockchain.ErrTxNotFound), errors.Is(err, blockchain.ErrTxNotInBlock):
+		return ExitTxNotFound
+	case errors.Is(err, blockchain.ErrSchemaOutdated), errors.Is(err, blockchain.ErrSchemaTooNew):
+		return ExitSchemaMismatch
+	case errors.Is(err, blockchain.ErrBlockNotFound):
+		return ExitBlockNotFound
+	case errors.As(err, &verificationErr):
+		return ExitInvalidChain
+	default:
+		return ExitFailure
+	}
+}
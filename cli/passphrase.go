@@ -0,0 +1,63 @@
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// stdin reads passphrases that do not come from a terminal
+// It is shared so that lines buffered for one prompt are kept for the next
+var stdin = bufio.NewReader(os.Stdin)
+
+// readPassphrase gets a passphrase from the environment variable env or
+// asks for it with prompt
+// Terminals do not echo it, other input is read up to the end of the line
+func readPassphrase(env, prompt string) ([]byte, error) {
+	if passphrase, ok := os.LookupEnv(env); ok {
+		return []byte(passphrase), nil
+	}
+
+	fmt.Fprint(os.Stderr, prompt)
+	defer fmt.Fprintln(os.Stderr)
+
+	fd := int(os.Stdin.Fd())
+	if term.IsTerminal(fd) {
+		return term.ReadPassword(fd)
+	}
+
+	line, err := stdin.ReadString('\n')
+	if err != nil && line == "" {
+		return nil, err
+	}
+
+	return []byte(strings.TrimRight(line, "\r\n")), nil
+}
+
+// walletPassphrase gets the passphrase of an encrypted wallets file
+// WALLET_PASSPHRASE is used when it is set
+func walletPassphrase() ([]byte, error) {
+	return readPassphrase("WALLET_PASSPHRASE", "Wallet passphrase: ")
+}
+
+// newWalletPassphrase gets a new passphrase, asking for it twice
+// WALLET_NEW_PASSPHRASE is used when it is set
+func newWalletPassphrase() ([]byte, error) {
+	passphrase, err := readPassphrase("WALLET_NEW_PASSPHRASE", "New wallet passphrase: ")
+	if err != nil {
+		return nil, err
+	}
+	repeated, err := readPassphrase("WALLET_NEW_PASSPHRASE", "Repeat new wallet passphrase: ")
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(passphrase, repeated) {
+		return nil, ErrPassphraseMismatch
+	}
+
+	return passphrase, nil
+}
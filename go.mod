@@ -3,8 +3,11 @@ module digitalWallet
 go 1.15
 
 require (
+	github.com/decred/dcrd/dcrec/secp256k1/v4 v4.0.1
 	github.com/dgraph-io/badger/v3 v3.2103.0
 	github.com/joho/godotenv v1.3.0
 	github.com/mr-tron/base58 v1.2.0
+	github.com/tyler-smith/go-bip39 v1.1.0
 	golang.org/x/crypto v0.0.0-20210513164829-c07d793c2f9a
+	golang.org/x/term v0.0.0-20201126162022-7de9c90e9dd1
 )
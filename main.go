@@ -2,14 +2,20 @@ package main
 
 import (
 	"digitalWallet/cli"
+	"errors"
+	"fmt"
 	"os"
 )
 
 func main() {
-	defer os.Exit(0)
-
 	//blockchain.OpenDB()
 
 	cmd := cli.CommandLine{}
-	cmd.Run()
+	if err := cmd.Run(); err != nil {
+		// Usage has already been printed
+		if !errors.Is(err, cli.ErrUsage) {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+		}
+		os.Exit(cli.ExitCode(err))
+	}
 }
@@ -0,0 +1,16 @@
+package mempool
+
+import "errors"
+
+// Defines mempool errors
+var (
+	// ErrConflict is returned when a transaction spends an output that a
+	// pending transaction already spends
+	ErrConflict = errors.New("output is already spent by a pending transaction")
+
+	// ErrAlreadyInPool is returned when a transaction is submitted twice
+	ErrAlreadyInPool = errors.New("transaction is already in the mempool")
+
+	// ErrCoinbase is returned when a coinbase transaction is submitted
+	ErrCoinbase = errors.New("coinbase transactions are only created by miners")
+)
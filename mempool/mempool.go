@@ -0,0 +1,594 @@
+package mempool
+
+import (
+	"bytes"
+	"digitalWallet/blockchain"
+	"digitalWallet/transactions"
+	"digitalWallet/utils"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// Pool holds validated transactions waiting to be mined
+//
+// Pending transactions are kept in the chain store next to the blocks:
+//
+//	memp-<txid>          -> transaction and its fee
+//	mems-<txid><index>   -> ID of the pending transaction spending the output
+//
+// so that conflicting spends are found with a single lookup.
+type Pool struct {
+	BlockChain *blockchain.BlockChain
+}
+
+// Entry is a pending transaction with its fee
+type Entry struct {
+	Tx   *transactions.Transaction
+	Fee  int
+	Size int
+}
+
+// storedEntry is how an entry was encoded in the store before the binary
+// encoding
+type storedEntry struct {
+	Tx  []byte
+	Fee int
+}
+
+// Defines mempool keys
+var (
+	txPrefix    = []byte("memp-")
+	spentPrefix = []byte("mems-")
+)
+
+const (
+	// DefaultBlockSize limits the serialized size of the transactions mined
+	// in one block
+	DefaultBlockSize = 100000
+)
+
+// txKey builds the key of a pending transaction
+func txKey(txID []byte) []byte {
+	return append(append([]byte{}, txPrefix...), txID...)
+}
+
+// spentKey builds the key marking an output as spent by a pending transaction
+func spentKey(txID []byte, outIdx int) []byte {
+	index := make([]byte, 4)
+	binary.BigEndian.PutUint32(index, uint32(outIdx))
+
+	return bytes.Join([][]byte{spentPrefix, txID, index}, []byte{})
+}
+
+// HigherFeeRate reports whether a pays a higher fee per byte than b
+// The rates are compared without dividing
+func (a Entry) HigherFeeRate(b Entry) bool {
+	return a.Fee*b.Size > b.Fee*a.Size
+}
+
+// Get gets a pending transaction by ID
+func (p Pool) Get(txID []byte) (Entry, error) {
+	data, err := p.BlockChain.Store.Get(txKey(txID))
+	if errors.Is(err, blockchain.ErrKeyNotFound) {
+		return Entry{}, fmt.Errorf("%w: %x", blockchain.ErrTxNotFound, txID)
+	}
+	if err != nil {
+		return Entry{}, err
+	}
+
+	return decodeEntry(data)
+}
+
+// Entries lists every pending transaction
+func (p Pool) Entries() ([]Entry, error) {
+	var entries []Entry
+
+	err := p.BlockChain.Store.Iterate(txPrefix, func(key, value []byte) error {
+		entry, err := decodeEntry(value)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, entry)
+		return nil
+	})
+
+	return entries, err
+}
+
+// Add validates a transaction and stores it in the pool
+//
+// Every input must spend an unspent output of the chain or an output of a
+// pending transaction, and no other pending transaction may spend it.
+func (p Pool) Add(tx *transactions.Transaction) error {
+	if err := tx.CheckID(); err != nil {
+		return err
+	}
+	if tx.IsCoinbase() {
+		return ErrCoinbase
+	}
+	// Older versions accept signatures that are not canonical
+	if tx.Version != transactions.TxVersion {
+		return fmt.Errorf("%w: %d", blockchain.ErrBadTxVersion, tx.Version)
+	}
+	if _, err := p.Get(tx.ID); err == nil {
+		return fmt.Errorf("%w: %x", ErrAlreadyInPool, tx.ID)
+	}
+
+	prevTXs, err := p.PrevTransactions(tx)
+	if err != nil {
+		return err
+	}
+
+	fee, err := tx.Fee(prevTXs)
+	if err != nil {
+		return err
+	}
+	if !tx.Verify(prevTXs) {
+		return fmt.Errorf("%w: %x", blockchain.ErrBadSignature, tx.ID)
+	}
+
+	encoded := encodeEntry(tx.Serialize(), fee)
+
+	return p.BlockChain.Store.Update(func(batch blockchain.Batch) error {
+		for _, in := range tx.Inputs {
+			// Another transaction may have been added since the check above
+			if _, err := batch.Get(spentKey(in.ID, in.Out)); err == nil {
+				return fmt.Errorf("%w: %x:%d", ErrConflict, in.ID, in.Out)
+			}
+			if err := batch.Set(spentKey(in.ID, in.Out), tx.ID); err != nil {
+				return err
+			}
+		}
+
+		return batch.Set(txKey(tx.ID), encoded)
+	})
+}
+
+// PrevTransactions gets the transactions whose outputs tx spends
+// from the pool or the chain, keyed by hex encoded ID
+// It fails when an input is already spent, in the chain or in the pool
+func (p Pool) PrevTransactions(tx *transactions.Transaction) (map[string]transactions.Transaction, error) {
+	prevTXs := make(map[string]transactions.Transaction)
+	spending := make(map[string]bool)
+	UTXO := blockchain.UTXOSet{BlockChain: p.BlockChain}
+
+	for _, in := range tx.Inputs {
+		key := string(spentKey(in.ID, in.Out))
+		if spending[key] {
+			return nil, fmt.Errorf("%w: %x:%d", ErrConflict, in.ID, in.Out)
+		}
+		spending[key] = true
+
+		_, err := p.BlockChain.Store.Get([]byte(key))
+		if err == nil {
+			return nil, fmt.Errorf("%w: %x:%d", ErrConflict, in.ID, in.Out)
+		}
+		if !errors.Is(err, blockchain.ErrKeyNotFound) {
+			return nil, err
+		}
+
+		inTxID := hex.EncodeToString(in.ID)
+		if _, ok := prevTXs[inTxID]; ok {
+			continue
+		}
+
+		// Spends an output of a pending transaction
+		if entry, err := p.Get(in.ID); err == nil {
+			if in.Out < 0 || in.Out >= len(entry.Tx.Outputs) {
+				return nil, fmt.Errorf("%w: %x:%d", blockchain.ErrMissingInput, in.ID, in.Out)
+			}
+			prevTXs[inTxID] = *entry.Tx
+			continue
+		}
+
+		// Spends an output of the chain
+		if _, err := UTXO.FindOutput(in.ID, in.Out); err != nil {
+			return nil, err
+		}
+		prevTX, err := p.BlockChain.FindTransaction(in.ID)
+		if err != nil {
+			return nil, err
+		}
+		prevTXs[inTxID] = prevTX
+	}
+
+	return prevTXs, nil
+}
+
+// FindSpendableOutputs finds outputs of the public key hash that neither the
+// chain nor a pending transaction spends until their value covers the amount
+// Confirmed outputs are used before the change of pending transactions
+func (p Pool) FindSpendableOutputs(pubKeyHash []byte, amount int) (int, map[string][]int, error) {
+	unspentOuts := make(map[string][]int)
+	accumulated := 0
+
+	UTXOs, err := blockchain.UTXOSet{BlockChain: p.BlockChain}.FindUnspentOutputs(pubKeyHash)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	entries, err := p.Entries()
+	if err != nil {
+		return 0, nil, err
+	}
+	for _, entry := range entries {
+		for outIdx, out := range entry.Tx.Outputs {
+			if out.IsLockedWithKey(pubKeyHash) {
+				UTXOs = append(UTXOs, blockchain.UnspentOutput{TxID: entry.Tx.ID, Index: outIdx, Output: out})
+			}
+		}
+	}
+
+	for _, UTXO := range UTXOs {
+		if accumulated >= amount {
+			break
+		}
+
+		_, err := p.BlockChain.Store.Get(spentKey(UTXO.TxID, UTXO.Index))
+		if err == nil {
+			continue
+		}
+		if !errors.Is(err, blockchain.ErrKeyNotFound) {
+			return 0, nil, err
+		}
+
+		id := hex.EncodeToString(UTXO.TxID)
+		accumulated += UTXO.Output.Value
+		unspentOuts[id] = append(unspentOuts[id], UTXO.Index)
+	}
+
+	return accumulated, unspentOuts, nil
+}
+
+// Select picks the pending transactions of the next block
+//
+// Transactions are taken by decreasing fee rate while they fit in maxSize
+// bytes. A transaction spending a pending output is only taken after the
+// transaction creating it. Transactions whose inputs were spent since they
+// were added are skipped.
+func (p Pool) Select(maxSize int) ([]*transactions.Transaction, error) {
+	entries, err := p.Entries()
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].HigherFeeRate(entries[j])
+	})
+
+	pending := make(map[string]bool)
+	for _, entry := range entries {
+		pending[hex.EncodeToString(entry.Tx.ID)] = true
+	}
+
+	UTXO := blockchain.UTXOSet{BlockChain: p.BlockChain}
+	included := make(map[string]bool)
+	skipped := make(map[string]bool)
+	var selected []*transactions.Transaction
+	size := 0
+
+	// Restarts from the best fee rate after every pick, since picking a
+	// transaction may make its children eligible
+	for picked := true; picked; {
+		picked = false
+
+		for _, entry := range entries {
+			txID := hex.EncodeToString(entry.Tx.ID)
+			if included[txID] || skipped[txID] || size+entry.Size > maxSize {
+				continue
+			}
+
+			ready := true
+			for _, in := range entry.Tx.Inputs {
+				inTxID := hex.EncodeToString(in.ID)
+				if pending[inTxID] {
+					if skipped[inTxID] {
+						skipped[txID] = true
+					}
+					ready = ready && included[inTxID]
+					continue
+				}
+				if _, err := UTXO.FindOutput(in.ID, in.Out); err != nil {
+					if !errors.Is(err, blockchain.ErrMissingInput) {
+						return nil, err
+					}
+					skipped[txID] = true
+				}
+			}
+			if !ready || skipped[txID] {
+				continue
+			}
+
+			included[txID] = true
+			selected = append(selected, entry.Tx)
+			size += entry.Size
+			picked = true
+			break
+		}
+	}
+
+	return selected, nil
+}
+
+// RemoveBlock removes the transactions of a mined block from the pool
+// Pending transactions spending the same outputs as the block can never be
+// mined anymore and are removed with every transaction depending on them
+func (p Pool) RemoveBlock(block *blockchain.Block) error {
+	deps, err := p.dependencies()
+	if err != nil {
+		return err
+	}
+
+	for _, tx := range block.Transactions {
+		if tx.IsCoinbase() {
+			continue
+		}
+
+		txID := hex.EncodeToString(tx.ID)
+		if _, ok := deps.byID[txID]; ok {
+			deps.remove[txID] = true
+		}
+
+		for _, in := range tx.Inputs {
+			spender, err := p.BlockChain.Store.Get(spentKey(in.ID, in.Out))
+			if errors.Is(err, blockchain.ErrKeyNotFound) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if !bytes.Equal(spender, tx.ID) {
+				deps.evict(hex.EncodeToString(spender))
+			}
+		}
+	}
+
+	return p.removeEntries(deps)
+}
+
+// dependencies tracks which pending transactions spend the outputs of
+// others, to remove them together
+type dependencies struct {
+	byID     map[string]Entry
+	children map[string][]string
+	remove   map[string]bool
+}
+
+// dependencies gets the pending transactions and the transactions spending
+// their outputs, keyed by hex encoded ID
+func (p Pool) dependencies() (*dependencies, error) {
+	entries, err := p.Entries()
+	if err != nil {
+		return nil, err
+	}
+
+	deps := &dependencies{
+		byID:     make(map[string]Entry),
+		children: make(map[string][]string),
+		remove:   make(map[string]bool),
+	}
+	for _, entry := range entries {
+		txID := hex.EncodeToString(entry.Tx.ID)
+		deps.byID[txID] = entry
+		for _, in := range entry.Tx.Inputs {
+			inTxID := hex.EncodeToString(in.ID)
+			deps.children[inTxID] = append(deps.children[inTxID], txID)
+		}
+	}
+
+	return deps, nil
+}
+
+// evict marks a transaction for removal with every transaction depending on
+// it
+func (d *dependencies) evict(txID string) {
+	if d.remove[txID] {
+		return
+	}
+	d.remove[txID] = true
+	for _, child := range d.children[txID] {
+		d.evict(child)
+	}
+}
+
+// removeEntries deletes the pending transactions marked for removal
+func (p Pool) removeEntries(deps *dependencies) error {
+	return p.BlockChain.Store.Update(func(batch blockchain.Batch) error {
+		for txID := range deps.remove {
+			entry, ok := deps.byID[txID]
+			if !ok {
+				continue
+			}
+			if err := deleteEntry(batch, entry.Tx); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// AcceptBlock adds a block to the chain and brings the pool in line with
+// the main chain, see ApplyChainUpdate
+func (p Pool) AcceptBlock(block *blockchain.Block) (*blockchain.ChainUpdate, error) {
+	update, err := p.BlockChain.AcceptBlock(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return update, p.ApplyChainUpdate(update)
+}
+
+// ApplyChainUpdate brings the pool in line with a reorganized main chain
+//
+// Transactions of disconnected blocks are submitted again. Those no longer
+// valid and not mined again in the new branch are dropped with the pending
+// transactions spending their outputs. Then the transactions of connected blocks and their conflicts are removed.
+func (p Pool) ApplyChainUpdate(update *blockchain.ChainUpdate) error {
+	var rejected []*transactions.Transaction
+
+	for i := len(update.Disconnected) - 1; i >= 0; i-- {
+		for _, tx := range update.Disconnected[i].Transactions {
+			if tx.IsCoinbase() {
+				continue
+			}
+			err := p.Add(tx)
+			if err != nil && !isRejection(err) {
+				return err
+			}
+			if err == nil || errors.Is(err, ErrAlreadyInPool) {
+				continue
+			}
+
+			_, err = p.BlockChain.FindTransactionLocation(tx.ID)
+			if errors.Is(err, blockchain.ErrTxNotFound) {
+				rejected = append(rejected, tx)
+			} else if err != nil {
+				return err
+			}
+		}
+	}
+
+	if len(rejected) > 0 {
+		deps, err := p.dependencies()
+		if err != nil {
+			return err
+		}
+		for _, tx := range rejected {
+			for _, child := range deps.children[hex.EncodeToString(tx.ID)] {
+				deps.evict(child)
+			}
+		}
+		if err := p.removeEntries(deps); err != nil {
+			return err
+		}
+	}
+
+	for _, block := range update.Connected {
+		if err := p.RemoveBlock(block); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// isRejection reports whether Add refused a transaction as invalid
+// rather than failing to read or write the store
+func isRejection(err error) bool {
+	var verificationErr *blockchain.VerificationError
+
+	return errors.Is(err, ErrConflict) ||
+		errors.Is(err, ErrAlreadyInPool) ||
+		errors.Is(err, blockchain.ErrMissingInput) ||
+		errors.Is(err, blockchain.ErrTxNotFound) ||
+		errors.Is(err, blockchain.ErrBadSignature) ||
+		errors.Is(err, blockchain.ErrBadTxID) ||
+		errors.Is(err, blockchain.ErrOutputsTooLarge) ||
+		errors.Is(err, blockchain.ErrBadValue) ||
+		errors.Is(err, blockchain.ErrBadTxVersion) ||
+		errors.As(err, &verificationErr)
+}
+
+// deleteEntry deletes a pending transaction and the outputs it marks spent
+func deleteEntry(batch blockchain.Batch, tx *transactions.Transaction) error {
+	for _, in := range tx.Inputs {
+		spender, err := batch.Get(spentKey(in.ID, in.Out))
+		if errors.Is(err, blockchain.ErrKeyNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if bytes.Equal(spender, tx.ID) {
+			if err := batch.Delete(spentKey(in.ID, in.Out)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return batch.Delete(txKey(tx.ID))
+}
+
+// encodeEntry converts a serialized transaction and its fee to byte
+// The encoding is EncodingMagic followed by the fee and the transaction
+func encodeEntry(tx []byte, fee int) []byte {
+	var e utils.Encoder
+
+	e.WriteMagic()
+	e.WriteInt(int64(fee))
+	e.WriteBytes(tx)
+
+	return e.Bytes()
+}
+
+// decodeEntry converts byte to entry
+func decodeEntry(data []byte) (Entry, error) {
+	d := utils.NewDecoder(data)
+	if err := d.ReadMagic(); err != nil {
+		return Entry{}, err
+	}
+
+	fee, err := d.ReadInt()
+	if err != nil {
+		return Entry{}, err
+	}
+	data, err = d.ReadBytes()
+	if err != nil {
+		return Entry{}, err
+	}
+	if err := d.Finish(); err != nil {
+		return Entry{}, err
+	}
+
+	tx, err := transactions.DeserializeTransaction(data)
+	if err != nil {
+		return Entry{}, err
+	}
+
+	return Entry{Tx: &tx, Fee: int(fee), Size: len(data)}, nil
+}
+
+// MigrateGobEntries rewrites the pending transactions stored with gob in the
+// binary encoding
+// Transactions keep their ID and fee
+func (p Pool) MigrateGobEntries() (int, error) {
+	entries := make(map[string][]byte)
+
+	err := p.BlockChain.Store.Iterate(txPrefix, func(key, value []byte) error {
+		if utils.IsBinaryEncoding(value) {
+			return nil
+		}
+
+		var stored storedEntry
+		if err := gob.NewDecoder(bytes.NewReader(value)).Decode(&stored); err != nil {
+			return err
+		}
+		tx, err := transactions.DecodeGobTransaction(stored.Tx)
+		if err != nil {
+			return err
+		}
+		entries[string(key)] = encodeEntry(tx.Serialize(), stored.Fee)
+		return nil
+	})
+	if err != nil || len(entries) == 0 {
+		return 0, err
+	}
+
+	err = p.BlockChain.Store.Update(func(batch blockchain.Batch) error {
+		for key, data := range entries {
+			if err := batch.Set([]byte(key), data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return len(entries), nil
+}
@@ -0,0 +1,396 @@
+package mempool
+
+import (
+	"bytes"
+	"context"
+	"digitalWallet/blockchain"
+	"digitalWallet/transactions"
+	"digitalWallet/wallet"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// testPool is a pool of a chain in memory whose genesis pays a key of the
+// test
+type testPool struct {
+	Pool
+	t      *testing.T
+	wallet *wallet.Wallet
+}
+
+// newTestPool creates a chain in memory mined with one worker and its pool
+func newTestPool(t *testing.T) *testPool {
+	w, err := wallet.MakeWallet(wallet.DefaultKeyType)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	chain, err := blockchain.InitBlockChain(blockchain.NewMemoryStore(), string(w.Address()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain.Miner.Workers = 1
+	chain.Miner.Address = string(w.Address())
+
+	return &testPool{Pool{BlockChain: chain}, t, w}
+}
+
+// address gets the address paid by the chain
+func (p *testPool) address() string {
+	return string(p.wallet.Address())
+}
+
+// tip gets the last block of the main chain
+func (p *testPool) tip() *blockchain.Block {
+	p.t.Helper()
+
+	block, err := p.BlockChain.GetBlock(p.BlockChain.LastHash)
+	if err != nil {
+		p.t.Fatal(err)
+	}
+
+	return block
+}
+
+// spend creates a transaction signed by the key of the chain spending the
+// outputs outs of prev, paying each value to the key
+// The rest of the inputs is left as fee.
+func (p *testPool) spend(prev *transactions.Transaction, outs []int, values ...int) *transactions.Transaction {
+	p.t.Helper()
+
+	tx := &transactions.Transaction{Version: transactions.TxVersion}
+	for _, out := range outs {
+		tx.Inputs = append(tx.Inputs, transactions.TxInput{ID: prev.ID, Out: out, PubKey: p.wallet.PublicKey})
+	}
+	for _, value := range values {
+		output, err := transactions.NewTXOutput(value, p.address())
+		if err != nil {
+			p.t.Fatal(err)
+		}
+		tx.Outputs = append(tx.Outputs, *output)
+	}
+
+	prevTXs := map[string]transactions.Transaction{hex.EncodeToString(prev.ID): *prev}
+	if err := tx.Sign(p.wallet.Signer(), prevTXs); err != nil {
+		p.t.Fatal(err)
+	}
+	tx.SetID()
+
+	return tx
+}
+
+// add adds a transaction to the pool and fails the test when it is refused
+func (p *testPool) add(tx *transactions.Transaction) {
+	p.t.Helper()
+
+	if err := p.Add(tx); err != nil {
+		p.t.Fatal(err)
+	}
+}
+
+// mine mines the pending transactions on the tip and updates the pool
+func (p *testPool) mine() *blockchain.Block {
+	p.t.Helper()
+
+	txs, err := p.Select(DefaultBlockSize)
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	block, update, err := p.BlockChain.MineBlock(context.Background(), txs)
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	if err := p.ApplyChainUpdate(update); err != nil {
+		p.t.Fatal(err)
+	}
+
+	return block
+}
+
+// mineOn mines a block of txs paying no fees on top of parent, a second
+// after it, without accepting it
+func (p *testPool) mineOn(parent *blockchain.Block, txs ...*transactions.Transaction) *blockchain.Block {
+	p.t.Helper()
+
+	height := parent.Header.Height + 1
+	coinbase, err := transactions.CoinbaseTxn(p.address(), fmt.Sprintf("Fork block %d", height), blockchain.Policy.Subsidy(height))
+	if err != nil {
+		p.t.Fatal(err)
+	}
+
+	block := &blockchain.Block{Transactions: append([]*transactions.Transaction{coinbase}, txs...)}
+	block.Header = blockchain.BlockHeader{
+		Version:   blockchain.BlockVersion,
+		Timestamp: parent.Header.Timestamp + 1,
+		Height:    height,
+		PrevHash:  parent.Hash,
+		Bits:      parent.Header.Bits,
+	}
+	block.Header.MerkleRoot = block.HashTransactions()
+
+	nonce, hash, err := blockchain.NewProofOfWork(block).Mine(context.Background(), p.BlockChain.Miner)
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	block.Header.Nonce = nonce
+	block.Hash = hash
+
+	return block
+}
+
+// pending lists the IDs of the pending transactions
+func (p *testPool) pending() map[string]bool {
+	p.t.Helper()
+
+	entries, err := p.Entries()
+	if err != nil {
+		p.t.Fatal(err)
+	}
+
+	txIDs := make(map[string]bool)
+	for _, entry := range entries {
+		txIDs[hex.EncodeToString(entry.Tx.ID)] = true
+	}
+
+	return txIDs
+}
+
+// checkPending checks that exactly txs are pending
+func (p *testPool) checkPending(txs ...*transactions.Transaction) {
+	p.t.Helper()
+
+	pending := p.pending()
+	if len(pending) != len(txs) {
+		p.t.Errorf("%d transactions are pending, want %d", len(pending), len(txs))
+	}
+	for _, tx := range txs {
+		if !pending[hex.EncodeToString(tx.ID)] {
+			p.t.Errorf("transaction %x is not pending", tx.ID)
+		}
+	}
+}
+
+func TestAcceptBlockReturnsDisconnected(t *testing.T) {
+	p := newTestPool(t)
+	genesis := p.tip()
+	subsidy := blockchain.Policy.Subsidy(0)
+
+	// A transaction is mined and its change spent by a pending one
+	parent := p.spend(genesis.Transactions[0], []int{0}, subsidy-1)
+	p.add(parent)
+	mined := p.mine()
+	child := p.spend(parent, []int{0}, subsidy-2)
+	p.add(child)
+	p.checkPending(child)
+
+	// A branch with more work leaves the transaction out
+	fork1 := p.mineOn(genesis)
+	fork2 := p.mineOn(fork1)
+	if _, err := p.AcceptBlock(fork1); err != nil {
+		t.Fatal(err)
+	}
+	update, err := p.AcceptBlock(fork2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(update.Disconnected) != 1 || !bytes.Equal(update.Disconnected[0].Hash, mined.Hash) {
+		t.Fatalf("update %+v, want block %x disconnected", update, mined.Hash)
+	}
+
+	// It waits again with its child, and both are mined in order
+	p.checkPending(parent, child)
+	txs, err := p.Select(DefaultBlockSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(txs) != 2 || !bytes.Equal(txs[0].ID, parent.ID) || !bytes.Equal(txs[1].ID, child.ID) {
+		t.Fatalf("selected %d transactions, want the parent then the child", len(txs))
+	}
+
+	p.mine()
+	p.checkPending()
+	if _, err := p.BlockChain.Verify(blockchain.VerifyOptions{}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAcceptBlockDropsConflicts(t *testing.T) {
+	p := newTestPool(t)
+	genesis := p.tip()
+	subsidy := blockchain.Policy.Subsidy(0)
+
+	parent := p.spend(genesis.Transactions[0], []int{0}, subsidy-1)
+	p.add(parent)
+	p.mine()
+	child := p.spend(parent, []int{0}, subsidy-2)
+	p.add(child)
+
+	// The branch spends the same output, so the transaction and the child
+	// depending on it can never be mined
+	conflict := p.spend(genesis.Transactions[0], []int{0}, subsidy)
+	fork1 := p.mineOn(genesis, conflict)
+	fork2 := p.mineOn(fork1)
+	for _, block := range []*blockchain.Block{fork1, fork2} {
+		if _, err := p.AcceptBlock(block); err != nil {
+			t.Fatal(err)
+		}
+	}
+	p.checkPending()
+
+	// A branch mining the same transaction keeps its pending child
+	p = newTestPool(t)
+	genesis = p.tip()
+
+	parent = p.spend(genesis.Transactions[0], []int{0}, subsidy-1)
+	p.add(parent)
+	p.mine()
+	child = p.spend(parent, []int{0}, subsidy-2)
+	p.add(child)
+
+	fork1 = p.mineOn(genesis, parent)
+	fork2 = p.mineOn(fork1)
+	for _, block := range []*blockchain.Block{fork1, fork2} {
+		if _, err := p.AcceptBlock(block); err != nil {
+			t.Fatal(err)
+		}
+	}
+	p.checkPending(child)
+}
+
+// fund mines a transaction splitting the genesis coinbase into outputs of
+// each value
+func (p *testPool) fund(values ...int) *transactions.Transaction {
+	p.t.Helper()
+
+	funding := p.spend(p.tip().Transactions[0], []int{0}, values...)
+	p.add(funding)
+	p.mine()
+	p.checkPending()
+
+	return funding
+}
+
+// checkOrder checks that txs were selected in order
+func checkOrder(t *testing.T, name string, got []*transactions.Transaction, want ...*transactions.Transaction) {
+	t.Helper()
+
+	if len(got) != len(want) {
+		t.Fatalf("%s selected %d transactions, want %d", name, len(got), len(want))
+	}
+	for i := range want {
+		if !bytes.Equal(got[i].ID, want[i].ID) {
+			t.Errorf("%s selected %x at %d, want %x", name, got[i].ID, i, want[i].ID)
+		}
+	}
+}
+
+func TestAddRejects(t *testing.T) {
+	p := newTestPool(t)
+	funding := p.fund(30, 30)
+
+	tx := p.spend(funding, []int{0}, 29)
+	p.add(tx)
+	if err := p.Add(tx); !errors.Is(err, ErrAlreadyInPool) {
+		t.Errorf("adding twice gave %v, want %v", err, ErrAlreadyInPool)
+	}
+
+	doubleSpend := p.spend(funding, []int{0}, 28)
+	if err := p.Add(doubleSpend); !errors.Is(err, ErrConflict) {
+		t.Errorf("double spend gave %v, want %v", err, ErrConflict)
+	}
+	selfConflict := p.spend(funding, []int{1, 1}, 50)
+	if err := p.Add(selfConflict); !errors.Is(err, ErrConflict) {
+		t.Errorf("spending an output twice gave %v, want %v", err, ErrConflict)
+	}
+
+	// Older versions accept signatures that are not canonical
+	legacy := p.spend(funding, []int{1}, 29)
+	legacy.Version = transactions.LegacyTxVersion
+	legacy.SetID()
+	if err := p.Add(legacy); !errors.Is(err, blockchain.ErrBadTxVersion) {
+		t.Errorf("legacy transaction gave %v, want %v", err, blockchain.ErrBadTxVersion)
+	}
+
+	coinbase, err := transactions.CoinbaseTxn(p.address(), "pool", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Add(coinbase); !errors.Is(err, ErrCoinbase) {
+		t.Errorf("coinbase gave %v, want %v", err, ErrCoinbase)
+	}
+
+	p.checkPending(tx)
+}
+
+func TestSelect(t *testing.T) {
+	p := newTestPool(t)
+	funding := p.fund(30, 30, 30)
+
+	// The child pays the best fee rate but waits for its parent, which pays
+	// the worst
+	parent := p.spend(funding, []int{0}, 29)
+	child := p.spend(parent, []int{0}, 9)
+	high := p.spend(funding, []int{1}, 20)
+	low := p.spend(funding, []int{2}, 25)
+	for _, tx := range []*transactions.Transaction{parent, child, high, low} {
+		p.add(tx)
+	}
+
+	txs, err := p.Select(DefaultBlockSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkOrder(t, "unlimited block", txs, high, low, parent, child)
+
+	// Transactions that do not fit are left out, and so are their children
+	size := 0
+	for _, tx := range []*transactions.Transaction{high, low} {
+		entry, err := p.Get(tx.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		size += entry.Size
+	}
+	txs, err = p.Select(size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkOrder(t, "limited block", txs, high, low)
+
+	if txs, err = p.Select(0); err != nil || len(txs) != 0 {
+		t.Errorf("empty block selected %d transactions, %v", len(txs), err)
+	}
+}
+
+func TestRemoveBlock(t *testing.T) {
+	p := newTestPool(t)
+	funding := p.fund(30, 30, 30)
+
+	parent := p.spend(funding, []int{0}, 29)
+	child := p.spend(parent, []int{0}, 28)
+	mined := p.spend(funding, []int{1}, 29)
+	unrelated := p.spend(funding, []int{2}, 29)
+	for _, tx := range []*transactions.Transaction{parent, child, mined, unrelated} {
+		p.add(tx)
+	}
+
+	// The block mines one transaction and spends the input of another
+	conflict := p.spend(funding, []int{0}, 27)
+	block := p.mineOn(p.tip(), conflict, mined)
+	if _, err := p.BlockChain.AcceptBlock(block); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.RemoveBlock(block); err != nil {
+		t.Fatal(err)
+	}
+	p.checkPending(unrelated)
+
+	// The outputs the removed transactions spent are no longer marked
+	for _, in := range []transactions.TxInput{parent.Inputs[0], child.Inputs[0], mined.Inputs[0]} {
+		if _, err := p.BlockChain.Store.Get(spentKey(in.ID, in.Out)); !errors.Is(err, blockchain.ErrKeyNotFound) {
+			t.Errorf("output %x:%d is still marked spent: %v", in.ID, in.Out, err)
+		}
+	}
+}
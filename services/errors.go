@@ -0,0 +1,9 @@
+package services
+
+import "errors"
+
+// Defines service errors
+var (
+	// ErrInsufficientFunds is returned when an address cannot cover a payment
+	ErrInsufficientFunds = errors.New("not enough funds")
+)
@@ -1,19 +1,23 @@
 package services
 
 import (
-	"digitalWallet/blockchain"
+	"digitalWallet/mempool"
 	"digitalWallet/transactions"
-	"digitalWallet/utils"
 	"digitalWallet/wallet"
 	"encoding/hex"
-	"log"
+	"fmt"
 )
 
 // newTransactionServiceInterface interface keeps the new transaction function
 type newTransactionServiceInterface interface {
-	NewTransaction(from, to string, amount int, c *blockchain.BlockChain) *transactions.Transaction
+	NewTransaction(walletFile, from, to string, amount, fee int, pool mempool.Pool, passphrase PassphraseFunc) (*transactions.Transaction, error)
+	NewMultisigTransaction(ms *wallet.Multisig, to string, amount, fee int, pool mempool.Pool) (*transactions.Transaction, error)
 }
 
+// PassphraseFunc gets the wallet passphrase, by prompting for it or from
+// where it was given
+type PassphraseFunc func() ([]byte, error)
+
 // Instantiates type transactionService
 type newTransactionService struct{}
 
@@ -22,52 +26,122 @@ var (
 	Txn newTransactionServiceInterface = &newTransactionService{}
 )
 
-// NewTransaction creates new transaction
-func (n newTransactionService) NewTransaction(from, to string, amount int, c *blockchain.BlockChain) *transactions.Transaction {
-	var inputs []transactions.TxInput
-	var outputs []transactions.TxOutput
+// NewTransaction creates new transaction signed with a key of the wallets
+// file at walletFile
+// The fee is left out of the outputs and collected by the miner of the block.
+// Outputs spent by pending transactions are avoided and pending change may be
+// spent, so several transactions can wait in the pool together.
+// The passphrase is only asked for when the wallets file is encrypted.
+func (n newTransactionService) NewTransaction(walletFile, from, to string, amount, fee int, pool mempool.Pool, passphrase PassphraseFunc) (*transactions.Transaction, error) {
+	// Loads the wallets list, the keys are only read
+	wallets, err := wallet.LoadWallets(walletFile)
+	if err != nil {
+		return nil, err
+	}
 
-	// Creates wallets list
-	wallets, err := wallet.CreateWallets()
-	utils.HandleError(err)
+	// Decrypts the private keys to sign with
+	if wallets.IsLocked() {
+		if passphrase == nil {
+			return nil, wallet.ErrWalletLocked
+		}
+		secret, err := passphrase()
+		if err != nil {
+			return nil, err
+		}
+		if err := wallets.Unlock(secret); err != nil {
+			return nil, err
+		}
+	}
 
 	// Gets gets wallet based on address
-	w := wallets.GetWallet(from)
-	pubKeyHash := wallet.PublicKeyHash(w.PublicKey)
+	w, err := wallets.GetWallet(from)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := newUnsignedTransaction(w.PublicKey, from, to, amount, fee, pool)
+	if err != nil {
+		return nil, err
+	}
+
+	// Signs the transaction
+	prevTXs, err := pool.PrevTransactions(tx)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Sign(w.Signer(), prevTXs); err != nil {
+		return nil, err
+	}
+
+	// Sets the ID once the signatures are in place, and returns it
+	tx.SetID()
+
+	return tx, nil
+}
+
+// NewMultisigTransaction creates a transaction spending outputs of the
+// multisig address, with no signatures yet
+// The keys of the multisig add their signatures with
+// Transaction.SignMultisig, its ID must be set again after each.
+func (n newTransactionService) NewMultisigTransaction(ms *wallet.Multisig, to string, amount, fee int, pool mempool.Pool) (*transactions.Transaction, error) {
+	script := ms.Script()
+
+	tx, err := newUnsignedTransaction(script, string(ms.Address()), to, amount, fee, pool)
+	if err != nil {
+		return nil, err
+	}
+	tx.SetID()
+
+	return tx, nil
+}
+
+// newUnsignedTransaction creates a transaction spending outputs locked to
+// publicKey, from is its address and gets the change
+func newUnsignedTransaction(publicKey []byte, from, to string, amount, fee int, pool mempool.Pool) (*transactions.Transaction, error) {
+	var inputs []transactions.TxInput
+	var outputs []transactions.TxOutput
 
-	// Finds Spendable Outputs
-	acc, validOutputs := c.FindSpendableOutputs(pubKeyHash, amount)
+	pubKeyHash := wallet.PublicKeyHash(publicKey)
 
-	// Checks if there is enough money to send the amount
-	if acc < amount {
-		log.Panic("Error: Not enough funds!")
+	// Finds Spendable Outputs in the UTXO set and the pool
+	acc, validOutputs, err := pool.FindSpendableOutputs(pubKeyHash, amount+fee)
+	if err != nil {
+		return nil, err
+	}
+
+	// Checks if there is enough money to send the amount and pay the fee
+	if acc < amount+fee {
+		return nil, fmt.Errorf("%w: %s has %d, needs %d", ErrInsufficientFunds, from, acc, amount+fee)
 	}
 
 	// Makes inputs that point to the outputs being spent
 	for txid, outs := range validOutputs {
 		txID, err := hex.DecodeString(txid)
-		utils.HandleError(err)
+		if err != nil {
+			return nil, err
+		}
 
 		for _, out := range outs {
-			input := transactions.TxInput{txID, out, nil, w.PublicKey}
+			input := transactions.TxInput{ID: txID, Out: out, PubKey: publicKey}
 			inputs = append(inputs, input)
 		}
 	}
 
-	outputs = append(outputs, *transactions.NewTXOutput(amount, to))
+	output, err := transactions.NewTXOutput(amount, to)
+	if err != nil {
+		return nil, err
+	}
+	outputs = append(outputs, *output)
 
 	// Make new outputs from the difference
-	if acc > amount {
-		outputs = append(outputs, *transactions.NewTXOutput(acc-amount, from))
+	if acc > amount+fee {
+		change, err := transactions.NewTXOutput(acc-amount-fee, from)
+		if err != nil {
+			return nil, err
+		}
+		outputs = append(outputs, *change)
 	}
 
 	// Initializes a new transaction with all the new inputs and outputs
-	tx := transactions.Transaction{nil, inputs, outputs}
-
-	// Sets a new ID, and returns it
-	tx.Hash()
-
-	// Signs the transaction
-	c.SignTransaction(&tx, w.PrivateKey)
-	return &tx
+	return &transactions.Transaction{Version: transactions.TxVersion, Inputs: inputs, Outputs: outputs}, nil
 }
@@ -0,0 +1,196 @@
+package services
+
+import (
+	"context"
+	"digitalWallet/blockchain"
+	"digitalWallet/mempool"
+	"digitalWallet/transactions"
+	"digitalWallet/wallet"
+	"path/filepath"
+	"testing"
+)
+
+// testChain is a chain in memory with a wallets file holding its addresses
+type testChain struct {
+	t          *testing.T
+	pool       mempool.Pool
+	walletFile string
+}
+
+// newTestChain creates a wallets file with count addresses and a chain whose
+// genesis pays the first one
+func newTestChain(t *testing.T, count int) (*testChain, []string) {
+	walletFile := filepath.Join(t.TempDir(), "wallets.data")
+
+	wallets, err := wallet.CreateWallets(walletFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wallets.Close()
+
+	mnemonic, err := wallet.NewMnemonic()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := wallets.SetMnemonic(mnemonic); err != nil {
+		t.Fatal(err)
+	}
+
+	var addresses []string
+	for i := 0; i < count; i++ {
+		address, err := wallets.AddWallet(wallet.DefaultKeyType)
+		if err != nil {
+			t.Fatal(err)
+		}
+		addresses = append(addresses, address)
+	}
+	if err := wallets.SaveFile(); err != nil {
+		t.Fatal(err)
+	}
+
+	chain, err := blockchain.InitBlockChain(blockchain.NewMemoryStore(), addresses[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain.Miner.Workers = 1
+
+	return &testChain{t, mempool.Pool{BlockChain: chain}, walletFile}, addresses
+}
+
+// send creates a transaction with the service and adds it to the pool
+func (c *testChain) send(from, to string, amount, fee int) *transactions.Transaction {
+	c.t.Helper()
+
+	tx, err := Txn.NewTransaction(c.walletFile, from, to, amount, fee, c.pool, nil)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if err := tx.CheckID(); err != nil {
+		c.t.Fatal(err)
+	}
+	if err := c.pool.Add(tx); err != nil {
+		c.t.Fatal(err)
+	}
+
+	return tx
+}
+
+// mine mines every pending transaction into a block paying miner
+func (c *testChain) mine(miner string) *blockchain.Block {
+	c.t.Helper()
+
+	txs, err := c.pool.Select(mempool.DefaultBlockSize)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+
+	chain := c.pool.BlockChain
+	chain.Miner.Address = miner
+	block, update, err := chain.MineBlock(context.Background(), txs)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if err := c.pool.ApplyChainUpdate(update); err != nil {
+		c.t.Fatal(err)
+	}
+
+	return block
+}
+
+// balance sums the unspent outputs of an address
+func (c *testChain) balance(address string) int {
+	c.t.Helper()
+
+	pubKeyHash, err := wallet.DecodeAddress(address)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	UTXOs, err := blockchain.UTXOSet{BlockChain: c.pool.BlockChain}.FindUTXO(pubKeyHash)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+
+	balance := 0
+	for _, out := range UTXOs {
+		balance += out.Value
+	}
+
+	return balance
+}
+
+// verify checks the whole chain
+func (c *testChain) verify() {
+	c.t.Helper()
+
+	if _, err := c.pool.BlockChain.Verify(blockchain.VerifyOptions{}); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+func TestSendTwiceInOneBlock(t *testing.T) {
+	c, addresses := newTestChain(t, 3)
+	from, to, miner := addresses[0], addresses[1], addresses[2]
+	funds := c.balance(from)
+
+	// The second send spends the pending change of the first
+	first := c.send(from, to, 10, 1)
+	second := c.send(from, to, 5, 1)
+	for _, in := range second.Inputs {
+		if string(in.ID) != string(first.ID) {
+			t.Fatalf("second send spends %x, not the change of %x", in.ID, first.ID)
+		}
+	}
+
+	block := c.mine(miner)
+	if len(block.Transactions) != 3 {
+		t.Fatalf("block has %d transactions, want 3", len(block.Transactions))
+	}
+	c.verify()
+
+	if got, want := c.balance(from), funds-17; got != want {
+		t.Errorf("sender balance %d, want %d", got, want)
+	}
+	if got := c.balance(to); got != 15 {
+		t.Errorf("recipient balance %d, want 15", got)
+	}
+
+	// Both transactions are found by their ID
+	for _, tx := range []*transactions.Transaction{first, second} {
+		found, err := c.pool.BlockChain.FindTransaction(tx.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(found.ID) != string(tx.ID) {
+			t.Errorf("found %x for %x", found.ID, tx.ID)
+		}
+	}
+}
+
+func TestSendTwiceAndSpendChange(t *testing.T) {
+	c, addresses := newTestChain(t, 3)
+	from, to, miner := addresses[0], addresses[1], addresses[2]
+	funds := c.balance(from)
+
+	c.send(from, to, 10, 1)
+	c.mine(miner)
+	c.send(from, to, 5, 1)
+	c.mine(miner)
+
+	// Spends the change of both sends and the coins received
+	c.send(from, to, funds-17-3, 1)
+	c.send(to, from, 12, 1)
+	c.mine(miner)
+	c.verify()
+
+	if got := c.balance(from); got != 14 {
+		t.Errorf("sender balance %d, want 14", got)
+	}
+	if got, want := c.balance(to), funds-17-3+15-13; got != want {
+		t.Errorf("recipient balance %d, want %d", got, want)
+	}
+
+	// Nothing is left to spend
+	if _, err := Txn.NewTransaction(c.walletFile, from, to, 14, 1, c.pool, nil); err == nil {
+		t.Error("sending more than the balance succeeded")
+	}
+}
@@ -0,0 +1,23 @@
+package transactions
+
+import "errors"
+
+// Defines transaction errors
+var (
+	// ErrTxNotFound is returned when a referenced transaction does not exist
+	ErrTxNotFound = errors.New("transaction does not exist")
+
+	// ErrBadTxID is returned when a transaction ID does not match its contents
+	ErrBadTxID = errors.New("transaction ID does not match its contents")
+
+	// ErrNegativeFee is returned when outputs are worth more than inputs
+	ErrNegativeFee = errors.New("outputs are worth more than inputs")
+
+	// ErrBadValue is returned for negative values and sums of values that
+	// overflow
+	ErrBadValue = errors.New("value is negative or too large")
+
+	// ErrUnsupportedVersion is returned when decoding a transaction of an
+	// unknown version
+	ErrUnsupportedVersion = errors.New("unsupported transaction version")
+)
@@ -2,19 +2,214 @@ package transactions
 
 import (
 	"bytes"
+	"digitalWallet/utils"
 	"encoding/gob"
-	"log"
+	"fmt"
 )
 
 // Serialize converts struct to byte
+//
+// The encoding is EncodingMagic followed by
+//
+//	version       int
+//	inputs        count, then ID bytes, Out int, Signature bytes, PubKey bytes
+//	outputs       count, then Value int, PubKeyHash bytes
+//	ID            bytes
+//
+// with the integer and length prefixed layout of utils.Encoder. The ID of a
+// transaction hashes the bytes between the magic byte and the ID.
 func (tx Transaction) Serialize() []byte {
+	var e utils.Encoder
+
+	e.WriteMagic()
+	e.WriteInt(int64(tx.Version))
+	tx.encodeBody(&e)
+	e.WriteBytes(tx.ID)
+
+	return e.Bytes()
+}
+
+// DeserializeTransaction converts byte to transaction
+// Transactions whose ID does not match their contents are rejected
+func DeserializeTransaction(data []byte) (Transaction, error) {
+	tx, err := DecodeTransaction(data)
+	if err != nil {
+		return Transaction{}, err
+	}
+	if err := tx.CheckID(); err != nil {
+		return Transaction{}, err
+	}
+
+	return tx, nil
+}
+
+// DecodeTransaction converts byte to transaction without checking its ID
+// Blocks older than the ID check hold transactions whose IDs do not match
+func DecodeTransaction(data []byte) (Transaction, error) {
+	var tx Transaction
+
+	d := utils.NewDecoder(data)
+
+	if err := d.ReadMagic(); err != nil {
+		return Transaction{}, err
+	}
+
+	version, err := d.ReadInt()
+	if err != nil {
+		return Transaction{}, err
+	}
+	if version < LegacyTxVersion || version > TxVersion {
+		return Transaction{}, fmt.Errorf("%w: %d", ErrUnsupportedVersion, version)
+	}
+	tx.Version = int(version)
+
+	inputs, err := d.ReadLength()
+	if err != nil {
+		return Transaction{}, err
+	}
+	for i := 0; i < inputs; i++ {
+		var in TxInput
+		if in.ID, err = d.ReadBytes(); err != nil {
+			return Transaction{}, err
+		}
+		out, err := d.ReadInt()
+		if err != nil {
+			return Transaction{}, err
+		}
+		in.Out = int(out)
+		if in.Signature, err = d.ReadBytes(); err != nil {
+			return Transaction{}, err
+		}
+		if in.PubKey, err = d.ReadBytes(); err != nil {
+			return Transaction{}, err
+		}
+		tx.Inputs = append(tx.Inputs, in)
+	}
+
+	outputs, err := d.ReadLength()
+	if err != nil {
+		return Transaction{}, err
+	}
+	for i := 0; i < outputs; i++ {
+		out, err := decodeOutput(d)
+		if err != nil {
+			return Transaction{}, err
+		}
+		tx.Outputs = append(tx.Outputs, out)
+	}
+
+	if tx.ID, err = d.ReadBytes(); err != nil {
+		return Transaction{}, err
+	}
+
+	return tx, d.Finish()
+}
+
+// DecodeGobTransaction converts a transaction stored before the binary
+// encoding
+// It is only used to migrate stored data
+func DecodeGobTransaction(data []byte) (Transaction, error) {
+	var tx Transaction
+
+	decoder := gob.NewDecoder(bytes.NewReader(data))
+	if err := decoder.Decode(&tx); err != nil {
+		return Transaction{}, err
+	}
+
+	return tx, nil
+}
+
+// canonicalEncoding encodes every field of the transaction but the ID
+//
+// Legacy transactions leave out the version. Their IDs stay valid because
+// they are kept as stored and never computed again.
+func (tx Transaction) canonicalEncoding() []byte {
+	var e utils.Encoder
+
+	if tx.Version != LegacyTxVersion {
+		e.WriteInt(int64(tx.Version))
+	}
+	tx.encodeBody(&e)
+
+	return e.Bytes()
+}
+
+// encodeBody writes the inputs and outputs of the transaction
+func (tx Transaction) encodeBody(e *utils.Encoder) {
+	e.WriteUint(uint64(len(tx.Inputs)))
+	for _, in := range tx.Inputs {
+		e.WriteBytes(in.ID)
+		e.WriteInt(int64(in.Out))
+		e.WriteBytes(in.Signature)
+		e.WriteBytes(in.PubKey)
+	}
+
+	e.WriteUint(uint64(len(tx.Outputs)))
+	for _, out := range tx.Outputs {
+		out.encode(e)
+	}
+}
+
+// legacyEncoding is the gob encoding legacy transactions were signed over
+func (tx Transaction) legacyEncoding() ([]byte, error) {
+	// Mirrors the fields transactions had before versions, as gob describes
+	// the type in its output
+	type Transaction struct {
+		ID      []byte
+		Inputs  []TxInput
+		Outputs []TxOutput
+	}
+
 	var encoded bytes.Buffer
+	if err := gob.NewEncoder(&encoded).Encode(Transaction{tx.ID, tx.Inputs, tx.Outputs}); err != nil {
+		return nil, err
+	}
+
+	return encoded.Bytes(), nil
+}
+
+// Serialize converts output to byte
+// The encoding is EncodingMagic followed by Value int and PubKeyHash bytes
+func (out TxOutput) Serialize() []byte {
+	var e utils.Encoder
+
+	e.WriteMagic()
+	out.encode(&e)
+
+	return e.Bytes()
+}
+
+// encode writes the fields of the output
+func (out TxOutput) encode(e *utils.Encoder) {
+	e.WriteInt(int64(out.Value))
+	e.WriteBytes(out.PubKeyHash)
+}
+
+// DeserializeOutput converts byte to output
+func DeserializeOutput(data []byte) (TxOutput, error) {
+	d := utils.NewDecoder(data)
+	if err := d.ReadMagic(); err != nil {
+		return TxOutput{}, err
+	}
+
+	out, err := decodeOutput(d)
+	if err != nil {
+		return TxOutput{}, err
+	}
 
-	enc := gob.NewEncoder(&encoded)
-	err := enc.Encode(tx)
+	return out, d.Finish()
+}
+
+// decodeOutput reads the fields of an output
+func decodeOutput(d *utils.Decoder) (TxOutput, error) {
+	value, err := d.ReadInt()
+	if err != nil {
+		return TxOutput{}, err
+	}
+	pubKeyHash, err := d.ReadBytes()
 	if err != nil {
-		log.Panic(err)
+		return TxOutput{}, err
 	}
 
-	return encoded.Bytes()
+	return TxOutput{int(value), pubKeyHash}, nil
 }
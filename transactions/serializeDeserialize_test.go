@@ -0,0 +1,158 @@
+package transactions
+
+import (
+	"bytes"
+	"digitalWallet/utils"
+	"digitalWallet/wallet"
+	"encoding/hex"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// goldenTx is the transaction of the golden vectors
+func goldenTx() Transaction {
+	return Transaction{
+		Version: TxVersion,
+		Inputs:  []TxInput{{ID: []byte{0xaa}, Out: 1, Signature: []byte{0xbb}, PubKey: []byte{0xcc}}},
+		Outputs: []TxOutput{{Value: 7, PubKeyHash: []byte{0xdd}}},
+	}
+}
+
+// Defines golden vectors
+const (
+	goldenOutput = "db" + "0000000000000005" + "0000000000000003" + "010203"
+
+	goldenTxID = "892290c710c5228ee3c1f0ff08717baffb7dce1c63dd75d79f20005d926653e4"
+
+	goldenTxEncoding = "db" +
+		"0000000000000002" + // version
+		"0000000000000001" + // inputs
+		"0000000000000001" + "aa" + "0000000000000001" + "0000000000000001" + "bb" + "0000000000000001" + "cc" +
+		"0000000000000001" + // outputs
+		"0000000000000007" + "0000000000000001" + "dd" +
+		"0000000000000020" + goldenTxID
+
+	// goldenLegacyTxID leaves the version out of the hash
+	goldenLegacyTxID = "ca7b624eff2a1e211af8b9a546502d06d8e9f8c5300a8e88c0a2b6798641a9cb"
+)
+
+func mustDecodeHex(t *testing.T, s string) []byte {
+	t.Helper()
+
+	data, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return data
+}
+
+func TestOutputGolden(t *testing.T) {
+	out := TxOutput{Value: 5, PubKeyHash: []byte{1, 2, 3}}
+
+	encoded := out.Serialize()
+	if got := hex.EncodeToString(encoded); got != goldenOutput {
+		t.Fatalf("Serialize() = %s, want %s", got, goldenOutput)
+	}
+
+	decoded, err := DeserializeOutput(mustDecodeHex(t, goldenOutput))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, out) {
+		t.Errorf("DeserializeOutput() = %+v, want %+v", decoded, out)
+	}
+}
+
+func TestTransactionGolden(t *testing.T) {
+	tx := goldenTx()
+	tx.SetID()
+
+	if got := hex.EncodeToString(tx.ID); got != goldenTxID {
+		t.Errorf("ID = %s, want %s", got, goldenTxID)
+	}
+	if got := hex.EncodeToString(tx.Serialize()); got != goldenTxEncoding {
+		t.Errorf("Serialize() = %s, want %s", got, goldenTxEncoding)
+	}
+
+	decoded, err := DeserializeTransaction(mustDecodeHex(t, goldenTxEncoding))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, tx) {
+		t.Errorf("DeserializeTransaction() = %+v, want %+v", decoded, tx)
+	}
+}
+
+func TestLegacyTransactionID(t *testing.T) {
+	tx := goldenTx()
+	tx.Version = LegacyTxVersion
+	tx.SetID()
+
+	if got := hex.EncodeToString(tx.ID); got != goldenLegacyTxID {
+		t.Errorf("ID = %s, want %s", got, goldenLegacyTxID)
+	}
+}
+
+func TestTransactionRoundTrip(t *testing.T) {
+	w, err := wallet.MakeWallet(wallet.DefaultKeyType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	coinbase, err := CoinbaseTxn(string(w.Address()), "round trip", 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	empty := Transaction{Version: TxVersion}
+	empty.SetID()
+
+	multi := goldenTx()
+	multi.Inputs = append(multi.Inputs, TxInput{ID: bytes.Repeat([]byte{1}, 32), Out: 0, Signature: bytes.Repeat([]byte{2}, 64), PubKey: bytes.Repeat([]byte{3}, 33)})
+	multi.Outputs = append(multi.Outputs, TxOutput{Value: 1 << 40, PubKeyHash: bytes.Repeat([]byte{4}, 20)})
+	multi.SetID()
+
+	for _, tx := range []Transaction{*coinbase, empty, multi} {
+		decoded, err := DeserializeTransaction(tx.Serialize())
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Empty fields decode as empty rather than nil slices
+		if decoded.String() != tx.String() {
+			t.Errorf("round trip gave %s, want %s", decoded, tx)
+		}
+		if !bytes.Equal(decoded.Serialize(), tx.Serialize()) {
+			t.Errorf("encoding of %x changed after a round trip", tx.ID)
+		}
+	}
+}
+
+func TestDeserializeTransactionRejects(t *testing.T) {
+	golden := mustDecodeHex(t, goldenTxEncoding)
+
+	badID := append([]byte{}, golden...)
+	badID[len(badID)-1] ^= 1
+
+	badVersion := append([]byte{}, golden...)
+	badVersion[8] = TxVersion + 1
+
+	tests := []struct {
+		name string
+		data []byte
+		err  error
+	}{
+		{"empty", nil, utils.ErrMalformedEncoding},
+		{"gob", golden[1:], utils.ErrMalformedEncoding},
+		{"truncated", golden[:len(golden)-1], utils.ErrMalformedEncoding},
+		{"trailing", append(append([]byte{}, golden...), 0), utils.ErrMalformedEncoding},
+		{"bad ID", badID, ErrBadTxID},
+		{"bad version", badVersion, ErrUnsupportedVersion},
+	}
+
+	for _, test := range tests {
+		if _, err := DeserializeTransaction(test.data); !errors.Is(err, test.err) {
+			t.Errorf("%s: got %v, want %v", test.name, err, test.err)
+		}
+	}
+}
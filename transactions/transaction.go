@@ -2,22 +2,37 @@ package transactions
 
 import (
 	"bytes"
-	"crypto/ecdsa"
-	"crypto/elliptic"
-	"crypto/rand"
 	"crypto/sha256"
-	"digitalWallet/utils"
 	"digitalWallet/wallet"
-	"encoding/gob"
 	"encoding/hex"
+	"errors"
 	"fmt"
-	"log"
-	"math/big"
 	"strings"
 )
 
+// maxValue is the largest value an int holds
+const maxValue = int(^uint(0) >> 1)
+
+// Defines transaction versions
+const (
+	// LegacyTxVersion marks transactions created before the binary encoding
+	// Their ID leaves out the version and their signatures cover a gob
+	// encoding
+	LegacyTxVersion = 0
+
+	// BinaryTxVersion marks transactions signed before signatures had a
+	// fixed width
+	BinaryTxVersion = 1
+
+	// TxVersion is the version of new transactions
+	// Only canonical signatures are valid in them and keys can be of any
+	// type, see wallet.Signer
+	TxVersion = 2
+)
+
 // Transaction defines transaction model
 type Transaction struct {
+	Version int
 	ID      []byte
 	Inputs  []TxInput
 	Outputs []TxOutput
@@ -36,13 +51,9 @@ type TxInput struct {
 	PubKey    []byte
 }
 
-// Defines constants
-const (
-	Reward = 100
-)
-
-// Initializes initial transaction
-func CoinbaseTxn(toAddress, data string) *Transaction {
+// CoinbaseTxn creates the transaction paying value to the miner of a block
+// data should differ between blocks so that coinbase IDs are unique
+func CoinbaseTxn(toAddress, data string, value int) (*Transaction, error) {
 	if data == "" {
 		data = fmt.Sprintf("Coins to %s", toAddress)
 	}
@@ -50,25 +61,37 @@ func CoinbaseTxn(toAddress, data string) *Transaction {
 	//This means that we initialize it with no ID, and it's OutputIndex is -1
 	txIn := TxInput{[]byte{}, -1, nil, []byte(data)}
 
-	txOut := NewTXOutput(Reward, toAddress)
+	txOut, err := NewTXOutput(value, toAddress)
+	if err != nil {
+		return nil, err
+	}
 
-	tx := Transaction{nil, []TxInput{txIn}, []TxOutput{*txOut}}
+	tx := Transaction{TxVersion, nil, []TxInput{txIn}, []TxOutput{*txOut}}
+	tx.SetID()
 
-	return &tx
+	return &tx, nil
 }
 
-// Encodes and hash Transactions ID
+// SetID sets the transaction ID from its contents
+// It must be called once the transaction is signed
 func (tx *Transaction) SetID() {
-	var encoded bytes.Buffer
-	var hash [32]byte
+	tx.ID = tx.ComputeID()
+}
 
-	encoder := gob.NewEncoder(&encoded)
-	err := encoder.Encode(tx)
-	utils.HandleError(err)
+// ComputeID hashes the canonical encoding of the transaction
+// The ID covers every field except itself, signatures included
+func (tx *Transaction) ComputeID() []byte {
+	hash := sha256.Sum256(tx.canonicalEncoding())
 
-	hash = sha256.Sum256(encoded.Bytes())
-	tx.ID = hash[:]
+	return hash[:]
+}
 
+// CheckID checks that the transaction ID matches its contents
+func (tx *Transaction) CheckID() error {
+	if !bytes.Equal(tx.ID, tx.ComputeID()) {
+		return fmt.Errorf("%w: %x", ErrBadTxID, tx.ID)
+	}
+	return nil
 }
 
 // UsesKey hashes input public key
@@ -81,13 +104,15 @@ func (in *TxInput) UsesKey(pubKeyHash []byte) bool {
 }
 
 // Lock locks the address
-func (out *TxOutput) Lock(address []byte) {
-	// Decodes address
-	pubKeyHash := utils.Base58Decode(address)
+func (out *TxOutput) Lock(address []byte) error {
+	// Decodes address without the version and checksum
+	pubKeyHash, err := wallet.DecodeAddress(string(address))
+	if err != nil {
+		return err
+	}
 
-	// Removes the Versioned hash and the Checksum hash from the public key hash
-	pubKeyHash = pubKeyHash[1 : len(pubKeyHash)-4]
 	out.PubKeyHash = pubKeyHash
+	return nil
 }
 
 // IsLockedWithKey checks if the output is locked with a key
@@ -97,12 +122,14 @@ func (out *TxOutput) IsLockedWithKey(pubKeyHash []byte) bool {
 
 // NewTXOutput converts address into bytes
 // Populates the transaction out put with a public key hash
-func NewTXOutput(value int, address string) *TxOutput {
+func NewTXOutput(value int, address string) (*TxOutput, error) {
 	txo := &TxOutput{value, nil}
 	// Locks the address
-	txo.Lock([]byte(address))
+	if err := txo.Lock([]byte(address)); err != nil {
+		return nil, err
+	}
 
-	return txo
+	return txo, nil
 }
 
 // Checks if it was a coinbase transaction
@@ -111,51 +138,146 @@ func (tx *Transaction) IsCoinbase() bool {
 	return len(tx.Inputs) == 1 && len(tx.Inputs[0].ID) == 0 && tx.Inputs[0].Out == -1
 }
 
-// Hash hashes a transaction copy
-func (tx *Transaction) Hash() []byte {
-	var hash [32]byte
+// OutputValue sums the value of the outputs
+func (tx *Transaction) OutputValue() int {
+	value := 0
+	for _, out := range tx.Outputs {
+		value += out.Value
+	}
+	return value
+}
 
+// Fee is the value of the inputs minus the value of the outputs
+// The previous transactions of every input must be in prevTXs
+func (tx *Transaction) Fee(prevTXs map[string]Transaction) (int, error) {
+	if tx.IsCoinbase() {
+		return 0, nil
+	}
+
+	var inputs []int
+	for _, in := range tx.Inputs {
+		prevTX, ok := prevTXs[hex.EncodeToString(in.ID)]
+		if !ok || in.Out < 0 || in.Out >= len(prevTX.Outputs) {
+			return 0, fmt.Errorf("%w: %x", ErrTxNotFound, in.ID)
+		}
+		inputs = append(inputs, prevTX.Outputs[in.Out].Value)
+	}
+
+	return tx.FeeOf(inputs)
+}
+
+// FeeOf is the fee of the transaction when its inputs spend outputs worth
+// inputs
+// It is how every fee is checked, see CheckValue.
+func (tx *Transaction) FeeOf(inputs []int) (int, error) {
+	valueIn := 0
+	for _, value := range inputs {
+		var err error
+		if valueIn, err = AddValue(valueIn, value); err != nil {
+			return 0, fmt.Errorf("%w: %x", err, tx.ID)
+		}
+	}
+
+	valueOut, err := tx.CheckValue()
+	if err != nil {
+		return 0, err
+	}
+
+	if valueIn < valueOut {
+		return 0, fmt.Errorf("%w: %x", ErrNegativeFee, tx.ID)
+	}
+
+	return valueIn - valueOut, nil
+}
+
+// CheckValue sums the value of the outputs
+// It fails with ErrBadValue when an output is negative or the sum overflows.
+func (tx *Transaction) CheckValue() (int, error) {
+	value := 0
+	for _, out := range tx.Outputs {
+		var err error
+		if value, err = AddValue(value, out.Value); err != nil {
+			return 0, fmt.Errorf("%w: %x", err, tx.ID)
+		}
+	}
+
+	return value, nil
+}
+
+// AddValue adds a value to a sum of values
+// It fails with ErrBadValue when either is negative or the sum overflows.
+func AddValue(sum, value int) (int, error) {
+	if sum < 0 || value < 0 || value > maxValue-sum {
+		return 0, ErrBadValue
+	}
+
+	return sum + value, nil
+}
+
+// Hash hashes a transaction copy
+// Legacy transactions are hashed the way they were signed, over gob
+func (tx *Transaction) Hash() ([]byte, error) {
 	txCopy := *tx
 	txCopy.ID = []byte{}
 
-	hash = sha256.Sum256(txCopy.Serialize())
+	encoded := txCopy.canonicalEncoding()
+	if tx.Version == LegacyTxVersion {
+		var err error
+		if encoded, err = txCopy.legacyEncoding(); err != nil {
+			return nil, err
+		}
+	}
+	hash := sha256.Sum256(encoded)
 
-	return hash[:]
+	return hash[:], nil
 }
 
 // Sign signs the transaction
-func (tx *Transaction) Sign(privKey ecdsa.PrivateKey, prevTXs map[string]Transaction) {
+// Versions before TxVersion only have P-256 signatures.
+func (tx *Transaction) Sign(signer wallet.Signer, prevTXs map[string]Transaction) error {
 	// checks if it's coin base
 	if tx.IsCoinbase() {
-		return
+		return nil
 	}
 
-	//for _, in := range tx.Inputs {
-	//	if prevTXs[hex.EncodeToString(in.ID)].ID == nil {
-	//		log.Panic("ERROR: Previous transaction is not correct")
-	//	}
-	//}
+	for _, in := range tx.Inputs {
+		prevTX, ok := prevTXs[hex.EncodeToString(in.ID)]
+		if !ok || in.Out < 0 || in.Out >= len(prevTX.Outputs) {
+			return fmt.Errorf("%w: %x", ErrTxNotFound, in.ID)
+		}
+	}
+	if tx.Version < TxVersion && signer.Type() != wallet.KeyTypeP256 {
+		return fmt.Errorf("%w: %s keys in version %d", ErrUnsupportedVersion, signer.Type(), tx.Version)
+	}
 
 	// Creates a transaction copy
 	txCopy := tx.TrimmedCopy()
 
-	for inId, in := range txCopy.Inputs {
-		prevTX := prevTXs[hex.EncodeToString(in.ID)]
-		txCopy.Inputs[inId].Signature = nil
-		txCopy.Inputs[inId].PubKey = prevTX.Outputs[in.Out].PubKeyHash
-		txCopy.ID = txCopy.Hash()
-		txCopy.Inputs[inId].PubKey = nil
+	for inId := range txCopy.Inputs {
+		hash, err := txCopy.inputHash(inId, prevTXs)
+		if err != nil {
+			return err
+		}
+		signature, err := signer.Sign(hash)
+		if err != nil {
+			return err
+		}
 
-		r, s, err := ecdsa.Sign(rand.Reader, &privKey, txCopy.ID)
-		utils.HandleError(err)
-		signature := append(r.Bytes(), s.Bytes()...)
+		// Older versions drop the leading zeros of r and s
+		if tx.Version < TxVersion {
+			r, s, err := wallet.ParseSignature(signature)
+			if err != nil {
+				return err
+			}
+			signature = append(r.Bytes(), s.Bytes()...)
+		}
 
 		tx.Inputs[inId].Signature = signature
 
 	}
-}
-
 
+	return nil
+}
 
 // Verify verifies the transaction
 func (tx *Transaction) Verify(prevTXs map[string]Transaction) bool {
@@ -163,39 +285,39 @@ func (tx *Transaction) Verify(prevTXs map[string]Transaction) bool {
 		return true
 	}
 
+	// Inputs spending unknown outputs can never be valid
 	for _, in := range tx.Inputs {
-		if prevTXs[hex.EncodeToString(in.ID)].ID == nil {
-			log.Panic("Previous transaction not correct")
+		prevTX, ok := prevTXs[hex.EncodeToString(in.ID)]
+		if !ok || in.Out < 0 || in.Out >= len(prevTX.Outputs) {
+			return false
 		}
 	}
 
 	// creates a transaction copy
 	txCopy := tx.TrimmedCopy()
 
-	curve := elliptic.P256()
-
 	for inId, in := range tx.Inputs {
+		// The key must be the one the output is locked to
 		prevTx := prevTXs[hex.EncodeToString(in.ID)]
-		txCopy.Inputs[inId].Signature = nil
-		txCopy.Inputs[inId].PubKey = prevTx.Outputs[in.Out].PubKeyHash
-		txCopy.ID = txCopy.Hash()
-		txCopy.Inputs[inId].PubKey = nil
-
-		r := big.Int{}
-		s := big.Int{}
-
-		sigLen := len(in.Signature)
-		r.SetBytes(in.Signature[:(sigLen / 2)])
-		s.SetBytes(in.Signature[(sigLen / 2):])
-
-		x := big.Int{}
-		y := big.Int{}
-		keyLen := len(in.PubKey)
-		x.SetBytes(in.PubKey[:(keyLen / 2)])
-		y.SetBytes(in.PubKey[(keyLen / 2):])
-
-		rawPubKey := ecdsa.PublicKey{curve, &x, &y}
-		if ecdsa.Verify(&rawPubKey, txCopy.ID, &r, &s) == false {
+		if !in.UsesKey(prevTx.Outputs[in.Out].PubKeyHash) {
+			return false
+		}
+
+		hash, err := txCopy.inputHash(inId, prevTXs)
+		if err != nil {
+			return false
+		}
+
+		// Signatures of older versions have no fixed width
+		if tx.Version < TxVersion {
+			if !wallet.VerifyLegacyDigest(in.PubKey, hash, in.Signature) {
+				return false
+			}
+			continue
+		}
+
+		// Multisig inputs verify their signature set, see wallet.Multisig
+		if !wallet.VerifyDigest(in.PubKey, hash, in.Signature) {
 			return false
 		}
 	}
@@ -203,7 +325,69 @@ func (tx *Transaction) Verify(prevTXs map[string]Transaction) bool {
 	return true
 }
 
-//TrimmedCopy creates a transaction copy
+// SignMultisig adds the signature of the signer to the multisig inputs that
+// list its key
+// Inputs that already have enough signatures are left as they are. It
+// returns the number of inputs signed, the ID must be set again once the
+// signatures are collected.
+func (tx *Transaction) SignMultisig(signer wallet.Signer, prevTXs map[string]Transaction) (int, error) {
+	for _, in := range tx.Inputs {
+		prevTX, ok := prevTXs[hex.EncodeToString(in.ID)]
+		if !ok || in.Out < 0 || in.Out >= len(prevTX.Outputs) {
+			return 0, fmt.Errorf("%w: %x", ErrTxNotFound, in.ID)
+		}
+	}
+	if tx.Version < TxVersion {
+		return 0, fmt.Errorf("%w: multisig in version %d", ErrUnsupportedVersion, tx.Version)
+	}
+
+	txCopy := tx.TrimmedCopy()
+
+	signed := 0
+	for inId, in := range tx.Inputs {
+		if !wallet.IsMultisig(in.PubKey) {
+			continue
+		}
+		ms, err := wallet.ParseMultisig(in.PubKey)
+		if err != nil {
+			return 0, err
+		}
+
+		hash, err := txCopy.inputHash(inId, prevTXs)
+		if err != nil {
+			return 0, err
+		}
+		signatures, err := ms.AddSignature(in.Signature, signer, hash)
+		if errors.Is(err, wallet.ErrNotMultisigKey) {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		if !bytes.Equal(signatures, in.Signature) {
+			signed++
+		}
+		tx.Inputs[inId].Signature = signatures
+	}
+
+	return signed, nil
+}
+
+// inputHash gets the digest signed for the input at inId
+// tx is a TrimmedCopy, the input holds the public key hash of the output it
+// spends meanwhile.
+func (tx *Transaction) inputHash(inId int, prevTXs map[string]Transaction) ([]byte, error) {
+	in := tx.Inputs[inId]
+	prevTX := prevTXs[hex.EncodeToString(in.ID)]
+
+	tx.Inputs[inId].PubKey = prevTX.Outputs[in.Out].PubKeyHash
+	hash, err := tx.Hash()
+	tx.Inputs[inId].PubKey = nil
+
+	return hash, err
+}
+
+// TrimmedCopy creates a transaction copy
 func (tx Transaction) TrimmedCopy() Transaction {
 
 	var inputs []TxInput
@@ -217,7 +401,7 @@ func (tx Transaction) TrimmedCopy() Transaction {
 		outputs = append(outputs, TxOutput{out.Value, out.PubKeyHash})
 	}
 
-	txCopy := Transaction{tx.ID, inputs, outputs}
+	txCopy := Transaction{tx.Version, tx.ID, inputs, outputs}
 
 	return txCopy
 
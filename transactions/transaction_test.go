@@ -0,0 +1,203 @@
+package transactions
+
+import (
+	"digitalWallet/utils"
+	"digitalWallet/wallet"
+	"encoding/hex"
+	"testing"
+)
+
+// makeWallets creates a wallet of each type given
+func makeWallets(t *testing.T, types ...wallet.KeyType) []*wallet.Wallet {
+	t.Helper()
+
+	var wallets []*wallet.Wallet
+	for _, keyType := range types {
+		w, err := wallet.MakeWallet(keyType)
+		if err != nil {
+			t.Fatal(err)
+		}
+		wallets = append(wallets, w)
+	}
+
+	return wallets
+}
+
+// legacyWallet gets the wallet of the same P-256 key with the public key in
+// the layout used before compression
+func legacyWallet(t *testing.T, w *wallet.Wallet) *wallet.Wallet {
+	t.Helper()
+
+	key, err := wallet.ParsePublicKey(w.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &wallet.Wallet{Type: w.Type, PrivateKey: w.PrivateKey, PublicKey: append(key.X.Bytes(), key.Y.Bytes()...)}
+}
+
+// spendMultisig creates an unsigned transaction spending an output locked to
+// the multisig and the transactions it spends
+func spendMultisig(t *testing.T, ms *wallet.Multisig) (*Transaction, map[string]Transaction) {
+	t.Helper()
+
+	locked, err := NewTXOutput(50, string(ms.Address()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	prev := Transaction{
+		Version: TxVersion,
+		Inputs:  []TxInput{{ID: []byte{1}, Out: 0}},
+		Outputs: []TxOutput{*locked},
+	}
+	prev.SetID()
+
+	tx := &Transaction{
+		Version: TxVersion,
+		Inputs:  []TxInput{{ID: prev.ID, Out: 0, PubKey: ms.Script()}},
+		Outputs: []TxOutput{{Value: 40, PubKeyHash: locked.PubKeyHash}},
+	}
+	tx.SetID()
+
+	return tx, map[string]Transaction{hex.EncodeToString(prev.ID): prev}
+}
+
+// signatureSet signs the first input of tx with each wallet in the slot of
+// its index, nil wallets leave their slot empty
+func signatureSet(t *testing.T, tx *Transaction, prevTXs map[string]Transaction, wallets ...*wallet.Wallet) []byte {
+	t.Helper()
+
+	txCopy := tx.TrimmedCopy()
+	digest, err := txCopy.inputHash(0, prevTXs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var e utils.Encoder
+	e.WriteUint(uint64(len(wallets)))
+	for _, w := range wallets {
+		if w == nil {
+			e.WriteBytes(nil)
+			continue
+		}
+		sig, err := w.Signer().Sign(digest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		e.WriteBytes(sig)
+	}
+
+	return e.Bytes()
+}
+
+// signMultisig signs tx with the wallet and checks the number of inputs
+// signed
+func signMultisig(t *testing.T, tx *Transaction, prevTXs map[string]Transaction, w *wallet.Wallet, want int) {
+	t.Helper()
+
+	signed, err := tx.SignMultisig(w.Signer(), prevTXs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if signed != want {
+		t.Errorf("%s key signed %d inputs, want %d", w.Type, signed, want)
+	}
+}
+
+func TestVerifyMultisig(t *testing.T) {
+	wallets := makeWallets(t, wallet.KeyTypeP256, wallet.KeyTypeSecp256k1, wallet.KeyTypeEd25519)
+	outsider := makeWallets(t, wallet.KeyTypeP256)[0]
+	ms, err := wallet.NewMultisig(2, [][]byte{wallets[0].PublicKey, wallets[1].PublicKey, wallets[2].PublicKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx, prevTXs := spendMultisig(t, ms)
+	if tx.Verify(prevTXs) {
+		t.Fatal("unsigned multisig input verifies")
+	}
+
+	signMultisig(t, tx, prevTXs, outsider, 0)
+	signMultisig(t, tx, prevTXs, wallets[0], 1)
+	if tx.Verify(prevTXs) {
+		t.Fatal("one of two signatures verifies")
+	}
+
+	signMultisig(t, tx, prevTXs, wallets[2], 1)
+	if !tx.Verify(prevTXs) {
+		t.Fatal("two of two signatures do not verify")
+	}
+
+	// Complete inputs take no more signatures
+	signMultisig(t, tx, prevTXs, wallets[1], 0)
+	if !tx.Verify(prevTXs) {
+		t.Fatal("complete signature set changed")
+	}
+
+	tests := []struct {
+		name    string
+		signers []*wallet.Wallet
+		valid   bool
+	}{
+		{"exactly M", []*wallet.Wallet{wallets[0], wallets[1], nil}, true},
+		{"too few", []*wallet.Wallet{nil, wallets[1], nil}, false},
+		{"too many", []*wallet.Wallet{wallets[0], wallets[1], wallets[2]}, false},
+		{"key outside the list", []*wallet.Wallet{wallets[0], outsider, nil}, false},
+		{"key in another slot", []*wallet.Wallet{wallets[0], nil, wallets[1]}, false},
+		{"missing slot", []*wallet.Wallet{wallets[0], wallets[1]}, false},
+	}
+
+	for _, test := range tests {
+		tx.Inputs[0].Signature = signatureSet(t, tx, prevTXs, test.signers...)
+		if got := tx.Verify(prevTXs); got != test.valid {
+			t.Errorf("%s: Verify() = %v, want %v", test.name, got, test.valid)
+		}
+	}
+}
+
+func TestVerifyMultisigRepeatedKeys(t *testing.T) {
+	w := makeWallets(t, wallet.KeyTypeP256)[0]
+	legacy := legacyWallet(t, w)
+
+	// Scripts listing a key twice are never spendable, however it is written
+	for _, keys := range [][][]byte{{w.PublicKey, w.PublicKey}, {legacy.PublicKey, w.PublicKey}} {
+		ms := &wallet.Multisig{M: 2, PublicKeys: keys}
+		tx, prevTXs := spendMultisig(t, ms)
+
+		tx.Inputs[0].Signature = signatureSet(t, tx, prevTXs, w, w)
+		if tx.Verify(prevTXs) {
+			t.Errorf("script with keys %x verifies", keys)
+		}
+	}
+}
+
+func TestSignMultisigAcrossWallets(t *testing.T) {
+	wallets := makeWallets(t, wallet.KeyTypeP256, wallet.KeyTypeP256, wallet.KeyTypeSecp256k1)
+	legacy := legacyWallet(t, wallets[0])
+
+	// The first key is listed in the layout used before compression
+	ms, err := wallet.NewMultisig(2, [][]byte{legacy.PublicKey, wallets[1].PublicKey, wallets[2].PublicKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx, prevTXs := spendMultisig(t, ms)
+
+	// Each holder signs the transaction received from the previous one
+	for _, w := range []*wallet.Wallet{wallets[0], wallets[2]} {
+		received, err := DeserializeTransaction(tx.Serialize())
+		if err != nil {
+			t.Fatal(err)
+		}
+		tx = &received
+
+		signMultisig(t, tx, prevTXs, w, 1)
+		tx.SetID()
+	}
+
+	if !tx.Verify(prevTXs) {
+		t.Error("transaction signed across wallets does not verify")
+	}
+	if err := tx.CheckID(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,139 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Defines encoding constants
+const (
+	// EncodingMagic is the first byte of every binary encoding
+	// A gob stream can never start with it, which tells the formats apart
+	EncodingMagic = 0xdb
+)
+
+// ErrMalformedEncoding is returned when binary encoded data cannot be decoded
+var ErrMalformedEncoding = errors.New("malformed binary encoding")
+
+// Encoder builds the binary encoding of transactions and blocks
+//
+// Integers are 8 byte big endian, signed ones in two's complement, and byte
+// slices and lists are prefixed with their length, so the same value always
+// encodes to the same bytes.
+type Encoder struct {
+	buf bytes.Buffer
+}
+
+// WriteMagic writes EncodingMagic
+func (e *Encoder) WriteMagic() {
+	e.buf.WriteByte(EncodingMagic)
+}
+
+// WriteUint writes n as 8 big endian bytes
+func (e *Encoder) WriteUint(n uint64) {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], n)
+	e.buf.Write(b[:])
+}
+
+// WriteInt writes n as 8 big endian bytes
+func (e *Encoder) WriteInt(n int64) {
+	e.WriteUint(uint64(n))
+}
+
+// WriteBytes writes the length of data followed by data
+func (e *Encoder) WriteBytes(data []byte) {
+	e.WriteUint(uint64(len(data)))
+	e.buf.Write(data)
+}
+
+// Bytes returns the encoded data
+func (e *Encoder) Bytes() []byte {
+	return e.buf.Bytes()
+}
+
+// IsBinaryEncoding reports whether data starts with EncodingMagic
+func IsBinaryEncoding(data []byte) bool {
+	return len(data) > 0 && data[0] == EncodingMagic
+}
+
+// Decoder reads data written by an Encoder
+type Decoder struct {
+	data []byte
+}
+
+// NewDecoder creates a decoder over data
+func NewDecoder(data []byte) *Decoder {
+	return &Decoder{data}
+}
+
+// ReadMagic reads EncodingMagic
+func (d *Decoder) ReadMagic() error {
+	if !IsBinaryEncoding(d.data) {
+		return fmt.Errorf("%w: missing magic byte", ErrMalformedEncoding)
+	}
+	d.data = d.data[1:]
+
+	return nil
+}
+
+// ReadUint reads 8 big endian bytes
+func (d *Decoder) ReadUint() (uint64, error) {
+	if len(d.data) < 8 {
+		return 0, fmt.Errorf("%w: truncated integer", ErrMalformedEncoding)
+	}
+	n := binary.BigEndian.Uint64(d.data)
+	d.data = d.data[8:]
+
+	return n, nil
+}
+
+// ReadInt reads 8 big endian bytes as a signed integer
+func (d *Decoder) ReadInt() (int64, error) {
+	n, err := d.ReadUint()
+
+	return int64(n), err
+}
+
+// ReadLength reads the length of a list
+// Every element takes at least one byte, so longer lists are refused before
+// anything is allocated for them
+func (d *Decoder) ReadLength() (int, error) {
+	n, err := d.ReadUint()
+	if err != nil {
+		return 0, err
+	}
+	if n > uint64(len(d.data)) {
+		return 0, fmt.Errorf("%w: length %d exceeds data", ErrMalformedEncoding, n)
+	}
+
+	return int(n), nil
+}
+
+// ReadBytes reads a length prefixed byte slice
+func (d *Decoder) ReadBytes() ([]byte, error) {
+	n, err := d.ReadLength()
+	if err != nil {
+		return nil, err
+	}
+	data := append([]byte{}, d.data[:n]...)
+	d.data = d.data[n:]
+
+	return data, nil
+}
+
+// Remaining returns the number of bytes not read yet
+func (d *Decoder) Remaining() int {
+	return len(d.data)
+}
+
+// Finish checks that all the data was read
+func (d *Decoder) Finish() error {
+	if len(d.data) != 0 {
+		return fmt.Errorf("%w: %d trailing bytes", ErrMalformedEncoding, len(d.data))
+	}
+
+	return nil
+}
@@ -1,8 +1,6 @@
 package utils
 
 import (
-	"log"
-
 	"github.com/mr-tron/base58"
 )
 
@@ -14,10 +12,6 @@ func Base58Encode(input []byte) []byte {
 }
 
 // Base58Decode decodes input fro base 58
-func Base58Decode(input []byte) []byte {
-	decode, err := base58.Decode(string(input[:]))
-	if err != nil {
-		log.Panic(err)
-	}
-	return decode
+func Base58Decode(input []byte) ([]byte, error) {
+	return base58.Decode(string(input[:]))
 }
@@ -1,17 +1,14 @@
 package utils
 
 import (
-	"bytes"
 	"encoding/binary"
 )
 
 // ToHex converts number to byte
 func ToHex(num int64) []byte {
-	buff := new(bytes.Buffer)
+	buff := make([]byte, 8)
 
-	err := binary.Write(buff, binary.BigEndian, num)
+	binary.BigEndian.PutUint64(buff, uint64(num))
 
-	HandleError(err)
-
-	return buff.Bytes()
+	return buff
 }
@@ -0,0 +1,30 @@
+//go:build go1.24
+// +build go1.24
+
+package wallet
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"encoding/asn1"
+	"math/big"
+)
+
+// signDeterministic signs the digest with the nonce of RFC 6979
+// crypto/ecdsa signs deterministically, in constant time, when it is given
+// no source of randomness.
+func signDeterministic(key *ecdsa.PrivateKey, digest []byte) (*big.Int, *big.Int, error) {
+	der, err := key.Sign(nil, digest, crypto.SHA256)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var sig struct {
+		R, S *big.Int
+	}
+	if _, err := asn1.Unmarshal(der, &sig); err != nil {
+		return nil, nil, err
+	}
+
+	return sig.R, sig.S, nil
+}
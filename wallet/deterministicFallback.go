@@ -0,0 +1,17 @@
+//go:build !go1.24
+// +build !go1.24
+
+package wallet
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"math/big"
+)
+
+// signDeterministic signs the digest with the nonce of RFC 6979
+// crypto/ecdsa only signs deterministically from Go 1.24 on, older
+// toolchains sign with signRFC6979.
+func signDeterministic(key *ecdsa.PrivateKey, digest []byte) (*big.Int, *big.Int, error) {
+	return signRFC6979(key, digest, rand.Reader)
+}
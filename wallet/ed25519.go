@@ -0,0 +1,44 @@
+package wallet
+
+import (
+	"crypto/ed25519"
+)
+
+// Ed25519 private keys are the 32 byte seeds of RFC 8032 and signatures are
+// 64 bytes as well.
+
+// ed25519PublicKeyLength is the length of an Ed25519 public key
+const ed25519PublicKeyLength = ed25519.PublicKeySize
+
+// ed25519PublicKey gets the public key of an Ed25519 seed
+func ed25519PublicKey(secret []byte) []byte {
+	return ed25519.NewKeyFromSeed(secret).Public().(ed25519.PublicKey)
+}
+
+// ed25519Sign signs the digest with an Ed25519 seed
+func ed25519Sign(secret, digest []byte) ([]byte, error) {
+	return ed25519.Sign(ed25519.NewKeyFromSeed(secret), digest), nil
+}
+
+// ed25519Verifier checks Ed25519 signatures
+type ed25519Verifier struct {
+	key ed25519.PublicKey
+}
+
+// parseEd25519Verifier reads an Ed25519 public key
+func parseEd25519Verifier(publicKey []byte) (Verifier, error) {
+	if len(publicKey) != ed25519PublicKeyLength {
+		return nil, ErrInvalidPublicKey
+	}
+
+	return ed25519Verifier{publicKey}, nil
+}
+
+// Verify checks a signature of the digest
+func (v ed25519Verifier) Verify(digest, signature []byte) bool {
+	if len(signature) != ed25519.SignatureSize {
+		return false
+	}
+
+	return ed25519.Verify(v.key, digest, signature)
+}
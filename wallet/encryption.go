@@ -0,0 +1,234 @@
+package wallet
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"digitalWallet/utils"
+	"fmt"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/scrypt"
+)
+
+// encryption holds what is needed to encrypt the private keys at rest
+//
+// Encrypted secrets are written as
+//
+//	scrypt N, r, p  int
+//	salt            bytes
+//	nonce           bytes
+//	ciphertext      bytes
+//
+// The key is derived from the passphrase with scrypt and the secrets are
+// sealed with ChaCha20-Poly1305. Every byte of the file before the
+// ciphertext is authenticated with it, so public keys cannot be swapped.
+type encryption struct {
+	n, r, p int
+	salt    []byte
+
+	// key is derived from the passphrase, nil while locked
+	key []byte
+
+	// header and ciphertext are kept from the file until it is unlocked
+	header     []byte
+	nonce      []byte
+	ciphertext []byte
+}
+
+// Defines encryption constants
+const (
+	// scryptN, scryptR and scryptP are the cost parameters of new keys
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+
+	saltLength = 16
+)
+
+// newEncryption derives a key from the passphrase with a fresh salt
+func newEncryption(passphrase []byte) (*encryption, error) {
+	if len(passphrase) == 0 {
+		return nil, ErrEmptyPassphrase
+	}
+
+	enc := &encryption{n: scryptN, r: scryptR, p: scryptP, salt: make([]byte, saltLength)}
+	if _, err := rand.Read(enc.salt); err != nil {
+		return nil, err
+	}
+
+	key, err := enc.deriveKey(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	enc.key = key
+
+	return enc, nil
+}
+
+// openEncryption reads the encrypted private keys of the file content
+// The returned encryption is locked
+func openEncryption(d *utils.Decoder, content []byte) (*encryption, error) {
+	var enc encryption
+
+	params := []*int{&enc.n, &enc.r, &enc.p}
+	for _, param := range params {
+		n, err := d.ReadInt()
+		if err != nil {
+			return nil, err
+		}
+		*param = int(n)
+	}
+
+	var err error
+	if enc.salt, err = d.ReadBytes(); err != nil {
+		return nil, err
+	}
+	if enc.nonce, err = d.ReadBytes(); err != nil {
+		return nil, err
+	}
+
+	enc.header = content[:len(content)-d.Remaining()]
+	if enc.ciphertext, err = d.ReadBytes(); err != nil {
+		return nil, err
+	}
+
+	return &enc, d.Finish()
+}
+
+// deriveKey derives the encryption key from the passphrase
+func (enc *encryption) deriveKey(passphrase []byte) ([]byte, error) {
+	key, err := scrypt.Key(passphrase, enc.salt, enc.n, enc.r, enc.p, chacha20poly1305.KeySize)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBadWalletFile, err)
+	}
+
+	return key, nil
+}
+
+// open decrypts the private keys read by openEncryption and keeps the key
+func (enc *encryption) open(passphrase []byte) ([]byte, error) {
+	key, err := enc.deriveKey(passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := chacha20poly1305.New(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(enc.nonce) != aead.NonceSize() {
+		return nil, fmt.Errorf("%w: nonce of %d bytes", ErrBadWalletFile, len(enc.nonce))
+	}
+
+	plaintext, err := aead.Open(nil, enc.nonce, enc.ciphertext, enc.header)
+	if err != nil {
+		return nil, ErrBadPassphrase
+	}
+	enc.key = key
+
+	return plaintext, nil
+}
+
+// seal writes the encrypted private keys after the header already in e
+func (enc *encryption) seal(e *utils.Encoder, plaintext []byte) error {
+	aead, err := chacha20poly1305.New(enc.key)
+	if err != nil {
+		return err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+
+	e.WriteInt(int64(enc.n))
+	e.WriteInt(int64(enc.r))
+	e.WriteInt(int64(enc.p))
+	e.WriteBytes(enc.salt)
+	e.WriteBytes(nonce)
+
+	header := append([]byte{}, e.Bytes()...)
+	e.WriteBytes(aead.Seal(nil, nonce, plaintext, header))
+
+	return nil
+}
+
+// IsEncrypted reports whether the private keys are encrypted at rest
+func (ws *Wallets) IsEncrypted() bool {
+	return ws.encryption != nil
+}
+
+// IsLocked reports whether the private keys are still encrypted
+func (ws *Wallets) IsLocked() bool {
+	return ws.locked
+}
+
+// Unlock decrypts the private keys with the passphrase
+func (ws *Wallets) Unlock(passphrase []byte) error {
+	if ws.encryption == nil {
+		return ErrWalletNotEncrypted
+	}
+	if !ws.locked {
+		return nil
+	}
+
+	plaintext, err := ws.encryption.open(passphrase)
+	if err != nil {
+		return err
+	}
+
+	d := utils.NewDecoder(plaintext)
+	if err := ws.decodeSecrets(d); err != nil {
+		return err
+	}
+	ws.locked = false
+
+	return nil
+}
+
+// Encrypt encrypts the private keys with the passphrase from the next
+// SaveFile on
+func (ws *Wallets) Encrypt(passphrase []byte) error {
+	if ws.encryption != nil {
+		return ErrWalletEncrypted
+	}
+
+	enc, err := newEncryption(passphrase)
+	if err != nil {
+		return err
+	}
+	ws.encryption = enc
+
+	return nil
+}
+
+// ChangePassphrase encrypts the private keys with a new passphrase from the
+// next SaveFile on
+// The current passphrase is checked even when the wallet is unlocked
+func (ws *Wallets) ChangePassphrase(current, passphrase []byte) error {
+	if ws.encryption == nil {
+		return ErrWalletNotEncrypted
+	}
+
+	if ws.locked {
+		if err := ws.Unlock(current); err != nil {
+			return err
+		}
+	} else {
+		key, err := ws.encryption.deriveKey(current)
+		if err != nil {
+			return err
+		}
+		if subtle.ConstantTimeCompare(key, ws.encryption.key) != 1 {
+			return ErrBadPassphrase
+		}
+	}
+
+	enc, err := newEncryption(passphrase)
+	if err != nil {
+		return err
+	}
+	ws.encryption = enc
+
+	return nil
+}
@@ -0,0 +1,212 @@
+package wallet
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// newEncryptedFile saves a wallets file holding a derived and an imported
+// address encrypted with the passphrase, and returns its path and wallets
+func newEncryptedFile(t *testing.T, passphrase []byte) (string, map[string]Wallet) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), DefaultWalletName+walletFileExt)
+	ws, err := CreateWallets(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+
+	mnemonic, err := NewMnemonic()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ws.SetMnemonic(mnemonic); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ws.AddWallet(KeyTypeP256); err != nil {
+		t.Fatal(err)
+	}
+	imported := makeWallets(t, KeyTypeEd25519)[0]
+	if _, err := ws.ImportPrivateKey(EncodePrivateKey(imported)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ws.Unlock(passphrase); !errors.Is(err, ErrWalletNotEncrypted) {
+		t.Errorf("unlocking a plain wallet gave %v, want %v", err, ErrWalletNotEncrypted)
+	}
+	if err := ws.Encrypt(nil); !errors.Is(err, ErrEmptyPassphrase) {
+		t.Errorf("empty passphrase gave %v, want %v", err, ErrEmptyPassphrase)
+	}
+	if err := ws.Encrypt(passphrase); err != nil {
+		t.Fatal(err)
+	}
+	if err := ws.Encrypt(passphrase); !errors.Is(err, ErrWalletEncrypted) {
+		t.Errorf("encrypting twice gave %v, want %v", err, ErrWalletEncrypted)
+	}
+	if err := ws.SaveFile(); err != nil {
+		t.Fatal(err)
+	}
+
+	wallets := make(map[string]Wallet)
+	for address, w := range ws.Wallets {
+		wallets[address] = *w
+	}
+
+	return path, wallets
+}
+
+// loadLocked loads a wallets file and checks that it is locked
+func loadLocked(t *testing.T, path string) *Wallets {
+	t.Helper()
+
+	ws, err := LoadWallets(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ws.IsEncrypted() || !ws.IsLocked() {
+		t.Fatalf("wallets loaded encrypted %v and locked %v", ws.IsEncrypted(), ws.IsLocked())
+	}
+
+	return ws
+}
+
+// checkUnlocked checks that the wallets hold the private keys of want
+func checkUnlocked(t *testing.T, ws *Wallets, want map[string]Wallet) {
+	t.Helper()
+
+	if ws.IsLocked() {
+		t.Fatal("wallets are still locked")
+	}
+	for address, w := range want {
+		got, err := ws.GetWallet(address)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got.PrivateKey, w.PrivateKey) {
+			t.Errorf("private key of %s changed", address)
+		}
+	}
+	if ws.Mnemonic() == "" {
+		t.Error("mnemonic was not decrypted")
+	}
+}
+
+func TestEncryptUnlock(t *testing.T) {
+	passphrase := []byte("correct horse")
+	path, wallets := newEncryptedFile(t, passphrase)
+
+	ws := loadLocked(t, path)
+	for address, w := range wallets {
+		if _, err := ws.GetWallet(address); !errors.Is(err, ErrWalletLocked) {
+			t.Errorf("locked wallet gave %v, want %v", err, ErrWalletLocked)
+		}
+		if publicKey, err := ws.PublicKey(address); err != nil || !bytes.Equal(publicKey, w.PublicKey) {
+			t.Errorf("public key of %s is %x, %v", address, publicKey, err)
+		}
+	}
+	if ws.Mnemonic() != "" {
+		t.Error("mnemonic is readable while locked")
+	}
+
+	if err := ws.Unlock([]byte("wrong horse")); !errors.Is(err, ErrBadPassphrase) {
+		t.Fatalf("wrong passphrase gave %v, want %v", err, ErrBadPassphrase)
+	}
+	if !ws.IsLocked() {
+		t.Fatal("wrong passphrase unlocked the wallets")
+	}
+	if err := ws.Unlock(passphrase); err != nil {
+		t.Fatal(err)
+	}
+	checkUnlocked(t, ws, wallets)
+}
+
+func TestChangePassphrase(t *testing.T) {
+	current, next := []byte("correct horse"), []byte("battery staple")
+	path, wallets := newEncryptedFile(t, current)
+
+	ws, err := CreateWallets(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+
+	if err := ws.ChangePassphrase(next, next); !errors.Is(err, ErrBadPassphrase) {
+		t.Errorf("wrong passphrase gave %v, want %v", err, ErrBadPassphrase)
+	}
+	if err := ws.Unlock(current); err != nil {
+		t.Fatal(err)
+	}
+
+	// The current passphrase is checked on unlocked wallets too
+	if err := ws.ChangePassphrase(next, next); !errors.Is(err, ErrBadPassphrase) {
+		t.Errorf("wrong passphrase of unlocked wallets gave %v, want %v", err, ErrBadPassphrase)
+	}
+	if err := ws.ChangePassphrase(current, nil); !errors.Is(err, ErrEmptyPassphrase) {
+		t.Errorf("empty passphrase gave %v, want %v", err, ErrEmptyPassphrase)
+	}
+	if err := ws.ChangePassphrase(current, next); err != nil {
+		t.Fatal(err)
+	}
+	if err := ws.SaveFile(); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded := loadLocked(t, path)
+	if err := reloaded.Unlock(current); !errors.Is(err, ErrBadPassphrase) {
+		t.Errorf("old passphrase gave %v, want %v", err, ErrBadPassphrase)
+	}
+	if err := reloaded.Unlock(next); err != nil {
+		t.Fatal(err)
+	}
+	checkUnlocked(t, reloaded, wallets)
+}
+
+func TestEncryptedFileTampered(t *testing.T) {
+	passphrase := []byte("correct horse")
+	path, wallets := newEncryptedFile(t, passphrase)
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Swaps a public key for another one of the same length
+	var swapped []byte
+	for _, w := range wallets {
+		other := makeWallets(t, w.Type)[0]
+		swapped = bytes.Replace(content, w.PublicKey, other.PublicKey, 1)
+		break
+	}
+
+	flipped := append([]byte{}, content...)
+	flipped[len(flipped)-1] ^= 1
+
+	tests := []struct {
+		name    string
+		content []byte
+	}{
+		{"ciphertext", flipped},
+		{"public key", swapped},
+	}
+
+	for _, test := range tests {
+		if bytes.Equal(test.content, content) {
+			t.Fatalf("%s: file was not changed", test.name)
+		}
+		tampered := filepath.Join(t.TempDir(), "tampered"+walletFileExt)
+		if err := ioutil.WriteFile(tampered, test.content, 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		ws := loadLocked(t, tampered)
+		if err := ws.Unlock(passphrase); !errors.Is(err, ErrBadPassphrase) {
+			t.Errorf("%s: tampered file gave %v, want %v", test.name, err, ErrBadPassphrase)
+		}
+		if !ws.IsLocked() {
+			t.Errorf("%s: tampered file was unlocked", test.name)
+		}
+	}
+}
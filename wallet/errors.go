@@ -0,0 +1,73 @@
+package wallet
+
+import "errors"
+
+// Defines wallet errors
+var (
+	// ErrInvalidAddress is returned for addresses that fail to decode or checksum
+	ErrInvalidAddress = errors.New("address is not valid")
+
+	// ErrWalletNotFound is returned when no wallet holds the address
+	ErrWalletNotFound = errors.New("wallet not found")
+
+	// ErrInvalidPrivateKey is returned for private keys that fail to decode or checksum
+	ErrInvalidPrivateKey = errors.New("private key is not valid")
+
+	// ErrInvalidSignature is returned for signatures that fail to decode or verify
+	ErrInvalidSignature = errors.New("signature is not valid")
+
+	// ErrInvalidPublicKey is returned for public keys that are not points of the curve
+	ErrInvalidPublicKey = errors.New("public key is not valid")
+
+	// ErrUnknownKeyType is returned for key types that have no signature scheme
+	ErrUnknownKeyType = errors.New("key type is not known")
+
+	// ErrInvalidMultisig is returned for multisig scripts that fail to decode or
+	// have keys that are not valid
+	ErrInvalidMultisig = errors.New("multisig is not valid")
+
+	// ErrNotMultisigKey is returned when signing a multisig with a key it does not list
+	ErrNotMultisigKey = errors.New("key is not one of the multisig keys")
+
+	// ErrWatchOnly is returned when the private key of a watch-only address is needed
+	ErrWatchOnly = errors.New("address is watch-only, its private key is not in the wallet")
+
+	// ErrAddressExists is returned when importing an address the wallet already has
+	ErrAddressExists = errors.New("address is already in the wallet")
+
+	// ErrInvalidWalletName is returned for wallet names that cannot name a file
+	ErrInvalidWalletName = errors.New("wallet name is not valid")
+
+	// ErrWalletBusy is returned when another process holds the wallets file
+	ErrWalletBusy = errors.New("wallet is in use by another process")
+
+	// ErrWalletReadOnly is returned when saving wallets loaded read only
+	ErrWalletReadOnly = errors.New("wallet was loaded read only")
+
+	// ErrWalletLocked is returned when a private key of a locked wallet is needed
+	ErrWalletLocked = errors.New("wallet is locked, a passphrase is needed")
+
+	// ErrBadPassphrase is returned when a passphrase does not decrypt the wallet
+	ErrBadPassphrase = errors.New("passphrase is not valid")
+
+	// ErrEmptyPassphrase is returned when encrypting with an empty passphrase
+	ErrEmptyPassphrase = errors.New("passphrase is empty")
+
+	// ErrWalletEncrypted is returned when encrypting an encrypted wallet
+	ErrWalletEncrypted = errors.New("wallet is already encrypted")
+
+	// ErrWalletNotEncrypted is returned when unlocking a wallet that is not encrypted
+	ErrWalletNotEncrypted = errors.New("wallet is not encrypted")
+
+	// ErrInvalidMnemonic is returned for mnemonics that fail to decode or checksum
+	ErrInvalidMnemonic = errors.New("mnemonic is not valid")
+
+	// ErrNoMnemonic is returned when deriving an address without a mnemonic
+	ErrNoMnemonic = errors.New("wallet has no mnemonic")
+
+	// ErrMnemonicExists is returned when giving a mnemonic to wallets that have another one
+	ErrMnemonicExists = errors.New("wallet already has a mnemonic")
+
+	// ErrBadWalletFile is returned when the wallets file cannot be read
+	ErrBadWalletFile = errors.New("wallets file is not valid")
+)
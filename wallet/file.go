@@ -0,0 +1,177 @@
+package wallet
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Defines wallets file handling constants
+const (
+	// MaxWalletBackups is how many backups are kept next to a wallets file
+	MaxWalletBackups = 10
+
+	// backupExt ends the names of the backups of a wallets file
+	backupExt = ".bak"
+
+	// lockExt ends the name of the lock file of a wallets file
+	lockExt = ".lock"
+
+	// backupTimeFormat orders backups by name
+	backupTimeFormat = "20060102T150405.000000000"
+)
+
+// writeFileSync writes content to path and flushes it to the disk
+// Unless replace is set the file must not exist
+func writeFileSync(path string, content []byte, replace bool) error {
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if !replace {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	}
+
+	f, err := os.OpenFile(path, flags, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(content); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// syncDir flushes the entries of the directory to the disk
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	return d.Sync()
+}
+
+// writeFileAtomic replaces the file at path with content
+//
+// The content is written and flushed to a temporary file that is renamed
+// over path, so a crash leaves either the old or the new file. The old file
+// is backed up first.
+func writeFileAtomic(path string, content []byte) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+
+	tmpFile := path + ".tmp"
+	if err := writeFileSync(tmpFile, content, true); err != nil {
+		return err
+	}
+	if err := backupFile(path); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpFile, path); err != nil {
+		return err
+	}
+
+	return syncDir(dir)
+}
+
+// backupFile copies the file at path to a timestamped backup next to it
+// Only the MaxWalletBackups most recent backups are kept
+func backupFile(path string) error {
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	backup := path + "." + time.Now().UTC().Format(backupTimeFormat) + backupExt
+	if err := writeFileSync(backup, content, false); err != nil {
+		return err
+	}
+
+	backups, err := listBackups(path)
+	if err != nil {
+		return err
+	}
+	for len(backups) > MaxWalletBackups {
+		if err := os.Remove(backups[0]); err != nil {
+			return err
+		}
+		backups = backups[1:]
+	}
+
+	return nil
+}
+
+// listBackups lists the backups of the file at path, oldest first
+func listBackups(path string) ([]string, error) {
+	dir, base := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var backups []string
+	for _, file := range files {
+		name := file.Name()
+		if !file.IsDir() && strings.HasPrefix(name, base+".") && strings.HasSuffix(name, backupExt) {
+			backups = append(backups, filepath.Join(dir, name))
+		}
+	}
+	sort.Strings(backups)
+
+	return backups, nil
+}
+
+// acquireLock takes the lock of the wallets file at path
+// It fails with ErrWalletBusy while another process holds it
+func acquireLock(path string) (*os.File, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(path+lockExt, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if err := lockFile(f); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// BackupFile copies the wallets file at path to out
+// The copy keeps the encryption of the file, out must not exist yet
+func BackupFile(path, out string) error {
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("%w: %s", ErrWalletNotFound, path)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := writeFileSync(out, content, false); err != nil {
+		return err
+	}
+
+	return syncDir(filepath.Dir(out))
+}
@@ -0,0 +1,261 @@
+package wallet
+
+import (
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+
+	"github.com/tyler-smith/go-bip39"
+)
+
+// ExtendedKey is a private key with the chain code needed to derive its
+// children
+//
+// Keys are derived as in BIP32 for each key type, following SLIP-0010 for
+// the curve specific parts. Ed25519 keys only have hardened children.
+type ExtendedKey struct {
+	Type      KeyType
+	Key       []byte
+	ChainCode []byte
+}
+
+// Defines key derivation constants
+const (
+	// HardenedOffset is added to the index of hardened children
+	HardenedOffset uint32 = 0x80000000
+
+	// AddressPurpose is the BIP43 purpose of address paths, "dw" in ASCII
+	// It is not the BIP44 purpose so that no key is shared with another
+	// chain using the same mnemonic, secp256k1 keys with Bitcoin in
+	// particular.
+	AddressPurpose uint32 = 0x6477
+
+	// mnemonicEntropy is the entropy of new mnemonics in bits, 12 words
+	mnemonicEntropy = 128
+)
+
+// AddressPath gets the derivation path of the receiving addresses of the key
+// type, the address index is appended to it
+//
+//	m/purpose'/type'/0'/0
+//
+// The key type takes the place of the BIP44 coin type, and addresses belong
+// to the first account. Every index of Ed25519 keys is hardened, see Child.
+func AddressPath(t KeyType) []uint32 {
+	return []uint32{AddressPurpose + HardenedOffset, uint32(t) + HardenedOffset, HardenedOffset, 0}
+}
+
+// NewMnemonic generates a new BIP39 mnemonic
+func NewMnemonic() (string, error) {
+	entropy, err := bip39.NewEntropy(mnemonicEntropy)
+	if err != nil {
+		return "", err
+	}
+
+	return bip39.NewMnemonic(entropy)
+}
+
+// MnemonicSeed checks the mnemonic and gets its BIP39 seed
+func MnemonicSeed(mnemonic string) ([]byte, error) {
+	seed, err := bip39.NewSeedWithErrorChecking(mnemonic, "")
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidMnemonic, err)
+	}
+
+	return seed, nil
+}
+
+// NewMasterKey derives the master key of the type of the seed
+func NewMasterKey(t KeyType, seed []byte) *ExtendedKey {
+	seedKey := []byte(schemes[t].seedKey)
+	I := hmacSHA512(seedKey, seed)
+
+	// Values outside of the curve order are hashed again
+	for !validSecret(t, I[:32]) {
+		I = hmacSHA512(seedKey, I)
+	}
+
+	return &ExtendedKey{Type: t, Key: I[:32], ChainCode: I[32:]}
+}
+
+// Child derives the child key at index
+// Indexes from HardenedOffset on derive hardened children, Ed25519 keys
+// derive hardened children for every index.
+func (k *ExtendedKey) Child(index uint32) *ExtendedKey {
+	s := schemes[k.Type]
+	n := s.order
+	if n == nil {
+		index |= HardenedOffset
+	}
+
+	var data []byte
+	if index >= HardenedOffset {
+		data = append([]byte{0}, k.Key...)
+	} else {
+		data = s.publicKey(k.Key)
+	}
+	data = appendIndex(data, index)
+
+	// Keys that are not scalars are the left half
+	if n == nil {
+		I := hmacSHA512(k.ChainCode, data)
+		return &ExtendedKey{Type: k.Type, Key: I[:32], ChainCode: I[32:]}
+	}
+
+	parent := new(big.Int).SetBytes(k.Key)
+	for {
+		I := hmacSHA512(k.ChainCode, data)
+
+		tweak := new(big.Int).SetBytes(I[:32])
+		if tweak.Cmp(n) < 0 {
+			key := tweak.Add(tweak, parent)
+			key.Mod(key, n)
+			if key.Sign() != 0 {
+				return &ExtendedKey{Type: k.Type, Key: key.FillBytes(make([]byte, 32)), ChainCode: I[32:]}
+			}
+		}
+
+		// Invalid keys are derived again from the right half
+		data = appendIndex(append([]byte{1}, I[32:]...), index)
+	}
+}
+
+// Derive derives the key at path below k
+func (k *ExtendedKey) Derive(path []uint32) *ExtendedKey {
+	key := k
+	for _, index := range path {
+		key = key.Child(index)
+	}
+
+	return key
+}
+
+// Wallet creates the wallet of the key
+func (k *ExtendedKey) Wallet() *Wallet {
+	return newWallet(k.Type, k.Key, true)
+}
+
+// appendIndex appends the child index as 4 big endian bytes
+func appendIndex(data []byte, index uint32) []byte {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], index)
+
+	return append(data, b[:]...)
+}
+
+// hmacSHA512 computes the HMAC-SHA512 of data
+func hmacSHA512(key, data []byte) []byte {
+	mac := hmac.New(sha512.New, key)
+	mac.Write(data)
+
+	return mac.Sum(nil)
+}
+
+// deriveWallet derives the wallet of the address at index
+func deriveWallet(master *ExtendedKey, index int) *Wallet {
+	return master.Derive(AddressPath(master.Type)).Child(uint32(index)).Wallet()
+}
+
+// masterKey derives the master key of the type of the mnemonic
+func (ws *Wallets) masterKey(t KeyType) (*ExtendedKey, error) {
+	if ws.mnemonic == "" {
+		return nil, ErrNoMnemonic
+	}
+
+	seed, err := MnemonicSeed(ws.mnemonic)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewMasterKey(t, seed), nil
+}
+
+// Mnemonic gets the mnemonic addresses are derived from
+// It is empty while the wallets are locked or when there is none
+func (ws *Wallets) Mnemonic() string {
+	return ws.mnemonic
+}
+
+// SetMnemonic sets the mnemonic new addresses are derived from
+// Wallets with a mnemonic keep it, addresses they already hold are kept too
+func (ws *Wallets) SetMnemonic(mnemonic string) error {
+	if ws.locked {
+		return ErrWalletLocked
+	}
+	if ws.mnemonic != "" {
+		return ErrMnemonicExists
+	}
+	if _, err := MnemonicSeed(mnemonic); err != nil {
+		return err
+	}
+
+	ws.mnemonic = mnemonic
+	ws.next = nil
+
+	return nil
+}
+
+// Restore adds the addresses derived from the mnemonic that were used
+//
+// Addresses of each key type are derived in order until gap unused ones in
+// a row are found, used reports whether an address has any activity. Every
+// address up to the last used one is added and new addresses are derived
+// after it. Wallets without a mnemonic take this one. It returns the
+// restored addresses.
+func (ws *Wallets) Restore(mnemonic string, gap int, used func(address string) (bool, error)) ([]string, error) {
+	if ws.locked {
+		return nil, ErrWalletLocked
+	}
+	if ws.mnemonic != "" && ws.mnemonic != mnemonic {
+		return nil, ErrMnemonicExists
+	}
+
+	seed, err := MnemonicSeed(mnemonic)
+	if err != nil {
+		return nil, err
+	}
+
+	restored := make(map[KeyType][]*Wallet)
+	for _, t := range KeyTypes {
+		master := NewMasterKey(t, seed)
+
+		var derived []*Wallet
+		last := -1
+		for index := 0; index-last <= gap; index++ {
+			wallet := deriveWallet(master, index)
+			derived = append(derived, wallet)
+
+			isUsed, err := used(string(wallet.Address()))
+			if err != nil {
+				return nil, err
+			}
+			if isUsed {
+				last = index
+			}
+		}
+		restored[t] = derived[:last+1]
+	}
+
+	ws.mnemonic = mnemonic
+	if ws.next == nil {
+		ws.next = make(map[KeyType]int)
+	}
+
+	var addresses []string
+	for _, t := range KeyTypes {
+		if len(restored[t]) > ws.next[t] {
+			ws.next[t] = len(restored[t])
+		}
+
+		for _, wallet := range restored[t] {
+			address := string(wallet.Address())
+			ws.Wallets[address] = wallet
+			delete(ws.watchOnly, address)
+			addresses = append(addresses, address)
+		}
+	}
+
+	return addresses, nil
+}
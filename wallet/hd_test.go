@@ -0,0 +1,133 @@
+package wallet
+
+import (
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+func TestMnemonicSeed(t *testing.T) {
+	// BIP39 seed of the mnemonic without a passphrase
+	const mnemonic = "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"
+	const want = "5eb00bbddcf069084889a8ab9155568165f5c453ccb85e70811aaed6f6da5fc1" +
+		"9a5ac40b389cd370d086206dec8aa6c43daea6690f20ad3d8d48b2d2ce9e38e4"
+
+	seed, err := MnemonicSeed(mnemonic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hex.EncodeToString(seed); got != want {
+		t.Errorf("seed %s, want %s", got, want)
+	}
+
+	for _, bad := range []string{
+		"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon",
+		"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon notaword",
+		"",
+	} {
+		if _, err := MnemonicSeed(bad); !errors.Is(err, ErrInvalidMnemonic) {
+			t.Errorf("mnemonic %q gave %v, want %v", bad, err, ErrInvalidMnemonic)
+		}
+	}
+
+	generated, err := NewMnemonic()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := MnemonicSeed(generated); err != nil {
+		t.Errorf("new mnemonic %q is not valid: %v", generated, err)
+	}
+}
+
+func TestDeriveVectors(t *testing.T) {
+	// SLIP-0010 test vector 1 for each curve, BIP32 for secp256k1
+	seed, _ := hex.DecodeString("000102030405060708090a0b0c0d0e0f")
+
+	tests := []struct {
+		keyType   KeyType
+		path      []uint32
+		chainCode string
+		key       string
+	}{
+		{KeyTypeP256, nil,
+			"beeb672fe4621673f722f38529c07392fecaa61015c80c34f29ce8b41b3cb6ea",
+			"612091aaa12e22dd2abef664f8a01a82cae99ad7441b7ef8110424915c268bc2"},
+		{KeyTypeP256, []uint32{HardenedOffset},
+			"3460cea53e6a6bb5fb391eeef3237ffd8724bf0a40e94943c98b83825342ee11",
+			"6939694369114c67917a182c59ddb8cafc3004e63ca5d3b84403ba8613debc0c"},
+		{KeyTypeP256, []uint32{HardenedOffset, 1},
+			"4187afff1aafa8445010097fb99d23aee9f599450c7bd140b6826ac22ba21d0c",
+			"284e9d38d07d21e4e281b645089a94f4cf5a5a81369acf151a1c3a57f18b2129"},
+		{KeyTypeSecp256k1, nil,
+			"873dff81c02f525623fd1fe5167eac3a55a049de3d314bb42ee227ffed37d508",
+			"e8f32e723decf4051aefac8e2c93c9c5b214313817cdb01a1494b917c8436b35"},
+		{KeyTypeSecp256k1, []uint32{HardenedOffset},
+			"47fdacbd0f1097043b78c63c20c34ef4ed9a111d980047ad16282c7ae6236141",
+			"edb2e14f9ee77d26dd93b4ecede8d16ed408ce149b6cd80b0715a2d911a0afea"},
+		{KeyTypeSecp256k1, []uint32{HardenedOffset, 1},
+			"2a7857631386ba23dacac34180dd1983734e444fdbf774041578e9b6adb37c19",
+			"3c6cb8d0f6a264c91ea8b5030fadaa8e538b020f0a387421a12de9319dc93368"},
+		{KeyTypeEd25519, nil,
+			"90046a93de5380a72b5e45010748567d5ea02bbf6522f979e05c0d8d8ca9fffb",
+			"2b4be7f19ee27bbf30c667b642d5f4aa69fd169872f8fc3059c08ebae2eb19e7"},
+		{KeyTypeEd25519, []uint32{HardenedOffset},
+			"8b59aa11380b624e81507a27fedda59fea6d0b779a778918a2fd3590e16e9c69",
+			"68e0fe46dfb67e368c75379acec591dad19df3cde26e63b93a8e704f1dade7a3"},
+		{KeyTypeEd25519, []uint32{HardenedOffset, HardenedOffset + 1},
+			"a320425f77d1b5c2505a6b1b27382b37368ee640e3557c315416801243552f14",
+			"b1d0bad404bf35da785a64ca1ac54b2617211d2777696fbffaf208f746ae84f2"},
+	}
+
+	for _, test := range tests {
+		key := NewMasterKey(test.keyType, seed).Derive(test.path)
+		if got := hex.EncodeToString(key.ChainCode); got != test.chainCode {
+			t.Errorf("%s %v: chain code %s, want %s", test.keyType, test.path, got, test.chainCode)
+		}
+		if got := hex.EncodeToString(key.Key); got != test.key {
+			t.Errorf("%s %v: key %s, want %s", test.keyType, test.path, got, test.key)
+		}
+	}
+}
+
+func TestDeriveEd25519Hardened(t *testing.T) {
+	// Every Ed25519 child is hardened
+	master := NewMasterKey(KeyTypeEd25519, make([]byte, 16))
+	normal, hardened := master.Child(1), master.Child(HardenedOffset+1)
+	if hex.EncodeToString(normal.Key) != hex.EncodeToString(hardened.Key) {
+		t.Errorf("child 1 is %x, want the hardened child %x", normal.Key, hardened.Key)
+	}
+}
+
+func TestAddWalletDerivesAddresses(t *testing.T) {
+	const mnemonic = "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"
+	seed, err := MnemonicSeed(mnemonic)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ws := &Wallets{Wallets: make(map[string]*Wallet)}
+	if _, err := ws.AddWallet(KeyTypeP256); !errors.Is(err, ErrNoMnemonic) {
+		t.Errorf("wallets without a mnemonic gave %v, want %v", err, ErrNoMnemonic)
+	}
+	if err := ws.SetMnemonic(mnemonic); err != nil {
+		t.Fatal(err)
+	}
+	if err := ws.SetMnemonic(mnemonic); !errors.Is(err, ErrMnemonicExists) {
+		t.Errorf("setting the mnemonic twice gave %v, want %v", err, ErrMnemonicExists)
+	}
+
+	// Addresses of each type are derived in order along their own path
+	for _, keyType := range KeyTypes {
+		master := NewMasterKey(keyType, seed)
+		for index := 0; index < 2; index++ {
+			address, err := ws.AddWallet(keyType)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := string(master.Derive(append(AddressPath(keyType), uint32(index))).Wallet().Address())
+			if address != want {
+				t.Errorf("%s address %d is %s, want %s", keyType, index, address, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package wallet
+
+import (
+	"bytes"
+	"digitalWallet/utils"
+	"fmt"
+	"sort"
+)
+
+// Defines private key encoding constants
+//
+// A private key is encoded like an address, in Base58 of
+//
+//	version     1 byte, privateKeyVersion
+//	private key 32 bytes, big endian for scalars
+//	compressed  1 byte, compressedFlag, left out for keys whose public key
+//	            has the layout used before compression
+//	key type    1 byte, left out for P-256 keys
+//	checksum    4 bytes, see Checksum
+//
+// so that a mistyped key is refused instead of imported and an imported key
+// keeps its address.
+const (
+	privateKeyVersion = byte(0x80)
+	privateKeyLength  = 32
+	compressedFlag    = byte(0x01)
+)
+
+// EncodePrivateKey encodes the private key of the wallet
+func EncodePrivateKey(w *Wallet) string {
+	versioned := append([]byte{privateKeyVersion}, w.PrivateKey...)
+	if w.Type != KeyTypeP256 || len(w.PublicKey) == CompressedKeyLength {
+		versioned = append(versioned, compressedFlag)
+	}
+	if w.Type != KeyTypeP256 {
+		versioned = append(versioned, byte(w.Type))
+	}
+
+	return string(utils.Base58Encode(append(versioned, Checksum(versioned)...)))
+}
+
+// DecodePrivateKey validates an encoded private key and returns its wallet
+func DecodePrivateKey(key string) (*Wallet, error) {
+	decoded, err := utils.Base58Decode([]byte(key))
+	if err != nil || len(decoded) <= checksumLength || decoded[0] != privateKeyVersion {
+		return nil, ErrInvalidPrivateKey
+	}
+
+	versioned := decoded[:len(decoded)-checksumLength]
+	if !bytes.Equal(decoded[len(versioned):], Checksum(versioned)) {
+		return nil, ErrInvalidPrivateKey
+	}
+
+	t := KeyTypeP256
+	compressed := false
+	switch len(versioned) {
+	case 1 + privateKeyLength:
+	case 1 + privateKeyLength + 1:
+		compressed = versioned[len(versioned)-1] == compressedFlag
+	case 1 + privateKeyLength + 2:
+		// Types other than P-256 are always written with their type
+		t = KeyType(versioned[len(versioned)-1])
+		compressed = versioned[len(versioned)-2] == compressedFlag && t != KeyTypeP256 && t.IsValid()
+	}
+	if !compressed && len(versioned) != 1+privateKeyLength {
+		return nil, ErrInvalidPrivateKey
+	}
+	secret := versioned[1 : 1+privateKeyLength]
+
+	// The private key must be a valid key of the type
+	if !validSecret(t, secret) {
+		return nil, ErrInvalidPrivateKey
+	}
+
+	return newWallet(t, secret, compressed), nil
+}
+
+// ImportPrivateKey adds the wallet of an encoded private key
+// A watch-only address of the key gets its private key. It returns the
+// address of the key.
+func (ws *Wallets) ImportPrivateKey(key string) (string, error) {
+	if ws.locked {
+		return "", ErrWalletLocked
+	}
+
+	w, err := DecodePrivateKey(key)
+	if err != nil {
+		return "", err
+	}
+
+	address := string(w.Address())
+	if _, ok := ws.Wallets[address]; ok {
+		return "", fmt.Errorf("%w: %s", ErrAddressExists, address)
+	}
+
+	ws.Wallets[address] = w
+	delete(ws.watchOnly, address)
+
+	return address, nil
+}
+
+// ImportAddress watches an address without its private key
+func (ws *Wallets) ImportAddress(address string) error {
+	if _, err := DecodeAddress(address); err != nil {
+		return err
+	}
+	if _, ok := ws.Wallets[address]; ok || ws.watchOnly[address] {
+		return fmt.Errorf("%w: %s", ErrAddressExists, address)
+	}
+
+	if ws.watchOnly == nil {
+		ws.watchOnly = make(map[string]bool)
+	}
+	ws.watchOnly[address] = true
+
+	return nil
+}
+
+// DumpPrivateKey gets the encoded private key of the address
+func (ws *Wallets) DumpPrivateKey(address string) (string, error) {
+	w, err := ws.GetWallet(address)
+	if err != nil {
+		return "", err
+	}
+
+	return EncodePrivateKey(&w), nil
+}
+
+// IsWatchOnly reports whether the address is watched without a private key
+func (ws *Wallets) IsWatchOnly(address string) bool {
+	return ws.watchOnly[address]
+}
+
+// WatchOnlyAddresses gets the watch-only addresses in order
+func (ws *Wallets) WatchOnlyAddresses() []string {
+	var addresses []string
+
+	for address := range ws.watchOnly {
+		addresses = append(addresses, address)
+	}
+	sort.Strings(addresses)
+
+	return addresses
+}
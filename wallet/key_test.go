@@ -0,0 +1,129 @@
+package wallet
+
+import (
+	"bytes"
+	"digitalWallet/utils"
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+func TestEncodePrivateKeyVectors(t *testing.T) {
+	// P-256 keys are written like Bitcoin WIF keys
+	secret, _ := hex.DecodeString("0c28fca386c7a227600b2fe50b7cae11ec86d3bf1fbe471be89827e19d72aa1d")
+
+	tests := []struct {
+		compressed bool
+		want       string
+	}{
+		{false, "5HueCGU8rMjxEXxiPuD5BDku4MkFqeZyd4dZ1jvhTVqvbTLvyTJ"},
+		{true, "KwdMAjGmerYanjeui5SHS7JkmpZvVipYvB2LJGU1ZxJwYvP98617"},
+	}
+
+	for _, test := range tests {
+		w := newWallet(KeyTypeP256, secret, test.compressed)
+		if got := EncodePrivateKey(w); got != test.want {
+			t.Errorf("compressed %v: encoded %s, want %s", test.compressed, got, test.want)
+		}
+
+		decoded, err := DecodePrivateKey(test.want)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(decoded.PublicKey, w.PublicKey) {
+			t.Errorf("compressed %v: decoded public key %x, want %x", test.compressed, decoded.PublicKey, w.PublicKey)
+		}
+	}
+}
+
+func TestPrivateKeyRoundTrip(t *testing.T) {
+	wallets := makeWallets(t, KeyTypes...)
+	wallets = append(wallets, legacyWallet(makeWallets(t, KeyTypeP256)[0]))
+
+	for _, w := range wallets {
+		key := EncodePrivateKey(w)
+		decoded, err := DecodePrivateKey(key)
+		if err != nil {
+			t.Fatalf("%s key %s: %v", w.Type, key, err)
+		}
+		if decoded.Type != w.Type || !bytes.Equal(decoded.PrivateKey, w.PrivateKey) ||
+			!bytes.Equal(decoded.Address(), w.Address()) {
+			t.Errorf("%s key %s decoded to address %s, want %s", w.Type, key, decoded.Address(), w.Address())
+		}
+	}
+}
+
+func TestDecodePrivateKeyRejects(t *testing.T) {
+	w := makeWallets(t, KeyTypeSecp256k1)[0]
+	decoded, err := utils.Base58Decode([]byte(EncodePrivateKey(w)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// reencode writes versioned data with a valid checksum
+	reencode := func(versioned []byte) string {
+		return string(utils.Base58Encode(append(versioned, Checksum(versioned)...)))
+	}
+	versioned := decoded[:len(decoded)-checksumLength]
+
+	badChecksum := append([]byte{}, decoded...)
+	badChecksum[len(badChecksum)-1] ^= 1
+	typo := []byte(EncodePrivateKey(w))
+	if typo[10] == '2' {
+		typo[10] = '3'
+	} else {
+		typo[10] = '2'
+	}
+
+	tests := []struct {
+		name string
+		key  string
+	}{
+		{"bad checksum", string(utils.Base58Encode(badChecksum))},
+		{"mistyped", string(typo)},
+		{"not Base58", "0OIl"},
+		{"empty", ""},
+		{"bad version", reencode(append([]byte{0x81}, versioned[1:]...))},
+		{"unknown key type", reencode(append(append([]byte{}, versioned[:len(versioned)-1]...), 0x7f))},
+		{"zero key", reencode(append(append([]byte{privateKeyVersion}, make([]byte, privateKeyLength)...), compressedFlag, byte(KeyTypeSecp256k1)))},
+		{"short key", reencode(versioned[:privateKeyLength])},
+	}
+
+	for _, test := range tests {
+		if _, err := DecodePrivateKey(test.key); !errors.Is(err, ErrInvalidPrivateKey) {
+			t.Errorf("%s: got %v, want %v", test.name, err, ErrInvalidPrivateKey)
+		}
+	}
+}
+
+func TestImportPrivateKey(t *testing.T) {
+	ws := &Wallets{Wallets: make(map[string]*Wallet)}
+	w := makeWallets(t, KeyTypeEd25519)[0]
+	address := string(w.Address())
+
+	// Watched addresses get their private key when it is imported
+	if err := ws.ImportAddress(address); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ws.DumpPrivateKey(address); !errors.Is(err, ErrWatchOnly) {
+		t.Errorf("watch-only address gave %v, want %v", err, ErrWatchOnly)
+	}
+	if err := ws.ImportAddress(address); !errors.Is(err, ErrAddressExists) {
+		t.Errorf("watching twice gave %v, want %v", err, ErrAddressExists)
+	}
+
+	imported, err := ws.ImportPrivateKey(EncodePrivateKey(w))
+	if err != nil || imported != address {
+		t.Fatalf("ImportPrivateKey() = %s, %v, want %s", imported, err, address)
+	}
+	if ws.IsWatchOnly(address) {
+		t.Error("imported address is still watch-only")
+	}
+	if _, err := ws.ImportPrivateKey(EncodePrivateKey(w)); !errors.Is(err, ErrAddressExists) {
+		t.Errorf("importing twice gave %v, want %v", err, ErrAddressExists)
+	}
+
+	if key, err := ws.DumpPrivateKey(address); err != nil || key != EncodePrivateKey(w) {
+		t.Errorf("DumpPrivateKey() = %s, %v", key, err)
+	}
+}
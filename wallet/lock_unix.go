@@ -0,0 +1,20 @@
+//go:build !windows
+// +build !windows
+
+package wallet
+
+import (
+	"os"
+	"syscall"
+)
+
+// lockFile takes an exclusive lock on the file without waiting
+// The lock is released when the file is closed, even by a crash
+func lockFile(f *os.File) error {
+	err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if err == syscall.EWOULDBLOCK {
+		return ErrWalletBusy
+	}
+
+	return err
+}
@@ -0,0 +1,114 @@
+package wallet
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"digitalWallet/utils"
+	"encoding/base64"
+	"fmt"
+)
+
+// Defines message signing constants
+//
+// A message signature is the Base64 of EncodingMagic followed by
+//
+//	version     int, messageSignatureVersion
+//	public key  bytes, as in the wallet, see PublicKeyType
+//	signature   bytes, see Signer
+//
+// in the layout of utils.Encoder. The public key is checked against the
+// PublicKeyHash of the address, so the signature alone proves control of it.
+// Version 1 signatures held uncompressed points and are no longer accepted.
+const (
+	messageSignatureVersion = 2
+
+	// messagePrefix separates message digests from transaction digests
+	//
+	// Messages are hashed twice with the prefix while transactions are
+	// hashed once, so no message signature verifies as a transaction one
+	messagePrefix = "digitalWallet Signed Message:\n"
+)
+
+// messageHash gets the digest signed for the message
+func messageHash(message []byte) []byte {
+	var e utils.Encoder
+	e.WriteBytes([]byte(messagePrefix))
+	e.WriteBytes(message)
+
+	first := sha256.Sum256(e.Bytes())
+	second := sha256.Sum256(first[:])
+
+	return second[:]
+}
+
+// SignMessage signs the message with the signer
+func SignMessage(signer Signer, message []byte) (string, error) {
+	signature, err := signer.Sign(messageHash(message))
+	if err != nil {
+		return "", err
+	}
+
+	var e utils.Encoder
+	e.WriteMagic()
+	e.WriteInt(messageSignatureVersion)
+	e.WriteBytes(signer.PublicKey())
+	e.WriteBytes(signature)
+
+	return base64.StdEncoding.EncodeToString(e.Bytes()), nil
+}
+
+// VerifyMessage checks that the signature of the message was made with the
+// key of the address
+func VerifyMessage(address, signature string, message []byte) error {
+	addressType, pubKeyHash, err := decodeAddress(address)
+	if err != nil {
+		return err
+	}
+
+	publicKey, sig, err := decodeMessageSignature(signature)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+
+	// The public key must be the one the address was made from
+	if t, _ := PublicKeyType(publicKey); byte(t) != addressType || IsMultisig(publicKey) || !bytes.Equal(PublicKeyHash(publicKey), pubKeyHash) {
+		return fmt.Errorf("%w: key of another address", ErrInvalidSignature)
+	}
+
+	if !VerifyDigest(publicKey, messageHash(message), sig) {
+		return ErrInvalidSignature
+	}
+
+	return nil
+}
+
+// decodeMessageSignature reads the public key and signature written by
+// SignMessage
+func decodeMessageSignature(signature string) ([]byte, []byte, error) {
+	data, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	d := utils.NewDecoder(data)
+	if err := d.ReadMagic(); err != nil {
+		return nil, nil, err
+	}
+	version, err := d.ReadInt()
+	if err != nil {
+		return nil, nil, err
+	}
+	if version != messageSignatureVersion {
+		return nil, nil, fmt.Errorf("version %d", version)
+	}
+	publicKey, err := d.ReadBytes()
+	if err != nil {
+		return nil, nil, err
+	}
+	sig, err := d.ReadBytes()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return publicKey, sig, d.Finish()
+}
@@ -0,0 +1,101 @@
+package wallet
+
+import (
+	"crypto/sha256"
+	"digitalWallet/utils"
+	"encoding/base64"
+	"errors"
+	"testing"
+)
+
+// encodeMessageSignature writes a message signature of any version
+func encodeMessageSignature(version int64, publicKey, sig []byte) string {
+	var e utils.Encoder
+	e.WriteMagic()
+	e.WriteInt(version)
+	e.WriteBytes(publicKey)
+	e.WriteBytes(sig)
+
+	return base64.StdEncoding.EncodeToString(e.Bytes())
+}
+
+func TestSignMessage(t *testing.T) {
+	message := []byte("pay 10 to the bearer")
+	wallets := makeWallets(t, KeyTypes...)
+	wallets = append(wallets, legacyWallet(makeWallets(t, KeyTypeP256)[0]))
+
+	for _, w := range wallets {
+		address := string(w.Address())
+		signature, err := SignMessage(w.Signer(), message)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := VerifyMessage(address, signature, message); err != nil {
+			t.Errorf("%s: %v", w.Type, err)
+		}
+		if err := VerifyMessage(address, signature, []byte("pay 99 to the bearer")); !errors.Is(err, ErrInvalidSignature) {
+			t.Errorf("%s: tampered message gave %v, want %v", w.Type, err, ErrInvalidSignature)
+		}
+	}
+}
+
+func TestVerifyMessageRejects(t *testing.T) {
+	message := []byte("pay 10 to the bearer")
+	wallets := makeWallets(t, KeyTypeP256, KeyTypeP256)
+	address := string(wallets[0].Address())
+
+	signature, err := SignMessage(wallets[0].Signer(), message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := SignMessage(wallets[1].Signer(), message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKey, sig, err := decodeMessageSignature(signature)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Signatures of the digest of a transaction are not message signatures
+	digest := sha256.Sum256(message)
+	txSig, err := wallets[0].Signer().Sign(digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		signature string
+	}{
+		{"another key", other},
+		{"another key with the right signature", encodeMessageSignature(messageSignatureVersion, wallets[1].PublicKey, sig)},
+		{"transaction signature", encodeMessageSignature(messageSignatureVersion, publicKey, txSig)},
+		{"old version", encodeMessageSignature(1, publicKey, sig)},
+		{"trailing bytes", base64.StdEncoding.EncodeToString(append(mustDecodeBase64(t, signature), 0))},
+		{"not Base64", "!" + signature},
+		{"empty", ""},
+	}
+
+	for _, test := range tests {
+		if err := VerifyMessage(address, test.signature, message); !errors.Is(err, ErrInvalidSignature) {
+			t.Errorf("%s: got %v, want %v", test.name, err, ErrInvalidSignature)
+		}
+	}
+
+	if err := VerifyMessage("not an address", signature, message); err == nil {
+		t.Error("invalid address verified")
+	}
+}
+
+func mustDecodeBase64(t *testing.T, s string) []byte {
+	t.Helper()
+
+	data, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return data
+}
@@ -0,0 +1,259 @@
+package wallet
+
+import (
+	"bytes"
+	"digitalWallet/utils"
+	"fmt"
+)
+
+// Multisig locks outputs to M signatures of N public keys
+//
+// Outputs are locked to the PublicKeyHash of the script of the multisig,
+// which is publicKeyTag plus MultisigVersion followed by
+//
+//	M            int
+//	public keys  count, then bytes for each key
+//
+// in the layout of utils.Encoder. Inputs spending them carry the script as
+// their public key and a signature set as their signature, so a multisig is
+// a Verifier of the script, see ParseVerifier.
+//
+// A signature set is a count followed by bytes for each public key, the
+// signature of the key or empty bytes when it did not sign. Exactly M keys
+// must sign, so that signatures cannot be added to a transaction once it is
+// valid.
+type Multisig struct {
+	M          int
+	PublicKeys [][]byte
+}
+
+// Defines multisig constants
+const (
+	// MultisigVersion is the version byte of multisig addresses
+	MultisigVersion = byte(0x05)
+
+	// MaxMultisigKeys is the largest number of keys of a multisig
+	MaxMultisigKeys = 16
+)
+
+// NewMultisig creates the multisig of m signatures of the public keys
+// The keys must be distinct keys of any type, in the order given.
+func NewMultisig(m int, publicKeys [][]byte) (*Multisig, error) {
+	if len(publicKeys) == 0 || len(publicKeys) > MaxMultisigKeys {
+		return nil, fmt.Errorf("%w: %d keys", ErrInvalidMultisig, len(publicKeys))
+	}
+	if m < 1 || m > len(publicKeys) {
+		return nil, fmt.Errorf("%w: %d of %d keys", ErrInvalidMultisig, m, len(publicKeys))
+	}
+
+	canonical := make([][]byte, len(publicKeys))
+	for i, publicKey := range publicKeys {
+		if IsMultisig(publicKey) {
+			return nil, fmt.Errorf("%w: key %d is a multisig", ErrInvalidMultisig, i+1)
+		}
+		if _, err := ParseVerifier(publicKey); err != nil {
+			return nil, fmt.Errorf("%w: key %d: %v", ErrInvalidMultisig, i+1, err)
+		}
+		canonical[i] = canonicalPublicKey(publicKey)
+		for _, other := range canonical[:i] {
+			if bytes.Equal(canonical[i], other) {
+				return nil, fmt.Errorf("%w: key %d is repeated", ErrInvalidMultisig, i+1)
+			}
+		}
+	}
+
+	return &Multisig{m, publicKeys}, nil
+}
+
+// canonicalPublicKey gets the compressed form of a valid P-256 key, so both
+// layouts of the same key compare equal, other keys are already canonical
+func canonicalPublicKey(publicKey []byte) []byte {
+	if t, _ := PublicKeyType(publicKey); t != KeyTypeP256 {
+		return publicKey
+	}
+
+	key, err := ParsePublicKey(publicKey)
+	if err != nil {
+		return publicKey
+	}
+
+	return marshalPublicKey(key)
+}
+
+// IsMultisig reports whether a public key is the script of a multisig
+// P-256 keys in the layout used before compression may start with the same
+// byte as scripts, but never decode as one.
+func IsMultisig(publicKey []byte) bool {
+	_, err := ParseMultisig(publicKey)
+
+	return err == nil
+}
+
+// ParseMultisig reads the script of a multisig
+func ParseMultisig(script []byte) (*Multisig, error) {
+	if len(script) == 0 || script[0] != publicKeyTag+MultisigVersion {
+		return nil, ErrInvalidMultisig
+	}
+
+	d := utils.NewDecoder(script[1:])
+	m, err := d.ReadInt()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidMultisig, err)
+	}
+	count, err := d.ReadLength()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidMultisig, err)
+	}
+	if count > MaxMultisigKeys || m < 1 || m > int64(count) {
+		return nil, fmt.Errorf("%w: %d of %d keys", ErrInvalidMultisig, m, count)
+	}
+
+	var publicKeys [][]byte
+	for i := 0; i < count; i++ {
+		publicKey, err := d.ReadBytes()
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidMultisig, err)
+		}
+		publicKeys = append(publicKeys, publicKey)
+	}
+	if err := d.Finish(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidMultisig, err)
+	}
+
+	return NewMultisig(int(m), publicKeys)
+}
+
+// Script gets the script of the multisig
+func (ms *Multisig) Script() []byte {
+	var e utils.Encoder
+	e.WriteInt(int64(ms.M))
+	e.WriteUint(uint64(len(ms.PublicKeys)))
+	for _, publicKey := range ms.PublicKeys {
+		e.WriteBytes(publicKey)
+	}
+
+	return append([]byte{publicKeyTag + MultisigVersion}, e.Bytes()...)
+}
+
+// Address creates the multisig address
+func (ms *Multisig) Address() []byte {
+	versionedHash := append([]byte{MultisigVersion}, PublicKeyHash(ms.Script())...)
+
+	return utils.Base58Encode(append(versionedHash, Checksum(versionedHash)...))
+}
+
+// decodeSignatures reads a signature set, empty bytes hold no signatures
+func (ms *Multisig) decodeSignatures(signatures []byte) ([][]byte, error) {
+	if len(signatures) == 0 {
+		return make([][]byte, len(ms.PublicKeys)), nil
+	}
+
+	d := utils.NewDecoder(signatures)
+	count, err := d.ReadLength()
+	if err != nil {
+		return nil, err
+	}
+	if count != len(ms.PublicKeys) {
+		return nil, fmt.Errorf("%w: %d signatures for %d keys", ErrInvalidSignature, count, len(ms.PublicKeys))
+	}
+
+	sigs := make([][]byte, count)
+	for i := range sigs {
+		if sigs[i], err = d.ReadBytes(); err != nil {
+			return nil, err
+		}
+		if len(sigs[i]) == 0 {
+			sigs[i] = nil
+		}
+	}
+
+	return sigs, d.Finish()
+}
+
+// encodeSignatures writes a signature set
+func encodeSignatures(sigs [][]byte) []byte {
+	var e utils.Encoder
+	e.WriteUint(uint64(len(sigs)))
+	for _, sig := range sigs {
+		e.WriteBytes(sig)
+	}
+
+	return e.Bytes()
+}
+
+// Signed counts the keys that signed in a signature set
+func (ms *Multisig) Signed(signatures []byte) int {
+	sigs, err := ms.decodeSignatures(signatures)
+	if err != nil {
+		return 0
+	}
+
+	signed := 0
+	for _, sig := range sigs {
+		if sig != nil {
+			signed++
+		}
+	}
+
+	return signed
+}
+
+// KeyIndex gets the position of a public key in the multisig, or -1 when it
+// is not listed
+// Both layouts of a P-256 key are the same key.
+func (ms *Multisig) KeyIndex(publicKey []byte) int {
+	canonical := canonicalPublicKey(publicKey)
+	for i, key := range ms.PublicKeys {
+		if bytes.Equal(canonicalPublicKey(key), canonical) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// AddSignature adds the signature of the digest by the signer to a signature
+// set
+// The signer must hold one of the keys. Sets that already have M signatures
+// are returned unchanged.
+func (ms *Multisig) AddSignature(signatures []byte, signer Signer, digest []byte) ([]byte, error) {
+	sigs, err := ms.decodeSignatures(signatures)
+	if err != nil {
+		return nil, err
+	}
+
+	index := ms.KeyIndex(signer.PublicKey())
+	if index < 0 {
+		return nil, ErrNotMultisigKey
+	}
+	if ms.Signed(signatures) >= ms.M {
+		return signatures, nil
+	}
+
+	if sigs[index], err = signer.Sign(digest); err != nil {
+		return nil, err
+	}
+
+	return encodeSignatures(sigs), nil
+}
+
+// Verify checks that exactly M keys signed the digest in a signature set
+func (ms *Multisig) Verify(digest, signatures []byte) bool {
+	sigs, err := ms.decodeSignatures(signatures)
+	if err != nil || len(signatures) == 0 {
+		return false
+	}
+
+	signed := 0
+	for i, sig := range sigs {
+		if sig == nil {
+			continue
+		}
+		if !VerifyDigest(ms.PublicKeys[i], digest, sig) {
+			return false
+		}
+		signed++
+	}
+
+	return signed == ms.M
+}
@@ -0,0 +1,163 @@
+package wallet
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// makeWallets creates a wallet of each type given
+func makeWallets(t *testing.T, types ...KeyType) []*Wallet {
+	t.Helper()
+
+	var wallets []*Wallet
+	for _, keyType := range types {
+		w, err := MakeWallet(keyType)
+		if err != nil {
+			t.Fatal(err)
+		}
+		wallets = append(wallets, w)
+	}
+
+	return wallets
+}
+
+// legacyWallet gets the wallet of the same P-256 key with the public key in
+// the layout used before compression
+func legacyWallet(w *Wallet) *Wallet {
+	return newWallet(KeyTypeP256, w.PrivateKey, false)
+}
+
+func TestNewMultisigRejects(t *testing.T) {
+	wallets := makeWallets(t, KeyTypeP256, KeyTypeSecp256k1, KeyTypeEd25519)
+	keys := [][]byte{wallets[0].PublicKey, wallets[1].PublicKey, wallets[2].PublicKey}
+	nested, err := NewMultisig(1, keys[:2])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tooMany := make([][]byte, MaxMultisigKeys+1)
+	for i := range tooMany {
+		tooMany[i] = makeWallets(t, KeyTypeEd25519)[0].PublicKey
+	}
+
+	tests := []struct {
+		name string
+		m    int
+		keys [][]byte
+	}{
+		{"no keys", 1, nil},
+		{"too many keys", 1, tooMany},
+		{"no signatures", 0, keys},
+		{"more signatures than keys", 4, keys},
+		{"repeated key", 2, [][]byte{keys[0], keys[1], keys[0]}},
+		{"repeated key in another layout", 2, [][]byte{keys[0], legacyWallet(wallets[0]).PublicKey}},
+		{"nested multisig", 1, [][]byte{keys[2], nested.Script()}},
+		{"invalid key", 1, [][]byte{keys[0], make([]byte, CompressedKeyLength)}},
+	}
+
+	for _, test := range tests {
+		if _, err := NewMultisig(test.m, test.keys); !errors.Is(err, ErrInvalidMultisig) {
+			t.Errorf("%s: got %v, want %v", test.name, err, ErrInvalidMultisig)
+		}
+
+		// Scripts built without NewMultisig are refused when read
+		script := (&Multisig{test.m, test.keys}).Script()
+		if _, err := ParseMultisig(script); !errors.Is(err, ErrInvalidMultisig) {
+			t.Errorf("%s: parsing the script gave %v, want %v", test.name, err, ErrInvalidMultisig)
+		}
+		if IsMultisig(script) {
+			t.Errorf("%s: script is taken for a multisig", test.name)
+		}
+	}
+}
+
+func TestMultisigScript(t *testing.T) {
+	wallets := makeWallets(t, KeyTypeP256, KeyTypeSecp256k1, KeyTypeEd25519)
+	ms, err := NewMultisig(2, [][]byte{legacyWallet(wallets[0]).PublicKey, wallets[1].PublicKey, wallets[2].PublicKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := ParseMultisig(ms.Script())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.M != ms.M || !bytes.Equal(parsed.Script(), ms.Script()) {
+		t.Errorf("round trip gave %d of %x, want %d of %x", parsed.M, parsed.Script(), ms.M, ms.Script())
+	}
+	if _, err := ParseVerifier(ms.Script()); err != nil {
+		t.Errorf("script is not a verifier: %v", err)
+	}
+
+	address := string(ms.Address())
+	if !IsMultisigAddress(address) {
+		t.Errorf("%s is not a multisig address", address)
+	}
+	pubKeyHash, err := DecodeAddress(address)
+	if err != nil || !bytes.Equal(pubKeyHash, PublicKeyHash(ms.Script())) {
+		t.Errorf("address decodes to %x, %v", pubKeyHash, err)
+	}
+	if _, err := AddressKeyType(address); !errors.Is(err, ErrInvalidAddress) {
+		t.Errorf("multisig address has a key type: %v", err)
+	}
+
+	for _, script := range [][]byte{nil, ms.Script()[:len(ms.Script())-1], append(ms.Script(), 0)} {
+		if _, err := ParseMultisig(script); !errors.Is(err, ErrInvalidMultisig) {
+			t.Errorf("script %x gave %v, want %v", script, err, ErrInvalidMultisig)
+		}
+	}
+}
+
+func TestMultisigSignatures(t *testing.T) {
+	wallets := makeWallets(t, KeyTypeP256, KeyTypeP256, KeyTypeSecp256k1)
+	outsider := makeWallets(t, KeyTypeP256)[0]
+
+	// The first key is listed in the layout used before compression
+	ms, err := NewMultisig(2, [][]byte{legacyWallet(wallets[0]).PublicKey, wallets[1].PublicKey, wallets[2].PublicKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := randomDigest(t)
+
+	// Keys match in either layout
+	for i, w := range wallets[:2] {
+		for _, signer := range []*Wallet{w, legacyWallet(w)} {
+			if got := ms.KeyIndex(signer.PublicKey); got != i {
+				t.Errorf("key %x is at %d, want %d", signer.PublicKey, got, i)
+			}
+		}
+	}
+	if got := ms.KeyIndex(outsider.PublicKey); got != -1 {
+		t.Errorf("outsider key is at %d", got)
+	}
+
+	if _, err := ms.AddSignature(nil, outsider.Signer(), digest); !errors.Is(err, ErrNotMultisigKey) {
+		t.Errorf("outsider signature gave %v, want %v", err, ErrNotMultisigKey)
+	}
+
+	sigs, err := ms.AddSignature(nil, wallets[0].Signer(), digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ms.Signed(sigs) != 1 || ms.Verify(digest, sigs) {
+		t.Fatalf("one of two signatures: %d signed, verifies %v", ms.Signed(sigs), ms.Verify(digest, sigs))
+	}
+
+	sigs, err = ms.AddSignature(sigs, legacyWallet(wallets[1]).Signer(), digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ms.Signed(sigs) != 2 || !ms.Verify(digest, sigs) {
+		t.Fatalf("two of two signatures: %d signed, verifies %v", ms.Signed(sigs), ms.Verify(digest, sigs))
+	}
+	if ms.Verify(randomDigest(t), sigs) {
+		t.Error("signatures verify another digest")
+	}
+
+	// Complete sets are left as they are
+	again, err := ms.AddSignature(sigs, wallets[2].Signer(), digest)
+	if err != nil || !bytes.Equal(again, sigs) {
+		t.Errorf("complete set changed to %x, %v", again, err)
+	}
+}
@@ -0,0 +1,120 @@
+package wallet
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"io"
+	"math/big"
+)
+
+// signRFC6979 signs the digest with the nonce of RFC 6979
+// It is what signDeterministic does on toolchains whose crypto/ecdsa does not
+// sign deterministically. The nonce and the private key are blinded with a
+// factor read from random while s is computed, which leaves the signature
+// unchanged.
+func signRFC6979(key *ecdsa.PrivateKey, digest []byte, random io.Reader) (*big.Int, *big.Int, error) {
+	curve := key.Curve
+	n := curve.Params().N
+	e := hashToInt(digest, n)
+
+	nonce := newNonceGenerator(key.D, digest, n)
+	for {
+		k := nonce()
+
+		x, _ := curve.ScalarBaseMult(k.FillBytes(make([]byte, scalarLength)))
+		r := new(big.Int).Mod(x, n)
+		if r.Sign() == 0 {
+			continue
+		}
+
+		b, err := rand.Int(random, n)
+		if err != nil {
+			return nil, nil, err
+		}
+		if b.Sign() == 0 {
+			continue
+		}
+
+		// s = b(e + r * d) / bk
+		s := new(big.Int).Mul(r, key.D)
+		s.Add(s, e)
+		s.Mul(s, b)
+		s.Mod(s, n)
+		bk := new(big.Int).Mul(b, k)
+		bk.Mod(bk, n)
+		s.Mul(s, bk.ModInverse(bk, n))
+		s.Mod(s, n)
+		if s.Sign() == 0 {
+			continue
+		}
+
+		return r, s, nil
+	}
+}
+
+// hashToInt converts the leftmost bits of the digest to an integer as
+// ecdsa.Verify does
+func hashToInt(digest []byte, n *big.Int) *big.Int {
+	orderBits := n.BitLen()
+	orderBytes := (orderBits + 7) / 8
+	if len(digest) > orderBytes {
+		digest = digest[:orderBytes]
+	}
+
+	e := new(big.Int).SetBytes(digest)
+	if excess := len(digest)*8 - orderBits; excess > 0 {
+		e.Rsh(e, uint(excess))
+	}
+
+	return e
+}
+
+// newNonceGenerator returns the nonces of RFC 6979 for the private key d and
+// the digest, with HMAC-SHA256
+// Each call returns the next candidate, for when one gives r or s of zero.
+func newNonceGenerator(d *big.Int, digest []byte, n *big.Int) func() *big.Int {
+	mac := func(key []byte, data ...[]byte) []byte {
+		h := hmac.New(sha256.New, key)
+		for _, b := range data {
+			h.Write(b)
+		}
+		return h.Sum(nil)
+	}
+
+	x := d.FillBytes(make([]byte, scalarLength))
+	h := new(big.Int).Mod(hashToInt(digest, n), n).FillBytes(make([]byte, scalarLength))
+
+	V := bytes.Repeat([]byte{0x01}, sha256.Size)
+	K := make([]byte, sha256.Size)
+	K = mac(K, V, []byte{0x00}, x, h)
+	V = mac(K, V)
+	K = mac(K, V, []byte{0x01}, x, h)
+	V = mac(K, V)
+
+	first := true
+	return func() *big.Int {
+		if !first {
+			K = mac(K, V, []byte{0x00})
+			V = mac(K, V)
+		}
+		first = false
+
+		for {
+			var T []byte
+			for len(T) < scalarLength {
+				V = mac(K, V)
+				T = append(T, V...)
+			}
+
+			k := hashToInt(T, n)
+			if k.Sign() > 0 && k.Cmp(n) < 0 {
+				return k
+			}
+			K = mac(K, V, []byte{0x00})
+			V = mac(K, V)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package wallet
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"testing"
+)
+
+// TestSignRFC6979 checks the nonces and signatures of RFC 6979 A.2.5 for P-256
+// and SHA-256
+func TestSignRFC6979(t *testing.T) {
+	key := p256PrivateKey(mustDecodeHex(t, "C9AFA9D845BA75166B5C215767B1D6934E50C3DB36E89B127B8A622B120F6721"))
+	n := elliptic.P256().Params().N
+
+	tests := []struct {
+		message string
+		k, r, s string
+	}{
+		{
+			"sample",
+			"A6E3C57DD01ABE90086538398355DD4C3B17AA873382B0F24D6129493D8AAD60",
+			"EFD48B2AACB6A8FD1140DD9CD45E81D69D2C877B56AAF991C34D0EA84EAF3716",
+			"F7CB1C942D657C41D436C7A1B6E29F65F3E900DBB9AFF4064DC4AB2F843ACDA8",
+		},
+		{
+			"test",
+			"D16B6AE827F17175E040871A1C7EC3500192C4C92677336EC2537ACAEE0008E0",
+			"F1ABB023518351CD71D881567B1EA663ED3EFCF6C5132B354F28D3B0B7D38367",
+			"019F4113742A2B14BD25926B49C649155F267E60D3814B4C0CC84250E46F0083",
+		},
+	}
+
+	for _, test := range tests {
+		digest := sha256.Sum256([]byte(test.message))
+
+		k := newNonceGenerator(key.D, digest[:], n)()
+		if got := k.FillBytes(make([]byte, scalarLength)); !bytes.Equal(got, mustDecodeHex(t, test.k)) {
+			t.Errorf("%q: nonce %x, want %s", test.message, got, test.k)
+		}
+
+		// The blinding factor leaves the signature unchanged
+		for i := 0; i < 3; i++ {
+			r, s, err := signRFC6979(key, digest[:], rand.Reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := r.FillBytes(make([]byte, scalarLength)); !bytes.Equal(got, mustDecodeHex(t, test.r)) {
+				t.Errorf("%q: r %x, want %s", test.message, got, test.r)
+			}
+			if got := s.FillBytes(make([]byte, scalarLength)); !bytes.Equal(got, mustDecodeHex(t, test.s)) {
+				t.Errorf("%q: s %x, want %s", test.message, got, test.s)
+			}
+		}
+	}
+}
+
+func TestSignRFC6979RandomKeys(t *testing.T) {
+	for i := 0; i < randomKeys; i++ {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		digest := randomDigest(t)
+
+		r, s, err := signRFC6979(key, digest, rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ecdsa.Verify(&key.PublicKey, digest, r, s) {
+			t.Fatalf("signature %x, %x does not verify with crypto/ecdsa", r, s)
+		}
+
+		// Both signers pick the same nonce
+		wantR, wantS, err := signDeterministic(key, digest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.Cmp(wantR) != 0 || s.Cmp(wantS) != 0 {
+			t.Fatalf("signature %x, %x, want %x, %x", r, s, wantR, wantS)
+		}
+	}
+}
+
+func TestSignRFC6979NoRandomness(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := signRFC6979(key, randomDigest(t), bytes.NewReader(nil)); err == nil {
+		t.Error("signing without a blinding factor succeeded")
+	}
+}
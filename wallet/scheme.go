@@ -0,0 +1,204 @@
+package wallet
+
+import (
+	"crypto/elliptic"
+	"fmt"
+	"math/big"
+)
+
+// KeyType identifies the signature scheme of a key
+//
+// It is the version byte of the addresses of the key. Public keys of types
+// other than KeyTypeP256 start with publicKeyTag plus their type, P-256 keys
+// keep the layouts they had before there were other types.
+type KeyType byte
+
+// Defines key types
+const (
+	// KeyTypeP256 is ECDSA on the NIST P-256 curve
+	KeyTypeP256 KeyType = 0
+
+	// KeyTypeSecp256k1 is ECDSA on the secp256k1 curve
+	KeyTypeSecp256k1 KeyType = 1
+
+	// KeyTypeEd25519 is Ed25519
+	KeyTypeEd25519 KeyType = 2
+
+	// DefaultKeyType is the type of new keys when none is given
+	DefaultKeyType = KeyTypeP256
+
+	// publicKeyTag is added to the type in the first byte of tagged public
+	// keys, it is never the first byte of a compressed point
+	publicKeyTag = byte(0xf0)
+)
+
+// Signer signs digests with a private key
+type Signer interface {
+	// Type gets the type of the key
+	Type() KeyType
+
+	// PublicKey gets the public key as stored in transactions
+	PublicKey() []byte
+
+	// Sign signs the digest
+	Sign(digest []byte) ([]byte, error)
+}
+
+// Verifier checks signatures made with a private key
+type Verifier interface {
+	// Verify reports whether the signature of the digest is valid
+	// Only canonical signatures are valid
+	Verify(digest, signature []byte) bool
+}
+
+// scheme holds what a key type needs to create, derive and use keys
+type scheme struct {
+	name string
+
+	// seedKey is the HMAC key of master keys, see NewMasterKey
+	seedKey string
+
+	// order is the order of the group keys are scalars of, nil when any
+	// private key is valid and children are only hardened
+	order *big.Int
+
+	// keyLength is the length of untagged public keys
+	keyLength int
+
+	// publicKey gets the untagged compressed public key of a private key
+	publicKey func(secret []byte) []byte
+
+	// sign signs the digest with a private key
+	sign func(secret, digest []byte) ([]byte, error)
+
+	// parseVerifier reads an untagged public key
+	parseVerifier func(publicKey []byte) (Verifier, error)
+}
+
+// schemes holds the scheme of each key type
+var schemes = map[KeyType]*scheme{
+	KeyTypeP256: {
+		name:          "p256",
+		seedKey:       "Nist256p1 seed",
+		order:         elliptic.P256().Params().N,
+		keyLength:     CompressedKeyLength,
+		publicKey:     p256PublicKey,
+		sign:          p256Sign,
+		parseVerifier: parseP256Verifier,
+	},
+	KeyTypeSecp256k1: {
+		name:          "secp256k1",
+		seedKey:       "Bitcoin seed",
+		order:         secp256k1Order,
+		keyLength:     CompressedKeyLength,
+		publicKey:     secp256k1PublicKey,
+		sign:          secp256k1Sign,
+		parseVerifier: parseSecp256k1Verifier,
+	},
+	KeyTypeEd25519: {
+		name:          "ed25519",
+		seedKey:       "ed25519 seed",
+		keyLength:     ed25519PublicKeyLength,
+		publicKey:     ed25519PublicKey,
+		sign:          ed25519Sign,
+		parseVerifier: parseEd25519Verifier,
+	},
+}
+
+// KeyTypes lists the key types in order
+var KeyTypes = []KeyType{KeyTypeP256, KeyTypeSecp256k1, KeyTypeEd25519}
+
+// ParseKeyType gets the key type of its name
+func ParseKeyType(name string) (KeyType, error) {
+	for _, t := range KeyTypes {
+		if schemes[t].name == name {
+			return t, nil
+		}
+	}
+
+	return 0, fmt.Errorf("%w: %q", ErrUnknownKeyType, name)
+}
+
+// String gets the name of the key type
+func (t KeyType) String() string {
+	s, ok := schemes[t]
+	if !ok {
+		return fmt.Sprintf("KeyType(%d)", byte(t))
+	}
+
+	return s.name
+}
+
+// IsValid reports whether the key type is known
+func (t KeyType) IsValid() bool {
+	_, ok := schemes[t]
+
+	return ok
+}
+
+// validSecret reports whether secret is a private key of the type
+func validSecret(t KeyType, secret []byte) bool {
+	s := schemes[t]
+	if len(secret) != privateKeyLength {
+		return false
+	}
+	if s.order == nil {
+		return true
+	}
+
+	scalar := new(big.Int).SetBytes(secret)
+	return scalar.Sign() != 0 && scalar.Cmp(s.order) < 0
+}
+
+// tagPublicKey adds the tag of the type to an untagged public key
+func tagPublicKey(t KeyType, publicKey []byte) []byte {
+	if t == KeyTypeP256 {
+		return publicKey
+	}
+
+	return append([]byte{publicKeyTag + byte(t)}, publicKey...)
+}
+
+// PublicKeyType gets the type of a public key and the key without its tag
+// Public keys that are not tagged are P-256 keys.
+func PublicKeyType(publicKey []byte) (KeyType, []byte) {
+	if len(publicKey) > 0 && publicKey[0] > publicKeyTag {
+		t := KeyType(publicKey[0] - publicKeyTag)
+		if s, ok := schemes[t]; ok && len(publicKey) == 1+s.keyLength {
+			return t, publicKey[1:]
+		}
+	}
+
+	return KeyTypeP256, publicKey
+}
+
+// ParseVerifier reads a public key of any type or the script of a multisig
+func ParseVerifier(publicKey []byte) (Verifier, error) {
+	if ms, err := ParseMultisig(publicKey); err == nil {
+		return ms, nil
+	}
+
+	t, key := PublicKeyType(publicKey)
+
+	return schemes[t].parseVerifier(key)
+}
+
+// keySigner signs with the private key of a wallet
+type keySigner struct {
+	wallet Wallet
+}
+
+// Type gets the type of the key
+func (s keySigner) Type() KeyType {
+	return s.wallet.Type
+}
+
+// PublicKey gets the public key of the wallet
+func (s keySigner) PublicKey() []byte {
+	return s.wallet.PublicKey
+}
+
+// Sign signs the digest with the private key of the wallet
+func (s keySigner) Sign(digest []byte) ([]byte, error) {
+	return schemes[s.wallet.Type].sign(s.wallet.PrivateKey, digest)
+}
@@ -0,0 +1,121 @@
+package wallet
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"testing"
+)
+
+func TestKeyTypes(t *testing.T) {
+	for _, keyType := range KeyTypes {
+		w := makeWallets(t, keyType)[0]
+
+		if parsed, err := ParseKeyType(keyType.String()); err != nil || parsed != keyType {
+			t.Errorf("%s: ParseKeyType() = %v, %v", keyType, parsed, err)
+		}
+		if got, key := PublicKeyType(w.PublicKey); got != keyType || len(key) != schemes[keyType].keyLength {
+			t.Errorf("%s: public key %x has type %s and %d bytes", keyType, w.PublicKey, got, len(key))
+		}
+
+		// The address decodes to the type and hash of the key
+		address := string(w.Address())
+		if got, err := AddressKeyType(address); err != nil || got != keyType {
+			t.Errorf("%s: address %s has type %v, %v", keyType, address, got, err)
+		}
+		if pubKeyHash, err := DecodeAddress(address); err != nil || !bytes.Equal(pubKeyHash, PublicKeyHash(w.PublicKey)) {
+			t.Errorf("%s: address %s decodes to %x, %v", keyType, address, pubKeyHash, err)
+		}
+		if !ValidateAddress(address) || IsMultisigAddress(address) {
+			t.Errorf("%s: address %s is not a valid key address", keyType, address)
+		}
+
+		digest := randomDigest(t)
+		sig, err := w.Signer().Sign(digest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !VerifyDigest(w.PublicKey, digest, sig) {
+			t.Errorf("%s: signature does not verify", keyType)
+		}
+		if VerifyDigest(w.PublicKey, randomDigest(t), sig) {
+			t.Errorf("%s: signature verifies another digest", keyType)
+		}
+		tampered := append([]byte{}, sig...)
+		tampered[len(tampered)-1] ^= 1
+		if VerifyDigest(w.PublicKey, digest, tampered) {
+			t.Errorf("%s: tampered signature verifies", keyType)
+		}
+
+		// Keys of the other types do not verify the signature
+		for _, other := range KeyTypes {
+			if other != keyType && VerifyDigest(makeWallets(t, other)[0].PublicKey, digest, sig) {
+				t.Errorf("%s: signature verifies with a %s key", keyType, other)
+			}
+		}
+	}
+
+	if _, err := ParseKeyType("rsa"); !errors.Is(err, ErrUnknownKeyType) {
+		t.Errorf("unknown name gave %v, want %v", err, ErrUnknownKeyType)
+	}
+	if _, err := MakeWallet(KeyType(9)); !errors.Is(err, ErrUnknownKeyType) {
+		t.Errorf("unknown type gave %v, want %v", err, ErrUnknownKeyType)
+	}
+}
+
+func TestEd25519Vector(t *testing.T) {
+	// RFC 8032 7.1 test 1, over an empty message
+	w := newWallet(KeyTypeEd25519, mustDecodeHex(t, "9d61b19deffd5a60ba844af492ec2cc44449c5697b326919703bac031cae7f60"), true)
+	publicKey := "d75a980182b10ab7d54bfed3c964073a0ee172f3daa62325af021a68f707511a"
+	signature := "e5564300c360ac729086e2cc806e828a84877f1eb8e5d974d873e065224901555fb8821590a33bacc61e39701cf9b46bd25bf5f0595bbe24655141438e7a100b"
+
+	if got := hex.EncodeToString(w.PublicKey); got != "f2"+publicKey {
+		t.Errorf("public key %s, want the tagged %s", got, publicKey)
+	}
+	sig, err := w.Signer().Sign(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hex.EncodeToString(sig); got != signature {
+		t.Errorf("signature %s, want %s", got, signature)
+	}
+	if !VerifyDigest(w.PublicKey, nil, sig) {
+		t.Error("signature does not verify")
+	}
+}
+
+func TestSecp256k1Signatures(t *testing.T) {
+	// The public key of 1 is the generator
+	one := make([]byte, privateKeyLength)
+	one[len(one)-1] = 1
+	generator := newWallet(KeyTypeSecp256k1, one, true)
+	if got := hex.EncodeToString(generator.PublicKey); got != "f10279be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798" {
+		t.Errorf("public key of 1 is %s", got)
+	}
+
+	w := makeWallets(t, KeyTypeSecp256k1)[0]
+	digest := randomDigest(t)
+	sig, err := w.Signer().Sign(digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := w.Signer().Sign(digest)
+	if err != nil || !bytes.Equal(again, sig) {
+		t.Errorf("signatures are not deterministic: %x, %x", sig, again)
+	}
+	if len(sig) != SignatureLength {
+		t.Fatalf("signature of %d bytes, want %d", len(sig), SignatureLength)
+	}
+
+	// The same signature with a high s is refused
+	s := new(big.Int).SetBytes(sig[scalarLength:])
+	s.Sub(secp256k1Order, s)
+	highS := append(append([]byte{}, sig[:scalarLength]...), s.FillBytes(make([]byte, scalarLength))...)
+	if VerifyDigest(w.PublicKey, digest, highS) {
+		t.Error("signature with a high s verifies")
+	}
+	if VerifyDigest(w.PublicKey, digest, sig[1:]) {
+		t.Error("short signature verifies")
+	}
+}
@@ -0,0 +1,61 @@
+package wallet
+
+import (
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+)
+
+// secp256k1 signatures have the layout of P-256 ones, r followed by s with
+// a low s, and public keys are compressed points.
+
+// secp256k1Order is the order of the secp256k1 curve
+var secp256k1Order = secp256k1.Params().N
+
+// secp256k1PublicKey gets the compressed public key of a secp256k1 scalar
+func secp256k1PublicKey(secret []byte) []byte {
+	return secp256k1.PrivKeyFromBytes(secret).PubKey().SerializeCompressed()
+}
+
+// secp256k1Sign signs the digest with a secp256k1 scalar
+// The nonce is deterministic and s is low as in SignDigest.
+func secp256k1Sign(secret, digest []byte) ([]byte, error) {
+	// The compact layout is a recovery byte followed by r and s
+	return ecdsa.SignCompact(secp256k1.PrivKeyFromBytes(secret), digest, true)[1:], nil
+}
+
+// secp256k1Verifier checks secp256k1 signatures
+type secp256k1Verifier struct {
+	key *secp256k1.PublicKey
+}
+
+// parseSecp256k1Verifier reads a compressed secp256k1 public key
+func parseSecp256k1Verifier(publicKey []byte) (Verifier, error) {
+	if len(publicKey) != CompressedKeyLength {
+		return nil, ErrInvalidPublicKey
+	}
+
+	key, err := secp256k1.ParsePubKey(publicKey)
+	if err != nil {
+		return nil, ErrInvalidPublicKey
+	}
+
+	return secp256k1Verifier{key}, nil
+}
+
+// Verify checks a signature of the digest
+// It refuses other lengths, values out of range and high s
+func (v secp256k1Verifier) Verify(digest, signature []byte) bool {
+	if len(signature) != SignatureLength {
+		return false
+	}
+
+	var r, s secp256k1.ModNScalar
+	if r.SetByteSlice(signature[:scalarLength]) || r.IsZero() {
+		return false
+	}
+	if s.SetByteSlice(signature[scalarLength:]) || s.IsZero() || s.IsOverHalfOrder() {
+		return false
+	}
+
+	return ecdsa.NewSignature(&r, &s).Verify(digest, v.key)
+}
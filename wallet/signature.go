@@ -0,0 +1,198 @@
+package wallet
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"math/big"
+)
+
+// Defines P-256 signature and public key encoding constants
+//
+// A signature is r followed by s, each as 32 big endian bytes, with s at
+// most half the curve order. A public key is the compressed point of
+// elliptic.MarshalCompressed. Keys created before compression are the bytes
+// of X followed by the bytes of Y without leading zeros, see
+// ParsePublicKey.
+const (
+	// scalarLength is the length of r, s and private keys
+	scalarLength = 32
+
+	// SignatureLength is the length of a signature
+	SignatureLength = 2 * scalarLength
+
+	// CompressedKeyLength is the length of a compressed public key
+	CompressedKeyLength = 1 + scalarLength
+)
+
+// marshalPublicKey gets the compressed public key
+func marshalPublicKey(key *ecdsa.PublicKey) []byte {
+	return elliptic.MarshalCompressed(key.Curve, key.X, key.Y)
+}
+
+// p256PrivateKey gets the P-256 private key of a scalar
+func p256PrivateKey(secret []byte) *ecdsa.PrivateKey {
+	var key ecdsa.PrivateKey
+
+	curve := elliptic.P256()
+	key.Curve = curve
+	key.D = new(big.Int).SetBytes(secret)
+	key.PublicKey.X, key.PublicKey.Y = curve.ScalarBaseMult(secret)
+
+	return &key
+}
+
+// p256PublicKey gets the compressed public key of a P-256 scalar
+func p256PublicKey(secret []byte) []byte {
+	return marshalPublicKey(&p256PrivateKey(secret).PublicKey)
+}
+
+// p256Sign signs the digest with a P-256 scalar, see SignDigest
+func p256Sign(secret, digest []byte) ([]byte, error) {
+	return SignDigest(p256PrivateKey(secret), digest)
+}
+
+// p256Verifier checks P-256 signatures
+type p256Verifier struct {
+	key *ecdsa.PublicKey
+}
+
+// parseP256Verifier reads a P-256 public key, see ParsePublicKey
+func parseP256Verifier(publicKey []byte) (Verifier, error) {
+	key, err := ParsePublicKey(publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return p256Verifier{key}, nil
+}
+
+// Verify checks a signature of the digest, see ParseSignature
+func (v p256Verifier) Verify(digest, signature []byte) bool {
+	r, s, err := ParseSignature(signature)
+	if err != nil {
+		return false
+	}
+
+	return ecdsa.Verify(v.key, digest, r, s)
+}
+
+// legacyPublicKey gets the public key in the layout used before compression
+func legacyPublicKey(key *ecdsa.PublicKey) []byte {
+	return append(key.X.Bytes(), key.Y.Bytes()...)
+}
+
+// ParsePublicKey reads a public key
+//
+// Compressed keys must be valid points. Keys in the layout used before
+// compression are split where both halves are minimal and the point is on
+// the curve, those layouts are never 33 bytes long.
+func ParsePublicKey(publicKey []byte) (*ecdsa.PublicKey, error) {
+	curve := elliptic.P256()
+
+	if len(publicKey) == CompressedKeyLength {
+		x, y := elliptic.UnmarshalCompressed(curve, publicKey)
+		if x == nil {
+			return nil, ErrInvalidPublicKey
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+
+	for _, xLength := range minimalSplits(publicKey) {
+		x := new(big.Int).SetBytes(publicKey[:xLength])
+		y := new(big.Int).SetBytes(publicKey[xLength:])
+		if curve.IsOnCurve(x, y) {
+			return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+		}
+	}
+
+	return nil, ErrInvalidPublicKey
+}
+
+// minimalSplits lists where data can be split into two minimal scalars
+func minimalSplits(data []byte) []int {
+	var lengths []int
+
+	for first := len(data) - scalarLength; first <= scalarLength; first++ {
+		if first < 1 || first >= len(data) {
+			continue
+		}
+		if data[0] == 0 || data[first] == 0 {
+			continue
+		}
+		lengths = append(lengths, first)
+	}
+
+	return lengths
+}
+
+// SignDigest signs the digest with the deterministic nonce of RFC 6979 and
+// a low s
+// The digest is a SHA-256 hash, the nonce is derived with HMAC-SHA256.
+func SignDigest(key *ecdsa.PrivateKey, digest []byte) ([]byte, error) {
+	r, s, err := signDeterministic(key, digest)
+	if err != nil {
+		return nil, err
+	}
+
+	// Both s and n - s verify, only the lower one is canonical
+	n := key.Curve.Params().N
+	if s.Cmp(halfOrder(n)) > 0 {
+		s.Sub(n, s)
+	}
+
+	return append(r.FillBytes(make([]byte, scalarLength)), s.FillBytes(make([]byte, scalarLength))...), nil
+}
+
+// ParseSignature reads a signature
+// It refuses other lengths, values out of range and high s
+func ParseSignature(signature []byte) (*big.Int, *big.Int, error) {
+	if len(signature) != SignatureLength {
+		return nil, nil, ErrInvalidSignature
+	}
+
+	n := elliptic.P256().Params().N
+	r := new(big.Int).SetBytes(signature[:scalarLength])
+	s := new(big.Int).SetBytes(signature[scalarLength:])
+	if r.Sign() == 0 || r.Cmp(n) >= 0 || s.Sign() == 0 || s.Cmp(halfOrder(n)) > 0 {
+		return nil, nil, ErrInvalidSignature
+	}
+
+	return r, s, nil
+}
+
+// VerifyDigest checks a signature of the digest by a public key of any type
+// Only canonical signatures are valid
+func VerifyDigest(publicKey, digest, signature []byte) bool {
+	verifier, err := ParseVerifier(publicKey)
+	if err != nil {
+		return false
+	}
+
+	return verifier.Verify(digest, signature)
+}
+
+// VerifyLegacyDigest checks a signature made before signatures had a fixed
+// width
+// r and s dropped their leading zeros, so every split is tried. Only P-256
+// keys existed then.
+func VerifyLegacyDigest(publicKey, digest, signature []byte) bool {
+	key, err := ParsePublicKey(publicKey)
+	if err != nil {
+		return false
+	}
+
+	for _, rLength := range minimalSplits(signature) {
+		r := new(big.Int).SetBytes(signature[:rLength])
+		s := new(big.Int).SetBytes(signature[rLength:])
+		if ecdsa.Verify(key, digest, r, s) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// halfOrder gets the largest canonical s
+func halfOrder(n *big.Int) *big.Int {
+	return new(big.Int).Rsh(n, 1)
+}
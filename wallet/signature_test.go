@@ -0,0 +1,209 @@
+package wallet
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"math/big"
+	"testing"
+)
+
+// randomKeys is how many random keys the tests sign with
+const randomKeys = 200
+
+func mustDecodeHex(t *testing.T, s string) []byte {
+	t.Helper()
+
+	data, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return data
+}
+
+func randomDigest(t *testing.T) []byte {
+	t.Helper()
+
+	digest := make([]byte, sha256.Size)
+	if _, err := rand.Read(digest); err != nil {
+		t.Fatal(err)
+	}
+
+	return digest
+}
+
+// TestSignDigestRFC6979 checks the vectors of RFC 6979 A.2.5 for P-256 and
+// SHA-256, with s made low
+func TestSignDigestRFC6979(t *testing.T) {
+	key := p256PrivateKey(mustDecodeHex(t, "C9AFA9D845BA75166B5C215767B1D6934E50C3DB36E89B127B8A622B120F6721"))
+	n := elliptic.P256().Params().N
+
+	tests := []struct {
+		message string
+		r, s    string
+	}{
+		{
+			"sample",
+			"EFD48B2AACB6A8FD1140DD9CD45E81D69D2C877B56AAF991C34D0EA84EAF3716",
+			"F7CB1C942D657C41D436C7A1B6E29F65F3E900DBB9AFF4064DC4AB2F843ACDA8",
+		},
+		{
+			"test",
+			"F1ABB023518351CD71D881567B1EA663ED3EFCF6C5132B354F28D3B0B7D38367",
+			"019F4113742A2B14BD25926B49C649155F267E60D3814B4C0CC84250E46F0083",
+		},
+	}
+
+	for _, test := range tests {
+		digest := sha256.Sum256([]byte(test.message))
+
+		sig, err := SignDigest(key, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		s := new(big.Int).SetBytes(mustDecodeHex(t, test.s))
+		if s.Cmp(halfOrder(n)) > 0 {
+			s.Sub(n, s)
+		}
+		want := append(mustDecodeHex(t, test.r), s.FillBytes(make([]byte, scalarLength))...)
+
+		if !bytes.Equal(sig, want) {
+			t.Errorf("%q: signature %x, want %x", test.message, sig, want)
+		}
+	}
+}
+
+func TestSignDigestRandomKeys(t *testing.T) {
+	n := elliptic.P256().Params().N
+
+	for i := 0; i < randomKeys; i++ {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		digest := randomDigest(t)
+
+		sig, err := SignDigest(key, digest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(sig) != SignatureLength {
+			t.Fatalf("signature of %d bytes", len(sig))
+		}
+
+		again, err := SignDigest(key, digest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(sig, again) {
+			t.Fatalf("signatures %x and %x of the same digest differ", sig, again)
+		}
+
+		r, s, err := ParseSignature(sig)
+		if err != nil {
+			t.Fatalf("signature %x: %v", sig, err)
+		}
+		if s.Cmp(halfOrder(n)) > 0 {
+			t.Fatalf("signature %x has a high s", sig)
+		}
+		if !ecdsa.Verify(&key.PublicKey, digest, r, s) {
+			t.Fatalf("signature %x does not verify with crypto/ecdsa", sig)
+		}
+
+		// Compressed and legacy public keys both verify
+		for _, publicKey := range [][]byte{marshalPublicKey(&key.PublicKey), legacyPublicKey(&key.PublicKey)} {
+			if !VerifyDigest(publicKey, digest, sig) {
+				t.Fatalf("signature %x does not verify with key %x", sig, publicKey)
+			}
+		}
+
+		compressed := marshalPublicKey(&key.PublicKey)
+		if len(compressed) != CompressedKeyLength {
+			t.Fatalf("compressed key of %d bytes", len(compressed))
+		}
+		if VerifyDigest(compressed, randomDigest(t), sig) {
+			t.Fatalf("signature %x verifies another digest", sig)
+		}
+
+		// The high s of the same signature verifies with crypto/ecdsa only
+		high := append(r.FillBytes(make([]byte, scalarLength)), new(big.Int).Sub(n, s).FillBytes(make([]byte, scalarLength))...)
+		if VerifyDigest(compressed, digest, high) {
+			t.Fatalf("high s signature %x verifies", high)
+		}
+	}
+}
+
+func TestParseSignatureRejects(t *testing.T) {
+	n := elliptic.P256().Params().N
+	scalar := func(x *big.Int) []byte {
+		return x.FillBytes(make([]byte, scalarLength))
+	}
+	one := big.NewInt(1)
+
+	tests := []struct {
+		name      string
+		signature []byte
+	}{
+		{"empty", nil},
+		{"short", make([]byte, SignatureLength-1)},
+		{"long", append(append(scalar(one), scalar(one)...), 0)},
+		{"zero r", append(scalar(big.NewInt(0)), scalar(one)...)},
+		{"zero s", append(scalar(one), scalar(big.NewInt(0))...)},
+		{"r of n", append(scalar(n), scalar(one)...)},
+		{"high s", append(scalar(one), scalar(new(big.Int).Add(halfOrder(n), one))...)},
+	}
+
+	for _, test := range tests {
+		if _, _, err := ParseSignature(test.signature); err == nil {
+			t.Errorf("%s: signature was accepted", test.name)
+		}
+	}
+
+	if _, _, err := ParseSignature(append(scalar(one), scalar(halfOrder(n))...)); err != nil {
+		t.Errorf("largest low s was refused: %v", err)
+	}
+}
+
+func TestSignersRandomKeys(t *testing.T) {
+	for _, keyType := range KeyTypes {
+		for i := 0; i < randomKeys; i++ {
+			w, err := MakeWallet(keyType)
+			if err != nil {
+				t.Fatal(err)
+			}
+			signer := w.Signer()
+			digest := randomDigest(t)
+
+			sig, err := signer.Sign(digest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(sig) != SignatureLength {
+				t.Fatalf("%s: signature of %d bytes", keyType, len(sig))
+			}
+
+			again, err := signer.Sign(digest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(sig, again) {
+				t.Fatalf("%s: signatures %x and %x of the same digest differ", keyType, sig, again)
+			}
+
+			if got, _ := PublicKeyType(signer.PublicKey()); got != keyType {
+				t.Fatalf("%s: public key %x has type %s", keyType, signer.PublicKey(), got)
+			}
+			if !VerifyDigest(signer.PublicKey(), digest, sig) {
+				t.Fatalf("%s: signature %x does not verify", keyType, sig)
+			}
+			if VerifyDigest(signer.PublicKey(), randomDigest(t), sig) {
+				t.Fatalf("%s: signature %x verifies another digest", keyType, sig)
+			}
+		}
+	}
+}
@@ -2,55 +2,69 @@ package wallet
 
 import (
 	"bytes"
-	"crypto/ecdsa"
-	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/sha256"
 	"digitalWallet/utils"
+	"fmt"
 	"golang.org/x/crypto/ripemd160"
-	"log"
 )
 
 // Wallet defines wallet model
+// PrivateKey is the 32 byte private key of the key type, see Signer.
 type Wallet struct {
-	//ecdsa = Elipitic  curve digital signature algorithm
-	PrivateKey ecdsa.PrivateKey
+	Type       KeyType
+	PrivateKey []byte
 	PublicKey  []byte
 }
 
 // Defines constants
 const (
 	checksumLength = 4
-	//hexadecimal representation of 0
-	version = byte(0x00)
-
-	walletFile = "./tmp/wallets.data"
 )
 
-// NewKeyPair generates new key pair
-func NewKeyPair() (ecdsa.PrivateKey, []byte) {
-	curve := elliptic.P256()
+// NewKeyPair generates a new private key of the type and its public key
+func NewKeyPair(t KeyType) ([]byte, []byte, error) {
+	if !t.IsValid() {
+		return nil, nil, fmt.Errorf("%w: %d", ErrUnknownKeyType, t)
+	}
 
-	// Generates key
-	private, err := ecdsa.GenerateKey(curve, rand.Reader)
-	if err != nil {
-		log.Panic(err)
+	// Draws keys until one is valid for the type
+	secret := make([]byte, privateKeyLength)
+	for {
+		if _, err := rand.Read(secret); err != nil {
+			return nil, nil, err
+		}
+		if validSecret(t, secret) {
+			break
+		}
 	}
 
-	pub := append(private.PublicKey.X.Bytes(), private.PublicKey.Y.Bytes()...)
+	return secret, newWallet(t, secret, true).PublicKey, nil
+}
 
-	return *private, pub
+// newWallet creates the wallet of a private key of the type
+// Unless compressed is set a P-256 public key has the layout used before
+// compression
+func newWallet(t KeyType, secret []byte, compressed bool) *Wallet {
+	if t == KeyTypeP256 && !compressed {
+		return &Wallet{t, secret, legacyPublicKey(&p256PrivateKey(secret).PublicKey)}
+	}
+
+	return &Wallet{t, secret, tagPublicKey(t, schemes[t].publicKey(secret))}
+}
+
+// Signer gets the signer of the private key of the wallet
+func (w *Wallet) Signer() Signer {
+	return keySigner{*w}
 }
 
 // PublicKeyHash hashes the public key
 func PublicKeyHash(publicKey []byte) []byte {
 	hashedPublicKey := sha256.Sum256(publicKey)
 
+	// Writing to a hash never returns an error
 	hasher := ripemd160.New()
-	_, err := hasher.Write(hashedPublicKey[:])
-	if err != nil {
-		log.Panic(err)
-	}
+	_, _ = hasher.Write(hashedPublicKey[:])
 	publicRipeMd := hasher.Sum(nil)
 
 	return publicRipeMd
@@ -71,8 +85,8 @@ func (w *Wallet) Address() []byte {
 	// Hashes the public key
 	pubHash := PublicKeyHash(w.PublicKey)
 
-	// Creates versioned hash
-	versionedHash := append([]byte{version}, pubHash...)
+	// Creates versioned hash, the version is the key type
+	versionedHash := append([]byte{byte(w.Type)}, pubHash...)
 
 	// Creates Checksum
 	checksum := Checksum(versionedHash)
@@ -86,17 +100,53 @@ func (w *Wallet) Address() []byte {
 	return address
 }
 
-// MakeWallet creates a wallet
-func MakeWallet() *Wallet {
-	privateKey, publicKey := NewKeyPair()
-	wallet := Wallet{privateKey, publicKey}
-	return &wallet
+// MakeWallet creates a wallet with a new key of the type
+func MakeWallet(t KeyType) (*Wallet, error) {
+	privateKey, publicKey, err := NewKeyPair(t)
+	if err != nil {
+		return nil, err
+	}
+	wallet := Wallet{t, privateKey, publicKey}
+	return &wallet, nil
 }
 
-// ValidateAddress validates the address...
-func ValidateAddress(address string) bool {
+// DecodeAddress validates the address and returns its public key hash
+func DecodeAddress(address string) ([]byte, error) {
+	_, pubKeyHash, err := decodeAddress(address)
+
+	return pubKeyHash, err
+}
+
+// AddressKeyType validates the address and returns the type of its key
+// Multisig addresses have no key type.
+func AddressKeyType(address string) (KeyType, error) {
+	version, _, err := decodeAddress(address)
+	if err != nil {
+		return 0, err
+	}
+	if version == MultisigVersion {
+		return 0, fmt.Errorf("%w: %q is a multisig address", ErrInvalidAddress, address)
+	}
+
+	return KeyType(version), nil
+}
+
+// IsMultisigAddress reports whether the address is the address of a multisig
+func IsMultisigAddress(address string) bool {
+	version, _, err := decodeAddress(address)
+
+	return err == nil && version == MultisigVersion
+}
+
+// decodeAddress validates the address and returns its version and public
+// key hash
+// The version is a key type or MultisigVersion.
+func decodeAddress(address string) (byte, []byte, error) {
 	// Decodes address
-	pubKeyHash := utils.Base58Decode([]byte(address))
+	pubKeyHash, err := utils.Base58Decode([]byte(address))
+	if err != nil || len(pubKeyHash) <= 1+checksumLength {
+		return 0, nil, fmt.Errorf("%w: %q", ErrInvalidAddress, address)
+	}
 	actualChecksum := pubKeyHash[len(pubKeyHash)-checksumLength:]
 	version := pubKeyHash[0]
 	pubKeyHash = pubKeyHash[1 : len(pubKeyHash)-checksumLength]
@@ -104,5 +154,16 @@ func ValidateAddress(address string) bool {
 	// Runs sha256 on the versioned hash twice To create a checksum
 	targetChecksum := Checksum(append([]byte{version}, pubKeyHash...))
 
-	return bytes.Compare(actualChecksum, targetChecksum) == 0
+	if !bytes.Equal(actualChecksum, targetChecksum) || !(KeyType(version).IsValid() || version == MultisigVersion) {
+		return 0, nil, fmt.Errorf("%w: %q", ErrInvalidAddress, address)
+	}
+
+	return version, pubKeyHash, nil
+}
+
+// ValidateAddress validates the address...
+func ValidateAddress(address string) bool {
+	_, err := DecodeAddress(address)
+
+	return err == nil
 }
@@ -2,88 +2,549 @@ package wallet
 
 import (
 	"bytes"
+	"crypto/ecdsa"
 	"crypto/elliptic"
+	"digitalWallet/utils"
 	"encoding/gob"
+	"errors"
 	"fmt"
 	"io/ioutil"
-	"log"
 	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
 )
 
 // Defines wallet
+//
+// The wallets file is EncodingMagic followed by
+//
+//	version     int
+//	public keys count, then bytes for each wallet in address order
+//	watch-only  count, then each watch-only address as bytes in order
+//	next index  count, then the key type and the index of the next derived
+//	            address as ints for each key type in order
+//	encrypted   int, 1 when the private keys are encrypted
+//	secrets
+//
+// in the layout of utils.Encoder. Plain secrets are a count followed by each
+// private key as bytes, then the mnemonic as bytes, empty for files without
+// one. Encrypted ones are described in encryption.go. Public keys stay
+// readable so that a locked file still lists its addresses, they hold their
+// key type, see PublicKeyType.
+// Version 1 files have no next index and no mnemonic, version 2 files have
+// no watch-only addresses. Until version 3 the next index is a single int
+// for P-256 keys.
 type Wallets struct {
 	Wallets map[string]*Wallet
+
+	// file is the path of the wallets file
+	file string
+
+	// fileLock holds the lock of the wallets file, nil when loaded read only
+	fileLock *os.File
+
+	// mnemonic is the seed phrase addresses are derived from, empty for
+	// files created before derived addresses
+	mnemonic string
+
+	// next is the index of the next address derived from the mnemonic for
+	// each key type
+	next map[KeyType]int
+
+	// watchOnly holds the addresses watched without a private key
+	watchOnly map[string]bool
+
+	// encryption is set when the private keys are encrypted at rest
+	encryption *encryption
+
+	// locked is set while the private keys of an encrypted file are unknown
+	locked bool
 }
 
-// SaveFile saves wallets file
-func (ws *Wallets) SaveFile() {
-	var content bytes.Buffer
+// Defines wallets file constants
+const (
+	// walletFileVersion is the version of the wallets file layout
+	walletFileVersion = 4
 
-	gob.Register(elliptic.P256())
+	// DefaultGapLimit is how many unused addresses in a row end a restore
+	DefaultGapLimit = 20
+
+	// DefaultWalletDir is the directory of the wallets files
+	DefaultWalletDir = "./tmp"
 
-	encoder := gob.NewEncoder(&content)
-	err := encoder.Encode(ws)
+	// DefaultWalletName is the name of the wallet used when none is given
+	// Its file is the one used before wallets had names
+	DefaultWalletName = "wallets"
+
+	// walletFileExt is the extension of wallets files
+	walletFileExt = ".data"
+)
+
+// walletName matches the names wallets can be given
+var walletName = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// WalletFile gets the path of the wallets file of the named wallet in dir
+func WalletFile(dir, name string) (string, error) {
+	if !walletName.MatchString(name) {
+		return "", fmt.Errorf("%w: %q", ErrInvalidWalletName, name)
+	}
+
+	return filepath.Join(dir, name+walletFileExt), nil
+}
+
+// ListWallets lists the names of the wallets in dir in order
+// A missing directory holds no wallets
+func ListWallets(dir string) ([]string, error) {
+	files, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
 	if err != nil {
-		log.Panic(err)
+		return nil, err
 	}
 
-	err = ioutil.WriteFile(walletFile, content.Bytes(), 0644)
+	var names []string
+	for _, file := range files {
+		name := strings.TrimSuffix(file.Name(), walletFileExt)
+		if file.IsDir() || !strings.HasSuffix(file.Name(), walletFileExt) || !walletName.MatchString(name) {
+			continue
+		}
+		names = append(names, name)
+	}
+
+	return names, nil
+}
+
+// SaveFile saves wallets file
+// The file is only readable by its owner and replaced atomically after the
+// previous one is backed up. Wallets loaded read only cannot be saved.
+func (ws *Wallets) SaveFile() error {
+	if ws.locked {
+		return ErrWalletLocked
+	}
+	if ws.fileLock == nil {
+		return ErrWalletReadOnly
+	}
+
+	content, err := ws.encode()
 	if err != nil {
-		log.Panic(err)
+		return err
 	}
+
+	return writeFileAtomic(ws.file, content)
 }
 
 // LoadFile loads the wallets file
+// Encrypted files are loaded locked, see Unlock
 func (ws *Wallets) LoadFile() error {
-	if _, err := os.Stat(walletFile); os.IsNotExist(err) {
+	fileContent, err := ioutil.ReadFile(ws.file)
+	if err != nil {
 		return err
 	}
 
-	var wallets Wallets
+	return ws.load(fileContent)
+}
 
-	fileContent, err := ioutil.ReadFile(walletFile)
+// load loads the content of a wallets file
+func (ws *Wallets) load(content []byte) error {
+	// Files written before the binary layout are plain gob
+	if !utils.IsBinaryEncoding(content) {
+		return ws.decodeGob(content)
+	}
+
+	return ws.decode(content)
+}
+
+// RestoreFile replaces the wallets file with the wallets file at in
+// The current file is backed up first and the wallets are loaded again
+func (ws *Wallets) RestoreFile(in string) error {
+	if ws.fileLock == nil {
+		return ErrWalletReadOnly
+	}
+
+	content, err := ioutil.ReadFile(in)
+	if err != nil {
+		return err
+	}
+
+	// Checks the file before anything is replaced
+	restored := Wallets{Wallets: make(map[string]*Wallet), file: ws.file, fileLock: ws.fileLock}
+	if err := restored.load(content); err != nil {
+		return fmt.Errorf("%w: %v", ErrBadWalletFile, err)
+	}
+
+	if err := writeFileAtomic(ws.file, content); err != nil {
+		return err
+	}
+	*ws = restored
+
+	return nil
+}
+
+// Close releases the wallets file
+func (ws *Wallets) Close() error {
+	if ws.fileLock == nil {
+		return nil
+	}
+
+	err := ws.fileLock.Close()
+	ws.fileLock = nil
+
+	return err
+}
+
+// decodeGob loads a wallets file written with gob
+// Only P-256 keys existed then.
+func (ws *Wallets) decodeGob(content []byte) error {
+	var wallets struct {
+		Wallets map[string]*struct {
+			PrivateKey ecdsa.PrivateKey
+			PublicKey  []byte
+		}
+	}
 
 	gob.Register(elliptic.P256())
-	decoder := gob.NewDecoder(bytes.NewReader(fileContent))
-	err = decoder.Decode(&wallets)
+	decoder := gob.NewDecoder(bytes.NewReader(content))
+	err := decoder.Decode(&wallets)
 	if err != nil {
 		return err
 	}
 
-	ws.Wallets = wallets.Wallets
+	ws.Wallets = make(map[string]*Wallet)
+	for address, w := range wallets.Wallets {
+		secret := w.PrivateKey.D.FillBytes(make([]byte, privateKeyLength))
+		ws.Wallets[address] = &Wallet{KeyTypeP256, secret, w.PublicKey}
+	}
 
 	return nil
 }
 
-// CreateWallets creates wallets list
-func CreateWallets() (*Wallets, error) {
-	wallets := Wallets{}
+// addresses lists the addresses of the wallets in order
+func (ws *Wallets) addresses() []string {
+	addresses := ws.GetAllAddresses()
+	sort.Strings(addresses)
+
+	return addresses
+}
+
+// encode converts the wallets to the file layout
+func (ws *Wallets) encode() ([]byte, error) {
+	var e utils.Encoder
+
+	addresses := ws.addresses()
+
+	e.WriteMagic()
+	e.WriteInt(walletFileVersion)
+	e.WriteUint(uint64(len(addresses)))
+	for _, address := range addresses {
+		e.WriteBytes(ws.Wallets[address].PublicKey)
+	}
+	watchOnly := ws.WatchOnlyAddresses()
+	e.WriteUint(uint64(len(watchOnly)))
+	for _, address := range watchOnly {
+		e.WriteBytes([]byte(address))
+	}
+	var types []KeyType
+	for _, t := range KeyTypes {
+		if ws.next[t] > 0 {
+			types = append(types, t)
+		}
+	}
+	e.WriteUint(uint64(len(types)))
+	for _, t := range types {
+		e.WriteInt(int64(t))
+		e.WriteInt(int64(ws.next[t]))
+	}
+
+	if ws.encryption == nil {
+		e.WriteInt(0)
+		ws.encodeSecrets(&e, addresses)
+		return e.Bytes(), nil
+	}
+
+	var secrets utils.Encoder
+	ws.encodeSecrets(&secrets, addresses)
+
+	e.WriteInt(1)
+	if err := ws.encryption.seal(&e, secrets.Bytes()); err != nil {
+		return nil, err
+	}
+
+	return e.Bytes(), nil
+}
+
+// decode loads the file layout written by encode
+func (ws *Wallets) decode(content []byte) error {
+	d := utils.NewDecoder(content)
+	if err := d.ReadMagic(); err != nil {
+		return err
+	}
+
+	version, err := d.ReadInt()
+	if err != nil {
+		return err
+	}
+	if version < 1 || version > walletFileVersion {
+		return fmt.Errorf("%w: version %d", ErrBadWalletFile, version)
+	}
+
+	count, err := d.ReadLength()
+	if err != nil {
+		return err
+	}
+	var publicKeys [][]byte
+	for i := 0; i < count; i++ {
+		publicKey, err := d.ReadBytes()
+		if err != nil {
+			return err
+		}
+		publicKeys = append(publicKeys, publicKey)
+	}
+
+	if version > 2 {
+		count, err := d.ReadLength()
+		if err != nil {
+			return err
+		}
+		ws.watchOnly = make(map[string]bool)
+		for i := 0; i < count; i++ {
+			address, err := d.ReadBytes()
+			if err != nil {
+				return err
+			}
+			if !ValidateAddress(string(address)) {
+				return fmt.Errorf("%w: watch-only address %q", ErrBadWalletFile, address)
+			}
+			ws.watchOnly[string(address)] = true
+		}
+	}
+
+	ws.next = make(map[KeyType]int)
+	if version > 3 {
+		count, err := d.ReadLength()
+		if err != nil {
+			return err
+		}
+		for i := 0; i < count; i++ {
+			t, err := d.ReadInt()
+			if err != nil {
+				return err
+			}
+			if t < 0 || t > 0xff || !KeyType(t).IsValid() {
+				return fmt.Errorf("%w: key type %d", ErrBadWalletFile, t)
+			}
+			if err := ws.decodeNext(d, KeyType(t)); err != nil {
+				return err
+			}
+		}
+	} else if version > 1 {
+		if err := ws.decodeNext(d, KeyTypeP256); err != nil {
+			return err
+		}
+	}
+
+	encrypted, err := d.ReadInt()
+	if err != nil {
+		return err
+	}
+
+	wallets := make(map[string]*Wallet)
+	for _, publicKey := range publicKeys {
+		t, _ := PublicKeyType(publicKey)
+		w := &Wallet{Type: t, PublicKey: publicKey}
+		wallets[string(w.Address())] = w
+	}
+	ws.Wallets = wallets
+
+	switch encrypted {
+	case 0:
+		return ws.decodeSecrets(d)
+	case 1:
+		ws.encryption, err = openEncryption(d, content)
+		ws.locked = true
+		return err
+	default:
+		return fmt.Errorf("%w: encryption %d", ErrBadWalletFile, encrypted)
+	}
+}
+
+// decodeNext reads the index of the next derived address of the key type
+func (ws *Wallets) decodeNext(d *utils.Decoder, t KeyType) error {
+	next, err := d.ReadInt()
+	if err != nil {
+		return err
+	}
+	if next < 0 {
+		return fmt.Errorf("%w: next index %d", ErrBadWalletFile, next)
+	}
+	ws.next[t] = int(next)
+
+	return nil
+}
+
+// encodeSecrets writes the private keys of the wallets at addresses and
+// the mnemonic
+func (ws *Wallets) encodeSecrets(e *utils.Encoder, addresses []string) {
+	e.WriteUint(uint64(len(addresses)))
+	for _, address := range addresses {
+		e.WriteBytes(ws.Wallets[address].PrivateKey)
+	}
+	e.WriteBytes([]byte(ws.mnemonic))
+}
+
+// decodeSecrets reads the secrets written by encodeSecrets into the wallets
+// Secrets of version 1 files end after the private keys
+func (ws *Wallets) decodeSecrets(d *utils.Decoder) error {
+	addresses := ws.addresses()
+
+	count, err := d.ReadLength()
+	if err != nil {
+		return err
+	}
+	if count != len(addresses) {
+		return fmt.Errorf("%w: %d private keys for %d wallets", ErrBadWalletFile, count, len(addresses))
+	}
+
+	for _, address := range addresses {
+		secret, err := d.ReadBytes()
+		if err != nil {
+			return err
+		}
+
+		// P-256 scalars were written without their leading zeros
+		w := ws.Wallets[address]
+		if w.Type == KeyTypeP256 && len(secret) < privateKeyLength {
+			secret = append(make([]byte, privateKeyLength-len(secret)), secret...)
+		}
+		if !validSecret(w.Type, secret) {
+			return fmt.Errorf("%w: private key of %s", ErrBadWalletFile, address)
+		}
+
+		// The key must belong to the public key stored for the address,
+		// in either layout
+		key := newWallet(w.Type, secret, len(w.PublicKey) == CompressedKeyLength)
+		if !bytes.Equal(key.PublicKey, w.PublicKey) {
+			return fmt.Errorf("%w: private key does not match %s", ErrBadWalletFile, address)
+		}
+		w.PrivateKey = key.PrivateKey
+	}
+
+	if d.Remaining() > 0 {
+		mnemonic, err := d.ReadBytes()
+		if err != nil {
+			return err
+		}
+		ws.mnemonic = string(mnemonic)
+	}
+
+	return d.Finish()
+}
+
+// CreateWallets creates the wallets list of the wallets file at path
+// A missing wallets file gives an empty list, saved to path. The file is
+// locked until Close so that other processes cannot change it meanwhile.
+func CreateWallets(path string) (*Wallets, error) {
+	fileLock, err := acquireLock(path)
+	if err != nil {
+		return nil, err
+	}
+
+	wallets, err := LoadWallets(path)
+	if err != nil {
+		_ = fileLock.Close()
+		return nil, err
+	}
+	wallets.fileLock = fileLock
+
+	return wallets, nil
+}
+
+// LoadWallets loads the wallets file at path read only
+// A missing wallets file gives an empty list
+func LoadWallets(path string) (*Wallets, error) {
+	wallets := Wallets{file: path}
 	wallets.Wallets = make(map[string]*Wallet)
 
 	// Loads the wallets file
 	err := wallets.LoadFile()
+	if os.IsNotExist(err) {
+		return &wallets, nil
+	}
+	if errors.Is(err, utils.ErrMalformedEncoding) {
+		return nil, fmt.Errorf("%w: %v", ErrBadWalletFile, err)
+	}
+	if err != nil {
+		return nil, err
+	}
 
-	return &wallets, err
+	return &wallets, nil
 }
 
-// AddWallet adds wallet to wallets list
-func (ws *Wallets) AddWallet() string {
+// AddWallet adds the wallet of the next address of the key type derived
+// from the mnemonic
+// Encrypted wallets must be unlocked first
+func (ws *Wallets) AddWallet(t KeyType) (string, error) {
+	if ws.locked {
+		return "", ErrWalletLocked
+	}
+	if !t.IsValid() {
+		return "", fmt.Errorf("%w: %d", ErrUnknownKeyType, t)
+	}
+
+	master, err := ws.masterKey(t)
+	if err != nil {
+		return "", err
+	}
 
-	// Creates a wallet
-	wallet := MakeWallet()
+	// Derives a wallet
+	wallet := deriveWallet(master, ws.next[t])
 	address := fmt.Sprintf("%s", wallet.Address())
 
 	ws.Wallets[address] = wallet
+	delete(ws.watchOnly, address)
+	if ws.next == nil {
+		ws.next = make(map[KeyType]int)
+	}
+	ws.next[t]++
 
-	return address
+	return address, nil
 }
 
 // GetWallet gets wallet based on address
-func (ws Wallets) GetWallet(address string) Wallet {
-	return *ws.Wallets[address]
+// Encrypted wallets must be unlocked first as the private key is needed
+func (ws Wallets) GetWallet(address string) (Wallet, error) {
+	wallet, ok := ws.Wallets[address]
+	if !ok && ws.watchOnly[address] {
+		return Wallet{}, fmt.Errorf("%w: %s", ErrWatchOnly, address)
+	}
+	if !ok {
+		return Wallet{}, fmt.Errorf("%w: %s", ErrWalletNotFound, address)
+	}
+	if ws.locked {
+		return Wallet{}, ErrWalletLocked
+	}
+
+	return *wallet, nil
+}
+
+// PublicKey gets the public key of the address
+// It is known while the wallets are locked.
+func (ws *Wallets) PublicKey(address string) ([]byte, error) {
+	wallet, ok := ws.Wallets[address]
+	if !ok && ws.watchOnly[address] {
+		return nil, fmt.Errorf("%w: %s", ErrWatchOnly, address)
+	}
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrWalletNotFound, address)
+	}
+
+	return wallet.PublicKey, nil
 }
 
 // GetAllAddresses gets all wallets' addresses
+// Watch-only addresses are not included, see WatchOnlyAddresses
 func (ws *Wallets) GetAllAddresses() []string {
 	var addresses []string
 